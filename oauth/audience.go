@@ -0,0 +1,111 @@
+package oauth
+
+import (
+	"net/url"
+
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/errors"
+	"github.com/go-oauth2/oauth2/v4/server"
+	"github.com/tianlin0/go-plat-oauth/oauth/ginserver"
+)
+
+// ErrInvalidTarget RFC 8707 中resource不合法或者客户端不允许访问时的错误
+var ErrInvalidTarget = errors.New("invalid_target")
+
+func init() {
+	errors.Descriptions[ErrInvalidTarget] = "The requested resource is invalid, unknown, or malformed"
+	errors.StatusCodes[ErrInvalidTarget] = 400
+}
+
+// requestResources 请求中的resource参数，可以有多个
+func requestResources(tgr *oauth2.TokenGenerateRequest) []string {
+	if tgr.Request == nil {
+		return nil
+	}
+	if err := tgr.Request.ParseForm(); err != nil {
+		return nil
+	}
+	return tgr.Request.Form["resource"]
+}
+
+// checkResources resource必须是不带fragment的绝对地址，并且在允许的范围内，返回去重以后的列表
+func checkResources(resources []string, allowed []string) ([]string, error) {
+	result := make([]string, 0, len(resources))
+	seen := make(map[string]bool)
+	for _, resource := range resources {
+		u, err := url.Parse(resource)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return nil, ErrInvalidTarget
+		}
+		if seen[resource] {
+			continue
+		}
+		found := false
+		for _, one := range allowed {
+			if one == resource {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, ErrInvalidTarget
+		}
+		seen[resource] = true
+		result = append(result, resource)
+	}
+	return result, nil
+}
+
+// audienceClientScopeHandler 先按原来的方式检查scope，再检查resource参数，并把resource作为audience保存在token的scope中
+func audienceClientScopeHandler(next server.ClientScopeHandler, clientResources func(clientID string) []string) server.ClientScopeHandler {
+	return func(tgr *oauth2.TokenGenerateRequest) (bool, error) {
+		//客户端直接在scope中带有的audience也需要检查
+		scope, audience := ginserver.SplitAudience(tgr.Scope)
+		if next != nil {
+			checkTgr := *tgr
+			checkTgr.Scope = scope
+			if allowed, err := next(&checkTgr); err != nil || !allowed {
+				return allowed, err
+			}
+		}
+		resources, err := checkResources(append(audience, requestResources(tgr)...), clientResources(tgr.ClientID))
+		if err != nil {
+			return false, err
+		}
+		tgr.Scope = ginserver.WithAudience(scope, resources)
+		return true, nil
+	}
+}
+
+// audienceRefreshingScopeHandler 刷新token时保留原来的audience，resource参数只能缩小范围
+func audienceRefreshingScopeHandler(next server.RefreshingScopeHandler, clientResources func(clientID string) []string) server.RefreshingScopeHandler {
+	return func(tgr *oauth2.TokenGenerateRequest, oldScope string) (bool, error) {
+		scope, audience := ginserver.SplitAudience(tgr.Scope)
+		oldScope, oldAudience := ginserver.SplitAudience(oldScope)
+		if next != nil {
+			checkTgr := *tgr
+			checkTgr.Scope = scope
+			if allowed, err := next(&checkTgr, oldScope); err != nil || !allowed {
+				return allowed, err
+			}
+		}
+		resources := append(audience, requestResources(tgr)...)
+		if len(resources) == 0 {
+			resources = oldAudience
+		} else {
+			allowedResources := oldAudience
+			if len(allowedResources) == 0 {
+				allowedResources = clientResources(tgr.ClientID)
+			}
+			var err error
+			if resources, err = checkResources(resources, allowedResources); err != nil {
+				return false, err
+			}
+		}
+		if scope == "" {
+			scope = oldScope
+		}
+		tgr.Scope = ginserver.WithAudience(scope, resources)
+		return true, nil
+	}
+}
@@ -0,0 +1,57 @@
+package oauth
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+	"github.com/tianlin0/go-plat-oauth/oauth/ginserver"
+)
+
+func TestAudienceScopeHandlers(t *testing.T) {
+	clientResources := func(clientID string) []string {
+		return []string{"https://billing.example.com", "https://files.example.com"}
+	}
+	newTgr := func(scope string, resources ...string) *oauth2.TokenGenerateRequest {
+		form := url.Values{"resource": resources}
+		return &oauth2.TokenGenerateRequest{
+			ClientID: "client1",
+			Scope:    scope,
+			Request:  httptest.NewRequest("GET", "/oauth2/authorize?"+form.Encode(), nil),
+		}
+	}
+
+	clientHandler := audienceClientScopeHandler(nil, clientResources)
+	tgr := newTgr("read", "https://billing.example.com", "https://files.example.com")
+	if allowed, err := clientHandler(tgr); !allowed || err != nil {
+		t.Fatalf("resource rejected: %v", err)
+	}
+	scope, audience := ginserver.SplitAudience(tgr.Scope)
+	if scope != "read" || len(audience) != 2 {
+		t.Fatalf("unexpected scope %q", tgr.Scope)
+	}
+	for _, resource := range []string{"https://other.example.com", "/relative", "https://billing.example.com#x"} {
+		if _, err := clientHandler(newTgr("read", resource)); err != ErrInvalidTarget {
+			t.Fatalf("%s: unexpected error %v", resource, err)
+		}
+	}
+	//客户端不能直接在scope中带上audience
+	if _, err := clientHandler(newTgr("read resource:https://other.example.com")); err != ErrInvalidTarget {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	refreshHandler := audienceRefreshingScopeHandler(nil, clientResources)
+	oldScope := tgr.Scope
+	tgr = newTgr("read")
+	if allowed, err := refreshHandler(tgr, oldScope); !allowed || err != nil || tgr.Scope != oldScope {
+		t.Fatalf("audience not kept: %q %v", tgr.Scope, err)
+	}
+	tgr = newTgr("read", "https://files.example.com")
+	if _, err := refreshHandler(tgr, oldScope); err != nil || tgr.Scope != "read resource:https://files.example.com" {
+		t.Fatalf("audience not narrowed: %q %v", tgr.Scope, err)
+	}
+	if _, err := refreshHandler(newTgr("read", "https://files.example.com"), "read resource:https://billing.example.com"); err != ErrInvalidTarget {
+		t.Fatalf("audience widened: %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+// Package client 访问授权服务的客户端，申请和刷新token，读取/oauth2/read的信息
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-oauth2/oauth2/v4/models"
+	"github.com/tianlin0/go-plat-utils/utils/httputil"
+	"golang.org/x/oauth2"
+)
+
+// Config 授权服务和客户端的配置
+type Config struct {
+	BaseURL      string        //授权服务的地址，例如 http://localhost:8083，包含StartGinOAuthServer的路由前缀
+	ClientID     string        //客户端
+	ClientSecret string        //客户端的密钥
+	Scopes       []string      //申请的scope
+	HTTPClient   *http.Client  //http客户端，默认10秒超时
+	EarlyRenewal time.Duration //TokenSource在过期前多久重新申请，默认1分钟
+	Jitter       time.Duration //提前申请的随机时间，避免多个实例同时申请，默认30秒
+}
+
+// Client 授权服务的客户端
+type Client struct {
+	cfg Config
+}
+
+// Error 授权服务返回的错误
+type Error struct {
+	StatusCode  int    //HTTP状态码
+	Code        string //错误码，例如invalid_client、invalid_grant
+	Description string //错误说明
+}
+
+// Error 错误说明
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return fmt.Sprintf("oauth2: %s (status %d)", e.Code, e.StatusCode)
+	}
+	return fmt.Sprintf("oauth2: %s: %s (status %d)", e.Code, e.Description, e.StatusCode)
+}
+
+// New 创建客户端
+func New(cfg Config) *Client {
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.EarlyRenewal <= 0 {
+		cfg.EarlyRenewal = time.Minute
+	}
+	if cfg.Jitter < 0 {
+		cfg.Jitter = 0
+	} else if cfg.Jitter == 0 {
+		cfg.Jitter = 30 * time.Second
+	}
+	return &Client{cfg: cfg}
+}
+
+// ClientCredentials 使用client_credentials申请token
+func (c *Client) ClientCredentials(ctx context.Context) (*oauth2.Token, error) {
+	return c.requestToken(ctx, url.Values{"grant_type": {"client_credentials"}})
+}
+
+// Refresh 使用refresh token申请新的token，原来的token会失效
+func (c *Client) Refresh(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	return c.requestToken(ctx, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}})
+}
+
+// requestToken 以POST表单访问/oauth2/token，client_secret放在HTTP Basic认证中，不出现在url里
+func (c *Client) requestToken(ctx context.Context, params url.Values) (*oauth2.Token, error) {
+	if len(c.cfg.Scopes) > 0 {
+		params.Set("scope", strings.Join(c.cfg.Scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.BaseURL+"/oauth2/token", strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(c.cfg.ClientID, c.cfg.ClientSecret)
+	body, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+		Scope        string `json:"scope"`
+	}
+	if err = json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.AccessToken == "" {
+		return nil, fmt.Errorf("oauth2: server response missing access_token")
+	}
+	token := &oauth2.Token{
+		AccessToken:  resp.AccessToken,
+		TokenType:    resp.TokenType,
+		RefreshToken: resp.RefreshToken,
+	}
+	if resp.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+	return token.WithExtra(map[string]interface{}{"scope": resp.Scope}), nil
+}
+
+// Read 读取token的信息，服务端没有设置ReadUserCallbackHandler时使用
+func (c *Client) Read(ctx context.Context, accessToken string) (*models.Token, error) {
+	ti := &models.Token{}
+	if err := c.ReadInto(ctx, accessToken, ti); err != nil {
+		return nil, err
+	}
+	return ti, nil
+}
+
+// ReadInto 读取/oauth2/read的信息，解析CommResponse中的data，服务端设置了ReadUserCallbackHandler时使用
+func (c *Client) ReadInto(ctx context.Context, accessToken string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.BaseURL+"/oauth2/read", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	body, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	resp := &httputil.CommResponse{Data: out}
+	if err = json.Unmarshal(body, resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 && resp.Code != http.StatusOK {
+		return &Error{StatusCode: resp.Code, Code: http.StatusText(resp.Code), Description: resp.Message}
+	}
+	return nil
+}
+
+// do 发送请求，非200时解析错误
+func (c *Client) do(req *http.Request) ([]byte, error) {
+	req.Header.Set("Accept", "application/json")
+	res, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		e := &Error{StatusCode: res.StatusCode}
+		var data struct {
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &data) == nil {
+			e.Code, e.Description = data.Error, data.ErrorDescription
+		}
+		if e.Code == "" {
+			e.Code = http.StatusText(res.StatusCode)
+		}
+		return nil, e
+	}
+	return body, nil
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-oauth2/oauth2/v4/models"
+	"github.com/go-oauth2/oauth2/v4/store"
+	"github.com/tianlin0/go-plat-oauth/oauth"
+	"golang.org/x/oauth2"
+)
+
+func TestClient(t *testing.T) {
+	clientStore := store.NewClientStore()
+	_ = clientStore.Set("client1", &models.Client{ID: "client1", Secret: "secret1"})
+	srv := oauth.NewHTTPOAuthServer(&oauth.GinOauthOption{ClientStore: clientStore})
+	if srv == nil {
+		t.Fatal("server not started")
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//client_secret不能出现在url中
+		if strings.Contains(r.URL.RawQuery, "secret") {
+			t.Errorf("client secret in query: %s %s", r.Method, r.URL)
+		}
+		srv.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	c := New(Config{BaseURL: ts.URL, ClientID: "client1", ClientSecret: "secret1", Scopes: []string{"read"}})
+	token, err := c.ClientCredentials(ctx)
+	if err != nil || token.Expiry.IsZero() || token.Extra("scope") != "read" {
+		t.Fatalf("unexpected token %+v %v", token, err)
+	}
+	ti, err := c.Read(ctx, token.AccessToken)
+	if err != nil || ti.ClientID != "client1" || ti.Scope != "read" {
+		t.Fatalf("unexpected token info %+v %v", ti, err)
+	}
+	if _, err = c.Read(ctx, "unknown"); err == nil || err.(*Error).Code != "invalid_token" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	bad := New(Config{BaseURL: ts.URL, ClientID: "client1", ClientSecret: "wrong"})
+	if _, err = bad.ClientCredentials(ctx); err == nil || err.(*Error).Code != "invalid_client" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	//快过期的token重新申请，没过期的直接使用
+	source := c.TokenSource(ctx, nil)
+	first, err := source.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := source.Token(); again.AccessToken != first.AccessToken {
+		t.Fatal("token renewed too early")
+	}
+	s := source.(*tokenSource)
+	if left := time.Until(s.renewAt); left > time.Until(first.Expiry)-time.Minute || left < time.Until(first.Expiry)-90*time.Second {
+		t.Fatalf("unexpected renew time %v", left)
+	}
+	s.renewAt = time.Now()
+	renewed, err := source.Token()
+	if err != nil || renewed.AccessToken == first.AccessToken {
+		t.Fatalf("token not renewed %v", err)
+	}
+
+	//自己申请的token，refresh token被拒绝时使用client_credentials重新申请
+	s.token.RefreshToken = "revoked"
+	s.renewAt = time.Now()
+	token, err = source.Token()
+	if err != nil || token.AccessToken == renewed.AccessToken {
+		t.Fatalf("client credentials not used after refresh was rejected: %+v %v", token, err)
+	}
+
+	//传入的token可能是用户的，refresh token被拒绝时返回错误，不能换成客户端的身份
+	source = c.TokenSource(ctx, &oauth2.Token{AccessToken: "old", RefreshToken: "revoked", Expiry: time.Now().Add(time.Minute)})
+	source.(*tokenSource).renewAt = time.Now()
+	if token, err = source.Token(); err == nil || err.(*Error).Code != "invalid_grant" {
+		t.Fatalf("seeded token replaced after refresh was rejected: %+v %v", token, err)
+	}
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// tokenSource 过期前自动重新申请的token
+type tokenSource struct {
+	client *Client
+	ctx    context.Context
+	//创建时没有传入token，使用client_credentials申请，传入的token可能是用户的，只刷新，不会换成客户端自己的身份
+	clientCredentials bool
+
+	mu      sync.Mutex
+	token   *oauth2.Token
+	renewAt time.Time
+}
+
+// TokenSource 自动刷新的token，可以用于oauth2.NewClient、grpcauth.OAuth2TokenSource，
+// token为nil时使用client_credentials申请，refresh token被拒绝时重新申请；
+// 传入token时只使用refresh token刷新，被拒绝(用户退出登录、撤销授权等)时返回invalid_grant错误
+func (c *Client) TokenSource(ctx context.Context, token *oauth2.Token) oauth2.TokenSource {
+	s := &tokenSource{client: c, ctx: ctx, clientCredentials: token == nil}
+	if token != nil {
+		s.setToken(token)
+	}
+	return s
+}
+
+// Token 获取token，在过期前EarlyRenewal加上随机的Jitter时重新申请，同时只会有一个申请
+func (s *tokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != nil && (s.renewAt.IsZero() || time.Now().Before(s.renewAt)) {
+		return s.token, nil
+	}
+	var token *oauth2.Token
+	var err error
+	if s.token != nil && s.token.RefreshToken != "" {
+		token, err = s.client.Refresh(s.ctx, s.token.RefreshToken)
+		//提前刷新失败时，没过期的token可以继续使用，下次再刷新
+		if err != nil && !refreshRejected(err) && s.token.Valid() {
+			return s.token, nil
+		}
+	}
+	if token == nil && s.clientCredentials && (err == nil || refreshRejected(err)) {
+		token, err = s.client.ClientCredentials(s.ctx)
+	}
+	if token == nil && err == nil {
+		//传入的token没有refresh token，过期以后不能再使用
+		if s.token.Valid() {
+			return s.token, nil
+		}
+		err = &Error{Code: "invalid_grant", Description: "the token expired and has no refresh token"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.setToken(token)
+	return token, nil
+}
+
+// setToken 计算重新申请的时间，有效期较短时不超过有效期的一半
+func (s *tokenSource) setToken(token *oauth2.Token) {
+	s.token = token
+	s.renewAt = time.Time{}
+	if token.Expiry.IsZero() {
+		return
+	}
+	early, jitter := s.client.cfg.EarlyRenewal, s.client.cfg.Jitter
+	if lifetime := time.Until(token.Expiry); early+jitter > lifetime/2 {
+		early, jitter = lifetime/4, lifetime/4
+	}
+	if jitter > 0 {
+		early += time.Duration(rand.Int63n(int64(jitter)))
+	}
+	s.renewAt = token.Expiry.Add(-early)
+}
+
+// refreshRejected refresh token已经失效或者被撤销，不能再使用
+func refreshRejected(err error) bool {
+	e, ok := err.(*Error)
+	return ok && e.Code == "invalid_grant"
+}
@@ -0,0 +1,325 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/server"
+	"github.com/tianlin0/go-plat-oauth/oauth/ginserver"
+	"github.com/tianlin0/go-plat-oauth/oauth/httpserver"
+	"github.com/tianlin0/go-plat-utils/utils/httputil"
+)
+
+// ConsentGrant 用户对某个客户端的授权记录
+type ConsentGrant struct {
+	UserID    string    `json:"user_id"`
+	ClientID  string    `json:"client_id"`
+	Scope     string    `json:"scope"`      //已授权的scope，空格分隔
+	CreateAt  time.Time `json:"create_at"`  //首次授权时间
+	UpdateAt  time.Time `json:"update_at"`  //最后一次授权时间
+	RevokedAt time.Time `json:"revoked_at"` //最后一次撤销时间，在此之前生成的token全部失效
+}
+
+// Active 授权是否有效，撤销以后重新授权也算有效
+func (g *ConsentGrant) Active() bool {
+	if g == nil {
+		return false
+	}
+	return g.RevokedAt.IsZero() || g.CreateAt.After(g.RevokedAt)
+}
+
+// ConsentStore 用户授权记录的存储
+type ConsentStore interface {
+	// Save 新增或者覆盖授权记录
+	Save(ctx context.Context, grant *ConsentGrant) error
+	// Get 获取用户对客户端的授权记录，不存在时返回nil
+	Get(ctx context.Context, userID, clientID string) (*ConsentGrant, error)
+	// List 获取用户的所有授权记录，包括已撤销的
+	List(ctx context.Context, userID string) ([]*ConsentGrant, error)
+}
+
+// ConsentPromptHandler 展示授权确认页面，用户同意时返回true，
+// 返回false表示页面已经输出，等待用户确认
+type ConsentPromptHandler func(w http.ResponseWriter, r *http.Request, userID, clientID, scope string) (approved bool, err error)
+
+// NewMemoryConsentStore 内存存储，重启以后授权记录丢失，只适合单机测试
+func NewMemoryConsentStore() ConsentStore {
+	return &memoryConsentStore{
+		data: make(map[string]map[string]ConsentGrant),
+	}
+}
+
+type memoryConsentStore struct {
+	lock sync.RWMutex
+	data map[string]map[string]ConsentGrant
+}
+
+// Save 保存
+func (s *memoryConsentStore) Save(_ context.Context, grant *ConsentGrant) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	userGrants, ok := s.data[grant.UserID]
+	if !ok {
+		userGrants = make(map[string]ConsentGrant)
+		s.data[grant.UserID] = userGrants
+	}
+	userGrants[grant.ClientID] = *grant
+	return nil
+}
+
+// Get 获取
+func (s *memoryConsentStore) Get(_ context.Context, userID, clientID string) (*ConsentGrant, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if grant, ok := s.data[userID][clientID]; ok {
+		return &grant, nil
+	}
+	return nil, nil
+}
+
+// List 列表
+func (s *memoryConsentStore) List(_ context.Context, userID string) ([]*ConsentGrant, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	list := make([]*ConsentGrant, 0, len(s.data[userID]))
+	for _, grant := range s.data[userID] {
+		one := grant
+		list = append(list, &one)
+	}
+	return list, nil
+}
+
+// SaveConsent 记录用户同意授权，与已有授权的scope合并
+func SaveConsent(ctx context.Context, consentStore ConsentStore, userID, clientID, scope string) error {
+	now := time.Now()
+	grant, err := consentStore.Get(ctx, userID, clientID)
+	if err != nil {
+		return err
+	}
+	if grant == nil {
+		grant = &ConsentGrant{UserID: userID, ClientID: clientID}
+	}
+	if !grant.Active() {
+		//撤销以后重新授权，以前的scope不再保留
+		grant.Scope = ""
+		grant.CreateAt = now
+	}
+	grant.Scope = mergeScope(grant.Scope, scope)
+	grant.UpdateAt = now
+	return consentStore.Save(ctx, grant)
+}
+
+// RevokeConsent 撤销用户对客户端的授权，该客户端为该用户生成的所有token都会失效
+func RevokeConsent(ctx context.Context, consentStore ConsentStore, userID, clientID string) error {
+	grant, err := consentStore.Get(ctx, userID, clientID)
+	if err != nil {
+		return err
+	}
+	if grant == nil {
+		grant = &ConsentGrant{UserID: userID, ClientID: clientID}
+	}
+	now := time.Now()
+	grant.Scope = ""
+	grant.UpdateAt = now
+	grant.RevokedAt = now
+	return consentStore.Save(ctx, grant)
+}
+
+// ListConsents 获取用户有效的授权列表
+func ListConsents(ctx context.Context, consentStore ConsentStore, userID string) ([]*ConsentGrant, error) {
+	list, err := consentStore.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	activeList := make([]*ConsentGrant, 0, len(list))
+	for _, grant := range list {
+		if grant.Active() {
+			activeList = append(activeList, grant)
+		}
+	}
+	sort.Slice(activeList, func(i, j int) bool {
+		return activeList[i].UpdateAt.After(activeList[j].UpdateAt)
+	})
+	return activeList, nil
+}
+
+// splitScope scope按空格分隔
+func splitScope(scope string) []string {
+	return strings.Fields(scope)
+}
+
+// containsScope 已授权的scope是否包含了请求的全部scope
+func containsScope(granted, requested string) bool {
+	grantedMap := make(map[string]bool)
+	for _, one := range splitScope(granted) {
+		grantedMap[one] = true
+	}
+	for _, one := range splitScope(requested) {
+		if !grantedMap[one] {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeScope 合并scope并去重
+func mergeScope(scopes ...string) string {
+	list := make([]string, 0)
+	exists := make(map[string]bool)
+	for _, scope := range scopes {
+		for _, one := range splitScope(scope) {
+			if exists[one] {
+				continue
+			}
+			exists[one] = true
+			list = append(list, one)
+		}
+	}
+	return strings.Join(list, " ")
+}
+
+// getConsentUserAuthorizationHandler 用户登录以后，检查是否已经授权，未授权时展示确认页面并记录授权，
+// prompt=consent 时不论是否授权过都重新确认，prompt=none 时未授权直接返回错误
+func getConsentUserAuthorizationHandler(oauthConfig *GinOauthOption, next server.UserAuthorizationHandler) server.UserAuthorizationHandler {
+	return func(w http.ResponseWriter, r *http.Request) (string, error) {
+		userID, err := next(w, r)
+		if err != nil || userID == "" {
+			return userID, err
+		}
+
+		ctx := r.Context()
+		clientID := r.FormValue("client_id")
+		scope := r.FormValue("scope")
+		prompt := promptValues(r)
+
+		grant, err := oauthConfig.ConsentStore.Get(ctx, userID, clientID)
+		if err != nil {
+			return "", err
+		}
+		if !prompt["consent"] && grant.Active() && containsScope(grant.Scope, scope) {
+			//已经授权过，不再提示
+			return userID, nil
+		}
+		if prompt["none"] {
+			return "", ErrConsentRequired
+		}
+
+		if oauthConfig.ConsentPromptHandler != nil {
+			approved, err := oauthConfig.ConsentPromptHandler(w, r, userID, clientID, scope)
+			if err != nil {
+				return "", err
+			}
+			if !approved {
+				return "", nil
+			}
+		}
+
+		if err = SaveConsent(ctx, oauthConfig.ConsentStore, userID, clientID, scope); err != nil {
+			return "", err
+		}
+		return userID, nil
+	}
+}
+
+// getConsentValidation 撤销授权之前生成的token视为无效，不能再使用和刷新
+func getConsentValidation(consentStore ConsentStore) tokenValidation {
+	return func(ctx context.Context, ti oauth2.TokenInfo, createAt time.Time) (bool, error) {
+		if ti.GetUserID() == "" {
+			return true, nil
+		}
+		grant, err := consentStore.Get(ctx, ti.GetUserID(), ti.GetClientID())
+		if err != nil {
+			return false, err
+		}
+		if grant == nil || grant.RevokedAt.IsZero() {
+			return true, nil
+		}
+		return createAt.After(grant.RevokedAt), nil
+	}
+}
+
+// defaultConsentScope 查看和撤销授权记录默认需要的scope
+const defaultConsentScope = "consents"
+
+// getConsentUserID 获取当前登录的用户，只接受带有consentScope的用户bearer token，
+// api key等其他认证方式以及普通客户端的token都不能查看和撤销用户的授权
+func getConsentUserID(c *gin.Context, consentScope string) (string, bool) {
+	p, ok := ginserver.GetPrincipal(c)
+	if !ok || p.Method != httpserver.AuthMethodBearer || p.TokenInfo == nil || p.TokenInfo.GetUserID() == "" {
+		return "", false
+	}
+	return p.TokenInfo.GetUserID(), httpserver.HasScope(p.TokenInfo, consentScope)
+}
+
+// checkConsentUser 获取当前登录的用户，未登录或者没有权限时输出错误
+func checkConsentUser(c *gin.Context, consentScope string) string {
+	userID, allowed := getConsentUserID(c, consentScope)
+	if userID == "" {
+		writeUnauthorized(c)
+		return ""
+	}
+	if !allowed {
+		_ = httputil.WriteCommResponse(c.Writer, &httputil.CommResponse{
+			Code:    http.StatusForbidden,
+			Message: "the " + consentScope + " scope is required",
+		})
+		return ""
+	}
+	return userID
+}
+
+// startConsentRoute 用户查看已授权的应用以及撤销授权，需要用户的bearer token带有ConsentScope
+func startConsentRoute(auth *gin.RouterGroup, oauthConfig *GinOauthOption, middleHandle gin.HandlerFunc) {
+	consentStore := oauthConfig.ConsentStore
+	consentScope := oauthConfig.ConsentScope
+	if consentScope == "" {
+		consentScope = defaultConsentScope
+	}
+
+	auth.GET("/consents", middleHandle, func(c *gin.Context) {
+		userID := checkConsentUser(c, consentScope)
+		if userID == "" {
+			return
+		}
+		list, err := ListConsents(c.Request.Context(), consentStore, userID)
+		if err != nil {
+			_ = httputil.WriteCommResponse(c.Writer, &httputil.CommResponse{
+				Code:    http.StatusInternalServerError,
+				Message: err.Error(),
+			})
+			return
+		}
+		_ = httputil.WriteCommResponse(c.Writer, &httputil.CommResponse{
+			Data: list,
+		})
+	})
+
+	auth.DELETE("/consents/:client_id", middleHandle, func(c *gin.Context) {
+		userID := checkConsentUser(c, consentScope)
+		if userID == "" {
+			return
+		}
+		err := RevokeConsent(c.Request.Context(), consentStore, userID, c.Param("client_id"))
+		if err != nil {
+			_ = httputil.WriteCommResponse(c.Writer, &httputil.CommResponse{
+				Code:    http.StatusInternalServerError,
+				Message: err.Error(),
+			})
+			return
+		}
+		_ = httputil.WriteCommResponse(c.Writer, &httputil.CommResponse{})
+	})
+}
+
+func writeUnauthorized(c *gin.Context) {
+	_ = httputil.WriteCommResponse(c.Writer, &httputil.CommResponse{
+		Code:    http.StatusUnauthorized,
+		Message: http.StatusText(http.StatusUnauthorized),
+	})
+}
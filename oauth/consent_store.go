@@ -0,0 +1,192 @@
+package oauth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+const defaultConsentTableName = "oauth2_consent"
+
+// NewRedisConsentStore 授权记录存储到redis中，每个用户一个hash
+func NewRedisConsentStore(cli redis.UniversalClient, keyNamespace ...string) ConsentStore {
+	s := &redisConsentStore{
+		cli: cli,
+		ns:  "{default-oauth}",
+	}
+	if len(keyNamespace) > 0 && keyNamespace[0] != "" {
+		s.ns = keyNamespace[0]
+	}
+	return s
+}
+
+type redisConsentStore struct {
+	cli redis.UniversalClient
+	ns  string
+}
+
+func (s *redisConsentStore) userKey(userID string) string {
+	return fmt.Sprintf("%sconsent:%s", s.ns, userID)
+}
+
+// Save 保存
+func (s *redisConsentStore) Save(ctx context.Context, grant *ConsentGrant) error {
+	buf, err := json.Marshal(grant)
+	if err != nil {
+		return err
+	}
+	return s.cli.HSet(ctx, s.userKey(grant.UserID), grant.ClientID, buf).Err()
+}
+
+// Get 获取
+func (s *redisConsentStore) Get(ctx context.Context, userID, clientID string) (*ConsentGrant, error) {
+	buf, err := s.cli.HGet(ctx, s.userKey(userID), clientID).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	grant := new(ConsentGrant)
+	if err = json.Unmarshal(buf, grant); err != nil {
+		return nil, err
+	}
+	return grant, nil
+}
+
+// List 列表
+func (s *redisConsentStore) List(ctx context.Context, userID string) ([]*ConsentGrant, error) {
+	all, err := s.cli.HGetAll(ctx, s.userKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*ConsentGrant, 0, len(all))
+	for _, one := range all {
+		grant := new(ConsentGrant)
+		if err = json.Unmarshal([]byte(one), grant); err != nil {
+			return nil, err
+		}
+		list = append(list, grant)
+	}
+	return list, nil
+}
+
+// NewMysqlConsentStore 授权记录存储到mysql中，tableName为空时默认为oauth2_consent
+func NewMysqlConsentStore(db *sql.DB, tableName string) (ConsentStore, error) {
+	return newMysqlConsentStore(db, tableName)
+}
+
+// consentMysqlMigrations 表结构的版本
+var consentMysqlMigrations = []schemaMigration{
+	{version: 1, description: "create consent table", statements: func(tableName string) []string {
+		return []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` ("+
+			"`user_id` VARCHAR(255) NOT NULL,"+
+			"`client_id` VARCHAR(255) NOT NULL,"+
+			"`scope` VARCHAR(2048) NOT NULL DEFAULT '',"+
+			"`create_at` BIGINT NOT NULL DEFAULT 0,"+
+			"`update_at` BIGINT NOT NULL DEFAULT 0,"+
+			"`revoked_at` BIGINT NOT NULL DEFAULT 0,"+
+			"PRIMARY KEY (`user_id`, `client_id`)"+
+			") DEFAULT CHARSET=utf8mb4", tableName)}
+	}},
+}
+
+func newMysqlConsentStore(db *sql.DB, tableName string) (ConsentStore, error) {
+	if tableName == "" {
+		tableName = defaultConsentTableName
+	}
+	s := &mysqlConsentStore{
+		db:        db,
+		tableName: tableName,
+	}
+	if err := migrateMysqlTable(db, tableName, consentMysqlMigrations); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+type mysqlConsentStore struct {
+	db        *sql.DB
+	tableName string
+}
+
+// Save 保存
+func (s *mysqlConsentStore) Save(ctx context.Context, grant *ConsentGrant) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf("INSERT INTO `%s` "+
+		"(`user_id`, `client_id`, `scope`, `create_at`, `update_at`, `revoked_at`) VALUES (?, ?, ?, ?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE `scope` = VALUES(`scope`), `create_at` = VALUES(`create_at`), "+
+		"`update_at` = VALUES(`update_at`), `revoked_at` = VALUES(`revoked_at`)", s.tableName),
+		grant.UserID, grant.ClientID, grant.Scope,
+		timeToUnixNano(grant.CreateAt), timeToUnixNano(grant.UpdateAt), timeToUnixNano(grant.RevokedAt))
+	return err
+}
+
+// Get 获取
+func (s *mysqlConsentStore) Get(ctx context.Context, userID, clientID string) (*ConsentGrant, error) {
+	row := s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT `user_id`, `client_id`, `scope`, `create_at`, `update_at`, `revoked_at` "+
+		"FROM `%s` WHERE `user_id` = ? AND `client_id` = ?", s.tableName), userID, clientID)
+	grant, err := scanConsentGrant(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return grant, err
+}
+
+// List 列表
+func (s *mysqlConsentStore) List(ctx context.Context, userID string) ([]*ConsentGrant, error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf("SELECT `user_id`, `client_id`, `scope`, `create_at`, `update_at`, `revoked_at` "+
+		"FROM `%s` WHERE `user_id` = ?", s.tableName), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	list := make([]*ConsentGrant, 0)
+	for rows.Next() {
+		grant, err := scanConsentGrant(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, grant)
+	}
+	return list, rows.Err()
+}
+
+// rowScanner sql.Row 和 sql.Rows 的公共方法
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanConsentGrant(row rowScanner) (*ConsentGrant, error) {
+	grant := new(ConsentGrant)
+	var createAt, updateAt, revokedAt int64
+	err := row.Scan(&grant.UserID, &grant.ClientID, &grant.Scope, &createAt, &updateAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	grant.CreateAt = unixNanoToTime(createAt)
+	grant.UpdateAt = unixNanoToTime(updateAt)
+	grant.RevokedAt = unixNanoToTime(revokedAt)
+	return grant, nil
+}
+
+// timeToUnixNano 零值时间存储为0
+func timeToUnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func unixNanoToTime(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
@@ -0,0 +1,104 @@
+package oauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/tianlin0/go-plat-oauth/oauth"
+	"github.com/tianlin0/go-plat-utils/utils/httputil"
+)
+
+func TestConsent(t *testing.T) {
+	ctx := context.Background()
+	consentStore := oauth.NewMemoryConsentStore()
+
+	_ = oauth.SaveConsent(ctx, consentStore, "user1", "client1", "read")
+	_ = oauth.SaveConsent(ctx, consentStore, "user1", "client1", "write read")
+	_ = oauth.SaveConsent(ctx, consentStore, "user1", "client2", "read")
+
+	grant, _ := consentStore.Get(ctx, "user1", "client1")
+	if grant == nil || grant.Scope != "read write" {
+		t.Fatalf("scope not merged: %+v", grant)
+	}
+
+	_ = oauth.RevokeConsent(ctx, consentStore, "user1", "client1")
+	list, _ := oauth.ListConsents(ctx, consentStore, "user1")
+	if len(list) != 1 || list[0].ClientID != "client2" {
+		t.Fatalf("revoked consent still listed: %+v", list)
+	}
+
+	_ = oauth.SaveConsent(ctx, consentStore, "user1", "client1", "write")
+	grant, _ = consentStore.Get(ctx, "user1", "client1")
+	if !grant.Active() || grant.Scope != "write" {
+		t.Fatalf("consent after revoke: %+v", grant)
+	}
+}
+
+func TestRevokeConsentInvalidatesTokens(t *testing.T) {
+	ctx := context.Background()
+	passwordToken := func(clientID, clientSecret, scope string) map[string]interface{} {
+		status, data := requestTestToken(t, clientID, clientSecret, url.Values{
+			"grant_type": {"password"},
+			"username":   {"consent_user"},
+			"password":   {"pass"},
+			"scope":      {scope},
+		})
+		if status != http.StatusOK {
+			t.Fatalf("password grant failed: %d %v", status, data)
+		}
+		return data
+	}
+	revoked := passwordToken("client1", "secret1", "read")
+	kept := passwordToken("client2", "secret2", "read")
+	if err := oauth.RevokeConsent(ctx, testConsents, "consent_user", "client1"); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := requestTestAPI(t, http.MethodGet, "/oauth2/read", revoked["access_token"].(string))
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("access token valid after consent revoked: %d", resp.StatusCode)
+	}
+	status, data := requestTestToken(t, "client1", "secret1", url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {revoked["refresh_token"].(string)},
+	})
+	if status == http.StatusOK {
+		t.Fatalf("refresh token valid after consent revoked: %v", data)
+	}
+	resp = requestTestAPI(t, http.MethodGet, "/oauth2/read", kept["access_token"].(string))
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("token of another client rejected: %d", resp.StatusCode)
+	}
+}
+
+func TestConsentRouteScope(t *testing.T) {
+	listConsents := func(accessToken string) int {
+		resp := requestTestAPI(t, http.MethodGet, "/oauth2/consents", accessToken)
+		defer resp.Body.Close()
+		var result httputil.CommResponse
+		_ = json.NewDecoder(resp.Body).Decode(&result)
+		return result.Code
+	}
+	tokenWithScope := func(scope string) string {
+		_, data := requestTestToken(t, "client2", "secret2", url.Values{
+			"grant_type": {"password"},
+			"username":   {"scope_user"},
+			"password":   {"pass"},
+			"scope":      {scope},
+		})
+		accessToken, _ := data["access_token"].(string)
+		return accessToken
+	}
+	//普通客户端的token不能查看用户的授权
+	if code := listConsents(tokenWithScope("read")); code != http.StatusForbidden {
+		t.Fatalf("consents listed without the consents scope: %d", code)
+	}
+	if code := listConsents(tokenWithScope("read consents")); code != 0 && code != http.StatusOK {
+		t.Fatalf("consents not listed with the consents scope: %d", code)
+	}
+}
@@ -0,0 +1,177 @@
+package oauth
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/buntdb"
+)
+
+// driverBuntdb TokenStoreConnect.DriverName() 为该值时使用本地文件存储，DatasourceName() 为文件路径
+const driverBuntdb = "buntdb"
+
+// 写入磁盘的方式
+const (
+	FileSyncAlways      = "always"      //每次写入都同步到磁盘，掉电也不会丢失数据
+	FileSyncEverySecond = "everysecond" //每秒同步一次，默认方式
+	FileSyncNever       = "never"       //由操作系统决定
+)
+
+// FileStoreOption 本地文件存储的配置，适合无法部署redis和mysql的单机环境，
+// 也可以通过TokenStoreConnect.Extend设置，对应的key为 syncPolicy、autoShrinkPercentage、autoShrinkMinSize
+type FileStoreOption struct {
+	Path                 string //文件路径，为空时使用TokenStoreConnect.DatasourceName()
+	SyncPolicy           string //写入磁盘的方式，默认为everysecond
+	AutoShrinkPercentage int    //文件比上次压缩后增长超过该百分比时自动压缩，默认100
+	AutoShrinkMinSize    int    //文件超过该大小才会自动压缩，默认32MB
+}
+
+// getFileStoreOption 合并GinOauthOption.FileStoreOption和Extend中的配置，FileStoreOption优先
+func getFileStoreOption(oauthConfig *GinOauthOption) *FileStoreOption {
+	opt := &FileStoreOption{}
+	if oauthConfig.FileStoreOption != nil {
+		*opt = *oauthConfig.FileStoreOption
+	}
+	var extend func(key string) (interface{}, bool)
+	if oauthConfig.TokenStoreConnect != nil {
+		extend = oauthConfig.TokenStoreConnect.Extend
+		if opt.Path == "" {
+			opt.Path = oauthConfig.TokenStoreConnect.DatasourceName()
+		}
+	}
+	if opt.SyncPolicy == "" {
+		opt.SyncPolicy = extendString(extend, "syncPolicy")
+	}
+	if opt.AutoShrinkPercentage <= 0 {
+		opt.AutoShrinkPercentage = extendInt(extend, "autoShrinkPercentage")
+	}
+	if opt.AutoShrinkMinSize <= 0 {
+		opt.AutoShrinkMinSize = extendInt(extend, "autoShrinkMinSize")
+	}
+	return opt
+}
+
+// NewFileTokenStore 基于buntdb的文件存储，token按过期时间自动删除，文件定期压缩，
+// 上次异常退出导致文件末尾不完整时会截断到最后一条完整的记录
+func NewFileTokenStore(opt *FileStoreOption) (*FileTokenStore, error) {
+	if opt == nil || opt.Path == "" {
+		return nil, fmt.Errorf("file token store: path is required")
+	}
+	db, err := buntdb.Open(opt.Path)
+	if err == io.ErrUnexpectedEOF {
+		if err = repairAppendOnlyFile(opt.Path); err != nil {
+			return nil, err
+		}
+		db, err = buntdb.Open(opt.Path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("file token store: %w", err)
+	}
+
+	var config buntdb.Config
+	if err = db.ReadConfig(&config); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	switch strings.ToLower(opt.SyncPolicy) {
+	case "", FileSyncEverySecond:
+		config.SyncPolicy = buntdb.EverySecond
+	case FileSyncAlways:
+		config.SyncPolicy = buntdb.Always
+	case FileSyncNever:
+		config.SyncPolicy = buntdb.Never
+	default:
+		_ = db.Close()
+		return nil, fmt.Errorf("file token store: unknown sync policy %q", opt.SyncPolicy)
+	}
+	if opt.AutoShrinkPercentage > 0 {
+		config.AutoShrinkPercentage = opt.AutoShrinkPercentage
+	}
+	if opt.AutoShrinkMinSize > 0 {
+		config.AutoShrinkMinSize = opt.AutoShrinkMinSize
+	}
+	if err = db.SetConfig(config); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &FileTokenStore{buntTokenStore: &buntTokenStore{db: db}}, nil
+}
+
+// FileTokenStore 本地文件存储，与内存存储的实现相同
+type FileTokenStore struct {
+	*buntTokenStore
+}
+
+// Shrink 立即压缩文件，去掉已经删除和过期的记录
+func (ts *FileTokenStore) Shrink() error {
+	return ts.db.Shrink()
+}
+
+// Close 关闭存储，退出前需要调用，保证数据写入磁盘
+func (ts *FileTokenStore) Close() error {
+	return ts.db.Close()
+}
+
+// repairAppendOnlyFile buntdb的文件由多条RESP格式的命令组成，
+// 写入过程中异常退出时最后一条命令不完整，截断到最后一条完整命令的末尾
+func repairAppendOnlyFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0666)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	rd := bufio.NewReader(f)
+	var valid int64
+	for {
+		n, err := readRespCommand(rd)
+		if err != nil {
+			break
+		}
+		valid += n
+	}
+	log.Println("file token store: truncate incomplete data", path, valid)
+	if err = f.Truncate(valid); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// readRespCommand 读取一条完整的命令，返回读取的字节数
+func readRespCommand(rd *bufio.Reader) (int64, error) {
+	var total int64
+	readLine := func(prefix byte) (int, error) {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return 0, err
+		}
+		total += int64(len(line))
+		if len(line) < 3 || line[0] != prefix || !strings.HasSuffix(line, "\r\n") {
+			return 0, fmt.Errorf("invalid line")
+		}
+		return strconv.Atoi(line[1 : len(line)-2])
+	}
+
+	argc, err := readLine('*')
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < argc; i++ {
+		size, err := readLine('$')
+		if err != nil {
+			return 0, err
+		}
+		if _, err = rd.Discard(size + 2); err != nil {
+			return 0, err
+		}
+		total += int64(size + 2)
+	}
+	return total, nil
+}
@@ -0,0 +1,56 @@
+package oauth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-oauth2/oauth2/v4/models"
+)
+
+func TestFileTokenStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token.db")
+	ctx := context.Background()
+
+	ts, err := NewFileTokenStore(&FileStoreOption{Path: path, SyncPolicy: FileSyncAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ts.Create(ctx, &models.Token{
+		ClientID:        "client1",
+		Access:          "access1",
+		AccessCreateAt:  time.Now(),
+		AccessExpiresIn: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ts.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	//模拟写入过程中异常退出
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString("*3\r\n$3\r\nset\r\n$5\r\nacc")
+	_ = f.Close()
+
+	ts, err = NewFileTokenStore(&FileStoreOption{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = ts.Close()
+	}()
+	ti, err := ts.GetByAccess(ctx, "access1")
+	if err != nil || ti == nil || ti.GetClientID() != "client1" {
+		t.Fatalf("token not restored: %v %v", ti, err)
+	}
+	if err = ts.Shrink(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,17 +2,17 @@ package oauth
 
 import (
 	"context"
-	"crypto/tls"
+	"database/sql"
 	"github.com/gin-gonic/gin"
-	mysql "github.com/go-oauth2/mysql/v4"
 	oauth2 "github.com/go-oauth2/oauth2/v4"
 	"github.com/go-oauth2/oauth2/v4/manage"
 	"github.com/go-oauth2/oauth2/v4/server"
-	"github.com/go-oauth2/oauth2/v4/store"
 	v4redis "github.com/go-oauth2/redis/v4"
 	redis "github.com/go-redis/redis/v8"
 	_ "github.com/go-sql-driver/mysql" //导入mysql驱动
 	"github.com/tianlin0/go-plat-oauth/oauth/ginserver"
+	"github.com/tianlin0/go-plat-oauth/oauth/httpserver"
+	"github.com/tianlin0/go-plat-oauth/oauth/scope"
 	"github.com/tianlin0/go-plat-startupcfg/startupcfg"
 	"github.com/tianlin0/go-plat-utils/conv"
 	"github.com/tianlin0/go-plat-utils/utils/httputil"
@@ -92,7 +92,7 @@ type GinOauthOption struct {
 	UserAuthorizationHandler     server.UserAuthorizationHandler     //获取用户的信息的接口 必传
 	PasswordAuthorizationHandler server.PasswordAuthorizationHandler //如果用用户密码登录的话，则需要验证用户的密码是否正确
 	TokenStoreConnect            startupcfg.Database                 //token存储在的连接，redis twemproxy 代理不支持multi会报错
-	//可以通过 Extend 包含 keyNamespace，useTLS 来设置redis的特殊配置
+	//可以通过 Extend 包含 keyNamespace，useTLS，redisMode 等来设置redis的特殊配置，见RedisOption
 	ClientAuthorizedHandler server.ClientAuthorizedHandler //是否允许该客户端使用authorization_code或 __implicit 功能，
 	// 如果不设置，则会使用ClientScopeHandler对scope范围进行判断
 	ClientScopeHandler           server.ClientScopeHandler                                  //客户端传进来的scope是否正确的判断
@@ -101,62 +101,178 @@ type GinOauthOption struct {
 	TokenManager                 *manage.Manager                                            //authorization management token的管理
 	TokenCreateHandler           func(ctx context.Context, tokenMap map[string]interface{}) //TokenCreateHandler token创建时后
 	TokenCreateNumber            int                                                        //TokenCreateNumber 一个账号生成的token数量
-	TokenVerifySkipper           func(*gin.Context) oauth2.TokenInfo                        //HandleTokenVerify read方法里验证token是否跳过检查
-	ErrorHandleFunc              ginserver.ErrorHandleFunc                                  //HandleTokenVerify 如果验证出错的话，怎么处理, 默认全局处理
+	TokenVerifySkipper           func(*gin.Context) oauth2.TokenInfo                        //Deprecated: 使用Authenticators，HandleTokenVerify read方法里验证token是否跳过检查
+	ErrorHandleFunc              ginserver.ErrorHandleFunc                                  //HandleTokenVerify 如果验证出错的话，怎么处理, 默认按RFC 6750 返回401/403
+	CommErrorResponse            bool                                                       //未设置ErrorHandleFunc时，验证出错以CommResponse的格式输出
 	DefaultAuthorizeCodeTokenCfg *manage.Config                                             //token过期时间的默认设置
 	DefaultPasswordTokenCfg      *manage.Config                                             //根据用户密码生成的用户的token过期时间默认设置
 	DefaultClientTokenCfg        *manage.Config                                             //设置Client过期时间和refreash，
 	// RefreshTokenExp，0表示不过期，IsGenerateRefresh 是否生成刷新token
 	ReadUserCallbackHandler func(ctx *gin.Context, token oauth2.TokenInfo) interface{} //read个人信息时，对个人信息进行特殊处理后输出
+	ConsentStore            ConsentStore                                               //用户授权记录存储，设置以后会记录并检查用户对客户端的授权
+	ConsentPromptHandler    ConsentPromptHandler                                       //未授权时展示授权确认页面，不设置则登录即视为同意
+	ConsentScope            string                                                     //查看和撤销授权记录需要的scope，默认为consents，只应允许第一方的账号客户端申请
+	SessionOption           *SessionOption                                             //浏览器单点登录会话，设置以后登录过的用户再次授权时无需重新登录
+	LogoutOption            *LogoutOption                                              //退出登录的配置，设置SessionOption以后生效
+	EnableRevocation        bool                                                       //开启批量撤销，使用和刷新token时检查撤销记录，退出登录时撤销token，设置RevocationStore时自动开启
+	RevocationStore         RevocationStore                                            //token撤销记录存储，为空时与token存储在同一个地方
+	AdminAuthHandler        gin.HandlerFunc                                            //管理接口的权限检查，设置以后才开放/oauth2/admin下的接口
+	TokenIndex              TokenIndex                                                 //按用户和客户端查询token的索引，为空时与token存储在同一个地方
+	RedisOption             *RedisOption                                               //redis的部署模式，哨兵或者集群，优先于Extend中的配置
+	StoreOption             *StoreOption                                               //token存储的健康检查、重连和降级，不设置时连接失败使用内存存储
+	MysqlOption             *MysqlOption                                               //mysql的表名、清理间隔、连接池和TLS，优先于Extend中的配置
+	PostgresOption          *PostgresOption                                            //postgres的表名、清理间隔和连接池，TLS在DSN中设置
+	FileStoreOption         *FileStoreOption                                           //本地文件存储的配置，DriverName为buntdb时使用
+	TokenCacheOption        *TokenCacheOption                                          //token查询的本地缓存，多个实例时通过redis通知删除
+	TokenHashOption         *TokenHashOption                                           //存储中只保存token的HMAC，不保存明文
+	TokenEncryptOption      *TokenEncryptOption                                        //加密存储和索引中token的用户、scope等信息
+	SecondaryTokenStore     oauth2.TokenStore                                          //存储迁移期间同时写入的存储，见NewDualWriteTokenStore
+	SecondaryTokenPurger    TokenPurger                                                //批量撤销时删除SecondaryTokenStore中的token，为空时SecondaryTokenStore需要实现TokenPurger
+	ScopeRegistry           *scope.Registry                                            //注册的scope，设置以后默认检查客户端、用户和刷新token的scope
+	ClientScopes            func(clientID string) []string                             //客户端可以申请的scope，设置ScopeRegistry以后生效，为空时不限制
+	UserScopes              func(userID string) []string                               //用户可以授权的scope，授权码和密码方式时检查，设置ScopeRegistry以后生效，为空时不限制
+	ClientResources         func(clientID string) []string                             //客户端可以申请的resource(RFC 8707)，设置以后接受resource参数，为空时带有resource的请求返回invalid_target
+	JWTAccessOption         *JWTAccessOption                                           //生成JWT格式的access token，并开放/oauth2/jwks，mysql和postgres存储需要同时设置TokenHashOption
+	IntrospectionClients    []string                                                   //可以通过/oauth2/introspect查询所有token的资源服务客户端，其他客户端只能查询自己的token
+	TokenExtractors         []httpserver.TokenExtractor                                //验证token时获取token的方式，按顺序使用，为空时从Authorization和access_token参数获取
+	Authenticators          []httpserver.Authenticator                                 //read等接口按顺序尝试的认证方式，需要包含httpserver.BearerAuthenticator，为空时只验证bearer token
+
+	//以下为NewHTTPOAuthServer使用的配置，对应上面gin的配置
+	HTTPTokenVerifySkipper      func(r *http.Request) oauth2.TokenInfo                    //Deprecated: 使用Authenticators，验证token时返回不为nil则跳过检查
+	HTTPErrorHandleFunc         httpserver.ErrorHandleFunc                                //验证出错时的处理，默认按RFC 6750 返回401/403
+	HTTPReadUserCallbackHandler func(r *http.Request, token oauth2.TokenInfo) interface{} //read个人信息时，对个人信息进行特殊处理后输出
 }
 
-func initGinOAuthServer(oauthConfig *GinOauthOption) *server.Server {
+// oauthStores token存储使用的连接，会话等记录也存储在同一个地方
+type oauthStores struct {
+	redisCli     redis.UniversalClient
+	keyNamespace string
+	mysqlDB      *sql.DB
+	mysqlOption  *MysqlOption
+	sessions     *sessionManager
+	revocations  RevocationStore
+	purger       TokenPurger
+	tokenStore   oauth2.TokenStore
+	tokenIndex   TokenIndex
+	tokenCipher  *tokenCipher
+	jwtAccess    *jwtAccessGenerate
+}
+
+func initGinOAuthServer(oauthConfig *GinOauthOption) (*server.Server, *oauthStores) {
 	manager := manage.NewDefaultManager()
 
 	if oauthConfig.TokenManager != nil {
 		manager = oauthConfig.TokenManager
 	}
 
-	isSetRedis := false
+	stores := &oauthStores{}
 
+	var err error
+	if oauthConfig.JWTAccessOption != nil && oauthConfig.TokenStoreConnect != nil {
+		if err = checkJWTAccessStore(oauthConfig.TokenStoreConnect.DriverName(), oauthConfig.TokenHashOption != nil); err != nil {
+			log.Println("jwt access option error:", err)
+			return nil, nil
+		}
+	}
 	if oauthConfig.TokenStoreConnect != nil {
 		if oauthConfig.TokenStoreConnect.DriverName() == string(startupcfg.DriverRedis) {
-			storeTemp, err := getStoreByRedis(oauthConfig)
-			if err == nil {
-				isSetRedis = true
-				manager.MapTokenStorage(storeTemp)
-			}
+			err = initRedisTokenStore(oauthConfig, stores)
 		} else if oauthConfig.TokenStoreConnect.DriverName() == string(startupcfg.DriverMysql) {
-			dsn := oauthConfig.TokenStoreConnect.DatasourceName()
-			mysqlStore := mysql.NewDefaultStore(
-				mysql.NewConfig(dsn),
-			)
-			isSetRedis = true
-			manager.MapTokenStorage(mysqlStore)
+			err = initMysqlTokenStore(oauthConfig, stores)
+		} else if oauthConfig.TokenStoreConnect.DriverName() == driverPostgres {
+			err = initPostgresTokenStore(oauthConfig, stores)
+		} else if oauthConfig.TokenStoreConnect.DriverName() == driverBuntdb {
+			var fileStore *FileTokenStore
+			if fileStore, err = NewFileTokenStore(getFileStoreOption(oauthConfig)); err == nil {
+				stores.purger = fileStore
+				stores.tokenStore = fileStore
+			} else {
+				log.Println("oauthConfig.Conn nil:文件存储打开失败", err)
+			}
 		}
 	}
+	if storeStartupFailed(oauthConfig.StoreOption, err) {
+		log.Println("token store startup error:", err)
+		return nil, nil
+	}
 
-	if !isSetRedis {
-		storyDefault, err := store.NewMemoryTokenStore()
+	if stores.tokenStore == nil {
+		storyDefault, err := newMemoryTokenStore()
 		if err != nil {
 			//log.Error(err)
-			return nil
+			return nil, nil
 		}
-		manager.MapTokenStorage(storyDefault)
+		stores.purger = storyDefault
+		stores.tokenStore = storyDefault
+	}
+
+	//迁移期间同时写入新旧两个存储
+	if oauthConfig.SecondaryTokenStore != nil {
+		stores.tokenStore = NewDualWriteTokenStore(stores.tokenStore, oauthConfig.SecondaryTokenStore)
+		stores.purger = newDualWriteTokenPurger(stores.purger, oauthConfig.SecondaryTokenStore, oauthConfig.SecondaryTokenPurger)
+	}
+
+	//加密以后本地缓存中仍然是明文，索引单独加密
+	if oauthConfig.TokenEncryptOption != nil {
+		tokenCipher, err := newTokenCipher(oauthConfig.TokenEncryptOption)
+		if err != nil {
+			log.Println("token encrypt option error:", err)
+			return nil, nil
+		}
+		stores.tokenCipher = tokenCipher
+		stores.tokenStore = &encryptedTokenStore{TokenStore: stores.tokenStore, cipher: tokenCipher}
+		if stores.purger != nil {
+			stores.purger = &encryptedTokenPurger{TokenPurger: stores.purger, cipher: tokenCipher}
+		}
+	}
+
+	//本地缓存，批量撤销的token由撤销记录检查，不依赖缓存的删除
+	if oauthConfig.TokenCacheOption != nil {
+		stores.tokenStore = newCachedTokenStore(stores.tokenStore, oauthConfig.TokenCacheOption, stores.redisCli, stores.keyNamespace)
 	}
 
+	//生成token时同时写入用户和客户端的索引
+	stores.tokenIndex = getTokenIndex(oauthConfig, stores)
+	if stores.tokenCipher != nil {
+		stores.tokenIndex = &encryptedTokenIndex{TokenIndex: stores.tokenIndex, cipher: stores.tokenCipher}
+	}
+	var tokenStore oauth2.TokenStore = &indexedTokenStore{TokenStore: stores.tokenStore, index: stores.tokenIndex}
+	//索引和存储中都只有HMAC，索引查询token时直接使用HMAC
+	if oauthConfig.TokenHashOption != nil {
+		tokenStore = newHashedTokenStore(tokenStore, oauthConfig.TokenHashOption)
+	}
+	manager.MapTokenStorage(tokenStore)
+
 	//用户列表的查询方式
 	manager.MapClientStorage(oauthConfig.ClientStore)
 
-	return initServers(manager, oauthConfig)
+	if oauthConfig.JWTAccessOption != nil {
+		stores.jwtAccess, err = newJWTAccessGenerate(oauthConfig.JWTAccessOption)
+		if err != nil {
+			log.Println("jwt access option error:", err)
+			return nil, nil
+		}
+		manager.MapAccessGenerate(stores.jwtAccess)
+	}
+
+	//批量撤销需要显式开启，开启以后每次使用和刷新token都会查询撤销记录
+	defaultTokenRevoker = nil
+	if oauthConfig.EnableRevocation || oauthConfig.RevocationStore != nil {
+		stores.revocations = getRevocationStore(oauthConfig, stores)
+		defaultTokenRevoker = NewTokenRevoker(stores.revocations, stores.purger)
+	} else if oauthConfig.SessionOption != nil {
+		log.Println("logout is enabled without EnableRevocation or RevocationStore: " +
+			"tokens issued through a session stay valid after logout until they expire")
+	}
+
+	return initServers(manager, oauthConfig, stores), stores
 }
 
-func getStoreByRedis(oauthConfig *GinOauthOption) (*v4redis.TokenStore, error) {
+func getRedisClient(oauthConfig *GinOauthOption) (redis.UniversalClient, string, error) {
 	db, _ := conv.Int64(oauthConfig.TokenStoreConnect.DatabaseName())
 	dbInt := int(db)
 
 	redisOpts := &redis.Options{
-		Addr:     oauthConfig.TokenStoreConnect.ServerAddress(),
 		Password: oauthConfig.TokenStoreConnect.Password(),
 		DB:       dbInt,
 	}
@@ -165,62 +281,182 @@ func getStoreByRedis(oauthConfig *GinOauthOption) (*v4redis.TokenStore, error) {
 		redisOpts.Username = oauthConfig.TokenStoreConnect.User()
 	}
 
-	if oauthConfig.TokenStoreConnect.Extend != nil {
-		if useTLS, ok := oauthConfig.TokenStoreConnect.Extend("useTLS"); ok {
-			if useTLSBool, ok := useTLS.(bool); ok {
-				if useTLSBool {
-					var tlsConfig = &tls.Config{InsecureSkipVerify: false}
-					tlsConfig.MinVersion = tls.VersionTLS12
-					redisOpts.TLSConfig = tlsConfig
-				}
-			}
+	redisOption := getRedisOption(oauthConfig)
+	keyNamespace := redisOption.keyNamespace()
+
+	tlsConfig, err := redisOption.TLS.tlsConfig()
+	if err != nil {
+		log.Println("oauthConfig.Conn nil:redis TLS配置错误", err)
+		return nil, "", err
+	}
+	redisOpts.TLSConfig = tlsConfig
+
+	reClient, err := newRedisClient(redisOption, redisOpts)
+	if err != nil {
+		log.Println("oauthConfig.Conn nil:redis配置错误", err)
+		return nil, "", err
+	}
+	return reClient, keyNamespace, nil
+}
+
+// initRedisTokenStore 连接redis，连接失败时关闭客户端
+func initRedisTokenStore(oauthConfig *GinOauthOption, stores *oauthStores) error {
+	reClient, keyNamespace, err := getRedisClient(oauthConfig)
+	if err != nil {
+		return err
+	}
+	tokenStore, err := connectTokenStore(oauthConfig.StoreOption, func(ctx context.Context) (oauth2.TokenStore, error) {
+		pong, err := reClient.Ping(ctx).Result()
+		log.Println("redis ping:", pong, err)
+		if err != nil {
+			return nil, err
 		}
+		// 处理分片的问题
+		return newRedisTokenStore(reClient, keyNamespace), nil
+	}, func(ctx context.Context) error {
+		return reClient.Ping(ctx).Err()
+	})
+	if err != nil {
+		//redis连接失败
+		log.Println("oauthConfig.Conn nil:redis连接失败", err)
+		_ = reClient.Close()
+		return err
 	}
+	stores.redisCli = reClient
+	stores.keyNamespace = keyNamespace
+	stores.purger = &redisTokenPurger{cli: reClient, ns: keyNamespace}
+	stores.tokenStore = tokenStore
+	return nil
+}
 
-	keyNamespace := "{default-oauth}" //默认值
-	if oauthConfig.TokenStoreConnect.Extend != nil {
-		if useKeyName, ok := oauthConfig.TokenStoreConnect.Extend("keyNameSpace"); ok {
-			if useKeyNameString, ok := useKeyName.(string); ok {
-				if useKeyNameString != "" {
-					keyNamespace = useKeyNameString
-				}
-			}
+// initMysqlTokenStore 连接mysql，连接失败时关闭连接
+func initMysqlTokenStore(oauthConfig *GinOauthOption, stores *oauthStores) error {
+	mysqlOption := getMysqlOption(oauthConfig)
+	db, err := getMysqlDB(oauthConfig, mysqlOption)
+	if err != nil {
+		return err
+	}
+	tokenStore, err := connectTokenStore(oauthConfig.StoreOption, func(ctx context.Context) (oauth2.TokenStore, error) {
+		if err := db.PingContext(ctx); err != nil {
+			return nil, err
 		}
+		ts, err := NewMysqlTokenStore(db, mysqlOption.TokenTable, mysqlOption.GCInterval)
+		if err != nil {
+			return nil, err
+		}
+		return ts.TokenStore, nil
+	}, db.PingContext)
+	if err != nil {
+		log.Println("oauthConfig.Conn nil:mysql连接失败", err)
+		_ = db.Close()
+		return err
 	}
+	stores.mysqlDB = db
+	stores.mysqlOption = mysqlOption
+	stores.purger = &mysqlTokenPurger{db: db, tableName: mysqlOption.TokenTable}
+	stores.tokenStore = tokenStore
+	return nil
+}
 
-	reClient := redis.NewClient(redisOpts)
-	pong, err := reClient.Ping(context.Background()).Result()
-	log.Println("redis ping:", pong, err)
-	if err == nil {
-		// 处理分片的问题
-		return v4redis.NewRedisStore(redisOpts, keyNamespace), nil
+// newRedisTokenStore 集群模式需要使用集群的存储方式
+func newRedisTokenStore(cli redis.UniversalClient, keyNamespace string) oauth2.TokenStore {
+	if clusterCli, ok := cli.(*redis.ClusterClient); ok {
+		return v4redis.NewRedisClusterStoreWithCli(clusterCli, keyNamespace)
+	}
+	return v4redis.NewRedisStoreWithCli(cli.(*redis.Client), keyNamespace)
+}
+
+// initPostgresTokenStore 连接postgres，会话、撤销记录和token索引没有postgres的实现，仍然使用内存存储
+func initPostgresTokenStore(oauthConfig *GinOauthOption, stores *oauthStores) error {
+	postgresOption, err := getPostgresOption(oauthConfig)
+	if err != nil {
+		log.Println("oauthConfig.Conn nil:postgres配置错误", err)
+		return err
+	}
+	log.Println("postgres: sessions, revocations and token index are kept in memory and not shared between instances")
+	db, err := sql.Open(driverPostgres, oauthConfig.TokenStoreConnect.DatasourceName())
+	if err != nil {
+		log.Println("oauthConfig.Conn nil:postgres连接失败", err)
+		return err
 	}
+	postgresOption.setConnPool(db)
 
-	//redis连接失败
-	log.Println("oauthConfig.Conn nil:redis连接失败", err)
+	var postgresStore *PostgresTokenStore
+	tokenStore, err := connectTokenStore(oauthConfig.StoreOption, func(ctx context.Context) (oauth2.TokenStore, error) {
+		if err := db.PingContext(ctx); err != nil {
+			return nil, err
+		}
+		ts, err := NewPostgresTokenStore(db, postgresOption.TokenTable, postgresOption.GCInterval)
+		if err != nil {
+			return nil, err
+		}
+		postgresStore = ts
+		return ts, nil
+	}, db.PingContext)
+	if err != nil {
+		log.Println("oauthConfig.Conn nil:postgres连接失败", err)
+		_ = db.Close()
+		return err
+	}
+	if postgresStore != nil {
+		stores.purger = postgresStore
+	}
+	stores.tokenStore = tokenStore
+	return nil
+}
 
-	return nil, err
+func getMysqlDB(oauthConfig *GinOauthOption, mysqlOption *MysqlOption) (*sql.DB, error) {
+	mysqlConfig, err := mysqlOption.mysqlConfig(oauthConfig.TokenStoreConnect.DatasourceName())
+	if err != nil {
+		log.Println("oauthConfig.Conn nil:mysql配置错误", err)
+		return nil, err
+	}
+	db, err := sql.Open("mysql", mysqlConfig.DSN)
+	if err != nil {
+		log.Println("oauthConfig.Conn nil:mysql连接失败", err)
+		return nil, err
+	}
+	mysqlOption.setConnPool(db)
+	return db, nil
 }
 
-func initServers(manager *manage.Manager, oauthConfig *GinOauthOption) *server.Server {
+func initServers(manager *manage.Manager, oauthConfig *GinOauthOption, stores *oauthStores) *server.Server {
 	// Initialize the oauth2 service
 	servers := ginserver.InitServer(manager)
 	ginserver.SetAllowGetAccessRequest(true)
-	ginserver.SetClientInfoHandler(server.ClientFormHandler)
-	ginserver.SetUserAuthorizationHandler(oauthConfig.UserAuthorizationHandler)
+	ginserver.SetClientInfoHandler(httpserver.ClientBasicOrFormHandler)
+	ginserver.SetUserAuthorizationHandler(getUserAuthorizationHandler(oauthConfig, stores))
+	setTokenValidations(getTokenValidations(oauthConfig, stores)...)
 	ginserver.SetPasswordAuthorizationHandler(oauthConfig.PasswordAuthorizationHandler)
+	if oauthConfig.ScopeRegistry != nil {
+		//注册了scope时使用默认的判断，设置了ClientScopeHandler等时以设置的为准
+		ginserver.SetScopeRegistry(oauthConfig.ScopeRegistry)
+		ginserver.SetClientScopeHandler(ScopeClientHandler(oauthConfig.ScopeRegistry, oauthConfig.ClientScopes, oauthConfig.UserScopes))
+		ginserver.SetAuthorizeScopeHandler(ScopeAuthorizeHandler(oauthConfig.ScopeRegistry))
+		ginserver.SetRefreshingScopeHandler(ScopeRefreshingHandler(oauthConfig.ScopeRegistry))
+	}
 	if oauthConfig.ClientScopeHandler != nil {
 		ginserver.SetClientScopeHandler(oauthConfig.ClientScopeHandler)
 	}
 	if oauthConfig.AuthorizeScopeHandler != nil {
 		ginserver.SetAuthorizeScopeHandler(oauthConfig.AuthorizeScopeHandler)
 	}
+	//RFC 8707 resource参数，在原来的scope检查之后执行，未设置ClientResources时拒绝所有resource，
+	//防止客户端直接在scope中带上resource:绕过audience的检查
+	clientResources := oauthConfig.ClientResources
+	if clientResources == nil {
+		clientResources = func(string) []string { return nil }
+	}
+	servers.ClientScopeHandler = audienceClientScopeHandler(servers.ClientScopeHandler, clientResources)
+	servers.RefreshingScopeHandler = audienceRefreshingScopeHandler(servers.RefreshingScopeHandler, clientResources)
+	//通过单点登录会话授权的token在scope中记录会话，放在最后，前面的检查不会看到会话
+	servers.ClientScopeHandler = sessionClientScopeHandler(servers.ClientScopeHandler)
+	servers.RefreshingScopeHandler = sessionRefreshingScopeHandler(servers.RefreshingScopeHandler)
 	if oauthConfig.ExtensionFieldsHandler != nil {
 		ginserver.SetExtensionFieldsHandler(oauthConfig.ExtensionFieldsHandler)
 	}
-	if oauthConfig.ErrorHandleFunc != nil {
-		ginserver.DefaultConfig.ErrorHandleFunc = oauthConfig.ErrorHandleFunc
-	}
+	ginserver.SetIntrospectionClients(getIntrospectionClients(oauthConfig.IntrospectionClients))
+	ginserver.DefaultConfig.ErrorHandleFunc = getErrorHandleFunc(oauthConfig)
 	if oauthConfig.DefaultAuthorizeCodeTokenCfg != nil {
 		manage.DefaultAuthorizeCodeTokenCfg = oauthConfig.DefaultAuthorizeCodeTokenCfg
 	}
@@ -235,37 +471,46 @@ func initServers(manager *manage.Manager, oauthConfig *GinOauthOption) *server.S
 	}
 
 	{ //对过期时间进行批量处理，不能为永久，解决redis内存不断高升的问题
-		if manage.DefaultAuthorizeCodeTokenCfg.AccessTokenExp > ginserver.DefaultCacheAccessTokenMaxExpiresIn ||
+		if manage.DefaultAuthorizeCodeTokenCfg.AccessTokenExp > httpserver.DefaultCacheAccessTokenMaxExpiresIn ||
 			manage.DefaultAuthorizeCodeTokenCfg.AccessTokenExp == 0 {
-			manage.DefaultAuthorizeCodeTokenCfg.AccessTokenExp = ginserver.DefaultCacheAccessTokenMaxExpiresIn
+			manage.DefaultAuthorizeCodeTokenCfg.AccessTokenExp = httpserver.DefaultCacheAccessTokenMaxExpiresIn
 		}
-		if manage.DefaultAuthorizeCodeTokenCfg.RefreshTokenExp > ginserver.DefaultCacheAccessTokenMaxExpiresIn ||
+		if manage.DefaultAuthorizeCodeTokenCfg.RefreshTokenExp > httpserver.DefaultCacheAccessTokenMaxExpiresIn ||
 			manage.DefaultAuthorizeCodeTokenCfg.RefreshTokenExp == 0 {
-			manage.DefaultAuthorizeCodeTokenCfg.RefreshTokenExp = ginserver.DefaultCacheAccessTokenMaxExpiresIn
+			manage.DefaultAuthorizeCodeTokenCfg.RefreshTokenExp = httpserver.DefaultCacheAccessTokenMaxExpiresIn
 		}
-		if manage.DefaultClientTokenCfg.AccessTokenExp > ginserver.DefaultCacheAccessTokenMaxExpiresIn ||
+		if manage.DefaultClientTokenCfg.AccessTokenExp > httpserver.DefaultCacheAccessTokenMaxExpiresIn ||
 			manage.DefaultClientTokenCfg.AccessTokenExp == 0 {
-			manage.DefaultClientTokenCfg.AccessTokenExp = ginserver.DefaultCacheAccessTokenMaxExpiresIn
+			manage.DefaultClientTokenCfg.AccessTokenExp = httpserver.DefaultCacheAccessTokenMaxExpiresIn
 		}
-		if manage.DefaultClientTokenCfg.RefreshTokenExp > ginserver.DefaultCacheAccessTokenMaxExpiresIn ||
+		if manage.DefaultClientTokenCfg.RefreshTokenExp > httpserver.DefaultCacheAccessTokenMaxExpiresIn ||
 			manage.DefaultClientTokenCfg.RefreshTokenExp == 0 {
-			manage.DefaultClientTokenCfg.RefreshTokenExp = ginserver.DefaultCacheAccessTokenMaxExpiresIn
+			manage.DefaultClientTokenCfg.RefreshTokenExp = httpserver.DefaultCacheAccessTokenMaxExpiresIn
 		}
 	}
 	return servers
 }
 
-// StartGinOAuthServer 启动一个gin框架的oauth服务
-func StartGinOAuthServer(oauthRoot *gin.RouterGroup, oauthConfig *GinOauthOption) bool {
+// startOAuthServer 检查配置并初始化oauth服务，gin和net/http共用，配置有误时返回nil
+func startOAuthServer(oauthConfig *GinOauthOption) *oauthStores {
 	if oauthConfig == nil {
-		return false
+		return nil
 	}
 	if oauthConfig.ClientStore == nil {
-		return false
+		return nil
 	}
 
-	serverTemp := initGinOAuthServer(oauthConfig)
+	serverTemp, stores := initGinOAuthServer(oauthConfig)
 	if serverTemp == nil {
+		return nil
+	}
+	return stores
+}
+
+// StartGinOAuthServer 启动一个gin框架的oauth服务
+func StartGinOAuthServer(oauthRoot *gin.RouterGroup, oauthConfig *GinOauthOption) bool {
+	stores := startOAuthServer(oauthConfig)
+	if stores == nil {
 		return false
 	}
 
@@ -273,10 +518,12 @@ func StartGinOAuthServer(oauthRoot *gin.RouterGroup, oauthConfig *GinOauthOption
 	{
 		auth.GET("/authorize", func(c *gin.Context) {
 			//logs.CtxLogger(c.Request.Context()).Debug("authorize get start:", c.Request.Header)
+			c.Request = withSessionBinding(c.Request)
 			ginserver.HandleAuthorizeRequest(c)
 		})
 		auth.POST("/authorize", func(c *gin.Context) {
 			//logs.CtxLogger(c.Request.Context()).Debug("authorize post start:", c.Request.Header)
+			c.Request = withSessionBinding(c.Request)
 			ginserver.HandleAuthorizeRequest(c)
 		}) //如果有内容比较多的情况时，不方便用GET
 
@@ -298,61 +545,197 @@ func StartGinOAuthServer(oauthRoot *gin.RouterGroup, oauthConfig *GinOauthOption
 			//loggers.Debug("token end", c.Writer)
 		}
 
-		//生成token的方法
+		//生成token的方法，POST时client_secret可以放在HTTP Basic认证中，GET只为兼容旧的调用方
 		auth.GET("/token", tokenHandle)
-		//auth.POST("/token", tokenHandle)
+		auth.POST("/token", tokenHandle)
 		//验证并获取登录用户信息
 		middleHandle := getMiddleTokenVerifyHandle(oauthConfig)
 
 		auth.GET("/read", middleHandle, func(c *gin.Context) {
+			//api key等其他认证方式没有用户的token
+			if p, ok := ginserver.GetPrincipal(c); ok && p.Method != httpserver.AuthMethodBearer {
+				writeReadResponse(c.Writer, nil)
+				return
+			}
 			ti, exists := c.Get(ginserver.DefaultConfig.TokenKey)
-			if exists {
-				resp := &httputil.CommResponse{
-					Data: ti,
-				}
-				if oauthConfig.ReadUserCallbackHandler != nil {
-					token, ok := ti.(oauth2.TokenInfo)
-					if ok {
-						tokenInfo := oauthConfig.ReadUserCallbackHandler(c, token)
-						resp.Data = tokenInfo
-					}
-				}
-				if resp.Data != nil {
-					_ = httputil.WriteCommResponse(c.Writer, resp)
-					return
+			if exists && oauthConfig.ReadUserCallbackHandler != nil {
+				if token, ok := ti.(oauth2.TokenInfo); ok {
+					ti = oauthConfig.ReadUserCallbackHandler(c, token)
 				}
 			}
-			_ = httputil.WriteCommResponse(c.Writer, &httputil.CommResponse{
-				Code:    http.StatusUnauthorized,
-				Message: http.StatusText(http.StatusUnauthorized),
-			})
+			writeReadResponse(c.Writer, ti)
 		})
+
+		//资源服务远程验证token(RFC 7662)，需要客户端认证
+		auth.POST("/introspect", ginserver.HandleIntrospectionRequest)
+		//资源服务本地验证JWT使用的公钥
+		if stores.jwtAccess != nil {
+			startJWKSRoute(auth, stores.jwtAccess)
+		}
+
+		//用户查看和撤销已授权的应用
+		if oauthConfig.ConsentStore != nil {
+			startConsentRoute(auth, oauthConfig, middleHandle)
+		}
+		//token存储的状态
+		if oauthConfig.StoreOption != nil {
+			startHealthRoute(auth)
+		}
+		//退出登录，结束单点登录会话
+		if stores.sessions != nil {
+			startLogoutRoute(auth, oauthConfig, stores)
+		}
+
+		//管理接口
+		if oauthConfig.AdminAuthHandler != nil {
+			admin := auth.Group("/admin", oauthConfig.AdminAuthHandler)
+			lister := &tokenLister{index: stores.tokenIndex}
+			if defaultTokenRevoker != nil {
+				startRevokeAdminRoute(admin, defaultTokenRevoker)
+				lister.validation = getRevocationValidation(stores.revocations)
+			}
+			startTokenAdminRoute(admin, lister)
+		}
 	}
 	return true
 }
 
-func getMiddleTokenVerifyHandle(oauthConfig *GinOauthOption) gin.HandlerFunc {
-	//验证并获取登录用户信息
-	middleHandle := ginserver.Config{}
-	if oauthConfig.ErrorHandleFunc != nil {
-		middleHandle.ErrorHandleFunc = oauthConfig.ErrorHandleFunc
-	} else {
-		// 默认的错误输出方式
-		middleHandle.ErrorHandleFunc = func(c *gin.Context, e error) {
-			//loggers := logs.CtxLogger(c.Request.Context())
+// getUserAuthorizationHandler 在用户的登录方法外面依次加上会话和授权记录的处理
+func getUserAuthorizationHandler(oauthConfig *GinOauthOption, stores *oauthStores) server.UserAuthorizationHandler {
+	handler := oauthConfig.UserAuthorizationHandler
+	if oauthConfig.SessionOption != nil {
+		stores.sessions = newSessionManager(oauthConfig.SessionOption, getSessionStore(oauthConfig.SessionOption, stores))
+		handler = getSessionUserAuthorizationHandler(stores.sessions, handler)
+	}
+	if oauthConfig.ConsentStore != nil {
+		handler = getConsentUserAuthorizationHandler(oauthConfig, handler)
+	}
+	return handler
+}
 
-			//loggers.Error("middleHandle.ErrorHandleFunc error:", e)
-			//loggers.Error(c.Request.Header, c.Request.RequestURI)
-			errMsg := http.StatusText(http.StatusUnauthorized)
-			if e != nil {
-				errMsg = e.Error()
-			}
-			_ = httputil.WriteCommResponse(c.Writer, &httputil.CommResponse{
-				Code:    http.StatusUnauthorized,
-				Message: errMsg,
-			})
-			c.Abort()
+// getTokenValidations 使用和刷新token时的检查，比如撤销授权和退出登录以后token失效
+func getTokenValidations(oauthConfig *GinOauthOption, stores *oauthStores) []tokenValidation {
+	validations := make([]tokenValidation, 0)
+	if stores.revocations != nil {
+		validations = append(validations, getRevocationValidation(stores.revocations))
+	}
+	if oauthConfig.ConsentStore != nil {
+		validations = append(validations, getConsentValidation(oauthConfig.ConsentStore))
+	}
+	return validations
+}
+
+// getRevocationStore 未指定撤销记录存储时，与token存储在同一个地方
+func getRevocationStore(oauthConfig *GinOauthOption, stores *oauthStores) RevocationStore {
+	if oauthConfig.RevocationStore != nil {
+		return oauthConfig.RevocationStore
+	}
+	if stores.redisCli != nil {
+		return NewRedisRevocationStore(stores.redisCli, stores.keyNamespace)
+	}
+	if stores.mysqlDB != nil {
+		revocationStore, err := newMysqlRevocationStore(stores.mysqlDB, stores.mysqlOption.RevocationTable,
+			stores.mysqlOption.GCInterval)
+		if err == nil {
+			return revocationStore
 		}
+		log.Println("mysql revocation store error:", err)
+	}
+	return NewMemoryRevocationStore()
+}
+
+// getTokenIndex 未指定token索引时，与token存储在同一个地方
+func getTokenIndex(oauthConfig *GinOauthOption, stores *oauthStores) TokenIndex {
+	if oauthConfig.TokenIndex != nil {
+		return oauthConfig.TokenIndex
+	}
+	if stores.redisCli != nil {
+		return NewRedisTokenIndex(stores.redisCli, stores.keyNamespace)
+	}
+	if stores.mysqlDB != nil {
+		tokenIndex, err := newMysqlTokenIndex(stores.mysqlDB, stores.mysqlOption.TokenIndexTable,
+			stores.mysqlOption.GCInterval)
+		if err == nil {
+			return tokenIndex
+		}
+		log.Println("mysql token index error:", err)
+	}
+	return NewMemoryTokenIndex()
+}
+
+// getSessionStore 未指定会话存储时，与token存储在同一个地方
+func getSessionStore(sessionOption *SessionOption, stores *oauthStores) SessionStore {
+	if sessionOption.Store != nil {
+		return sessionOption.Store
+	}
+	if stores.redisCli != nil {
+		return NewRedisSessionStore(stores.redisCli, stores.keyNamespace)
+	}
+	if stores.mysqlDB != nil {
+		sessionStore, err := newMysqlSessionStore(stores.mysqlDB, stores.mysqlOption.SessionTable,
+			stores.mysqlOption.GCInterval)
+		if err == nil {
+			return sessionStore
+		}
+		log.Println("mysql session store error:", err)
+	}
+	return NewMemorySessionStore()
+}
+
+// getErrorHandleFunc 验证token出错时的输出方式，默认按RFC 6750 输出
+func getErrorHandleFunc(oauthConfig *GinOauthOption) ginserver.ErrorHandleFunc {
+	if oauthConfig.ErrorHandleFunc != nil {
+		return oauthConfig.ErrorHandleFunc
+	}
+	if !oauthConfig.CommErrorResponse {
+		return ginserver.BearerErrorHandleFunc
+	}
+	return func(c *gin.Context, e error) {
+		writeCommError(c.Writer, c.Request, e)
+		c.Abort()
+	}
+}
+
+// writeCommError 验证token出错时以CommResponse的格式输出
+func writeCommError(w http.ResponseWriter, r *http.Request, e error) {
+	be := httpserver.GetBearerError(r, e)
+	_ = httputil.WriteCommResponse(w, &httputil.CommResponse{
+		Code:    be.Status,
+		Message: be.Error(),
+	})
+}
+
+// writeReadResponse 输出/oauth2/read的结果，没有token时返回401
+func writeReadResponse(w http.ResponseWriter, data interface{}) {
+	if data != nil {
+		_ = httputil.WriteCommResponse(w, &httputil.CommResponse{
+			Data: data,
+		})
+		return
+	}
+	_ = httputil.WriteCommResponse(w, &httputil.CommResponse{
+		Code:    http.StatusUnauthorized,
+		Message: http.StatusText(http.StatusUnauthorized),
+	})
+}
+
+// getIntrospectionClients 可以查询所有token的资源服务客户端
+func getIntrospectionClients(clientIDs []string) func(clientID string) bool {
+	allowed := make(map[string]bool, len(clientIDs))
+	for _, one := range clientIDs {
+		allowed[one] = true
+	}
+	return func(clientID string) bool {
+		return allowed[clientID]
+	}
+}
+
+func getMiddleTokenVerifyHandle(oauthConfig *GinOauthOption) gin.HandlerFunc {
+	//验证并获取登录用户信息
+	middleHandle := ginserver.Config{
+		ErrorHandleFunc: getErrorHandleFunc(oauthConfig),
+		Extractors:      oauthConfig.TokenExtractors,
+		Authenticators:  oauthConfig.Authenticators,
 	}
 
 	if oauthConfig.TokenVerifySkipper != nil {
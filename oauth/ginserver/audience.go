@@ -0,0 +1,21 @@
+package ginserver
+
+import (
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/tianlin0/go-plat-oauth/oauth/httpserver"
+)
+
+// SplitAudience 把scope拆分为普通的scope和audience
+func SplitAudience(scope string) (string, []string) {
+	return httpserver.SplitAudience(scope)
+}
+
+// WithAudience 把audience加入scope
+func WithAudience(scope string, audience []string) string {
+	return httpserver.WithAudience(scope, audience)
+}
+
+// TokenAudience token可以访问的resource，为空表示不限制
+func TokenAudience(ti oauth2.TokenInfo) []string {
+	return httpserver.TokenAudience(ti)
+}
@@ -0,0 +1,35 @@
+package ginserver
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/tianlin0/go-plat-oauth/oauth/httpserver"
+)
+
+type (
+	// Authenticator 认证请求，在Config.Authenticators中按顺序使用，见httpserver.Authenticator
+	Authenticator = httpserver.Authenticator
+	// Principal 认证通过的调用方
+	Principal = httpserver.Principal
+)
+
+// principalKey HandleTokenVerify认证通过以后保存调用方的key
+const principalKey = "github.com/tianlin0/go-plat-oauth/principal"
+
+// GetPrincipal 获取HandleTokenVerify认证通过的调用方，Method为认证方式
+func GetPrincipal(c *gin.Context) (*Principal, bool) {
+	if v, exists := c.Get(principalKey); exists {
+		if p, ok := v.(*Principal); ok && p != nil {
+			return p, true
+		}
+	}
+	return httpserver.PrincipalFromContext(c.Request.Context())
+}
+
+// setPrincipal 保存认证通过的调用方和对应的token，request的ctx中也保存一份，后面的net/http处理也可以获取
+func setPrincipal(c *gin.Context, tokenKey string, p *Principal) {
+	c.Set(tokenKey, p.TokenInfo)
+	c.Set(tokenInfoKey, p.TokenInfo)
+	c.Set(principalKey, p)
+	ctx := httpserver.WithTokenInfo(c.Request.Context(), p.TokenInfo)
+	c.Request = c.Request.WithContext(httpserver.WithPrincipal(ctx, p))
+}
@@ -0,0 +1,40 @@
+package ginserver
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tianlin0/go-plat-oauth/oauth/httpserver"
+)
+
+// ErrRevokedAccessToken token已经被撤销
+var ErrRevokedAccessToken = httpserver.ErrRevokedAccessToken
+
+// BearerError RFC 6750 中定义的错误
+type BearerError = httpserver.BearerError
+
+// SetBearerRealm 设置WWW-Authenticate中的realm
+func SetBearerRealm(realm string) {
+	httpserver.SetBearerRealm(realm)
+}
+
+// InsufficientScopeError token缺少需要的scope
+func InsufficientScopeError(scopes ...string) *BearerError {
+	return httpserver.InsufficientScopeError(scopes...)
+}
+
+// GetBearerError 把验证token时的错误转换为RFC 6750 中的错误，不是token的问题时返回500
+func GetBearerError(c *gin.Context, err error) *BearerError {
+	return httpserver.GetBearerError(c.Request, err)
+}
+
+// BearerToken 获取请求中的token，设置了Config.Extractors时使用获取到的token，否则与httpserver.BearerToken相同
+func BearerToken(r *http.Request) (string, bool) {
+	return httpserver.BearerToken(r)
+}
+
+// BearerErrorHandleFunc 按RFC 6750 输出错误，401和403时带有WWW-Authenticate
+func BearerErrorHandleFunc(c *gin.Context, err error) {
+	httpserver.BearerErrorHandleFunc(c.Writer, c.Request, err)
+	c.Abort()
+}
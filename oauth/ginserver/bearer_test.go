@@ -0,0 +1,38 @@
+package ginserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-oauth2/oauth2/v4/manage"
+	"github.com/go-oauth2/oauth2/v4/store"
+)
+
+func TestBearerErrorHandleFunc(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	manager := manage.NewDefaultManager()
+	manager.MustTokenStorage(store.NewMemoryTokenStore())
+	InitServer(manager)
+	SetBearerRealm("api")
+
+	r := gin.New()
+	r.GET("/", HandleTokenVerify(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	for token, header := range map[string]string{
+		"":        `Bearer realm="api"`,
+		"unknown": `Bearer realm="api", error="invalid_token", error_description="the access token is invalid"`,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != header {
+			t.Fatalf("%q: unexpected response %d %q", token, w.Code, w.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
@@ -3,79 +3,101 @@ package ginserver
 import (
 	"github.com/go-oauth2/oauth2/v4"
 	"github.com/go-oauth2/oauth2/v4/server"
+	"github.com/tianlin0/go-plat-oauth/oauth/httpserver"
+	"github.com/tianlin0/go-plat-oauth/oauth/scope"
 )
 
 // SetTokenType token type
 func SetTokenType(tokenType string) {
-	oauthServer.Config.TokenType = tokenType
+	httpserver.SetTokenType(tokenType)
 }
 
 // SetAllowGetAccessRequest to allow GET requests for the token
 func SetAllowGetAccessRequest(allow bool) {
-	oauthServer.Config.AllowGetAccessRequest = allow
+	httpserver.SetAllowGetAccessRequest(allow)
 }
 
 // SetAllowedResponseType allow the authorization types
 func SetAllowedResponseType(types ...oauth2.ResponseType) {
-	oauthServer.Config.AllowedResponseTypes = types
+	httpserver.SetAllowedResponseType(types...)
 }
 
 // SetAllowedGrantType allow the grant types
 func SetAllowedGrantType(types ...oauth2.GrantType) {
-	oauthServer.Config.AllowedGrantTypes = types
+	httpserver.SetAllowedGrantType(types...)
 }
 
 // SetClientInfoHandler get client info from request
 func SetClientInfoHandler(handler server.ClientInfoHandler) {
-	oauthServer.ClientInfoHandler = handler
+	httpserver.SetClientInfoHandler(handler)
 }
 
 // SetClientAuthorizedHandler check the client allows to use this authorization grant type
 func SetClientAuthorizedHandler(handler server.ClientAuthorizedHandler) {
-	oauthServer.ClientAuthorizedHandler = handler
+	httpserver.SetClientAuthorizedHandler(handler)
 }
 
 // SetClientScopeHandler check the client allows to use scope
 func SetClientScopeHandler(handler server.ClientScopeHandler) {
-	oauthServer.ClientScopeHandler = handler
+	httpserver.SetClientScopeHandler(handler)
 }
 
 // SetUserAuthorizationHandler get user id from request authorization
 func SetUserAuthorizationHandler(handler server.UserAuthorizationHandler) {
-	oauthServer.UserAuthorizationHandler = handler
+	httpserver.SetUserAuthorizationHandler(handler)
 }
 
 // SetPasswordAuthorizationHandler get user id from username and password
 func SetPasswordAuthorizationHandler(handler server.PasswordAuthorizationHandler) {
-	oauthServer.PasswordAuthorizationHandler = handler
+	httpserver.SetPasswordAuthorizationHandler(handler)
 }
 
 // SetRefreshingScopeHandler check the scope of the refreshing token
 func SetRefreshingScopeHandler(handler server.RefreshingScopeHandler) {
-	oauthServer.RefreshingScopeHandler = handler
+	httpserver.SetRefreshingScopeHandler(handler)
+}
+
+// SetRefreshingValidationHandler check if refresh_token is still valid
+func SetRefreshingValidationHandler(handler server.RefreshingValidationHandler) {
+	httpserver.SetRefreshingValidationHandler(handler)
+}
+
+// SetAccessValidationHandler check if access_token is still valid when verifying it
+func SetAccessValidationHandler(handler AccessValidationHandler) {
+	httpserver.SetAccessValidationHandler(handler)
 }
 
 // SetResponseErrorHandler response error handling
 func SetResponseErrorHandler(handler server.ResponseErrorHandler) {
-	oauthServer.ResponseErrorHandler = handler
+	httpserver.SetResponseErrorHandler(handler)
 }
 
 // SetInternalErrorHandler internal error handling
 func SetInternalErrorHandler(handler server.InternalErrorHandler) {
-	oauthServer.InternalErrorHandler = handler
+	httpserver.SetInternalErrorHandler(handler)
 }
 
 // SetExtensionFieldsHandler in response to the access token with the extension of the field
 func SetExtensionFieldsHandler(handler server.ExtensionFieldsHandler) {
-	oauthServer.ExtensionFieldsHandler = handler
+	httpserver.SetExtensionFieldsHandler(handler)
 }
 
 // SetAccessTokenExpHandler set expiration date for the access token
 func SetAccessTokenExpHandler(handler server.AccessTokenExpHandler) {
-	oauthServer.AccessTokenExpHandler = handler
+	httpserver.SetAccessTokenExpHandler(handler)
 }
 
 // SetAuthorizeScopeHandler set scope for the access token
 func SetAuthorizeScopeHandler(handler server.AuthorizeScopeHandler) {
-	oauthServer.AuthorizeScopeHandler = handler
+	httpserver.SetAuthorizeScopeHandler(handler)
+}
+
+// SetScopeRegistry RequireScopes、RequireAnyScope 按注册的包含关系和通配符判断scope
+func SetScopeRegistry(registry *scope.Registry) {
+	httpserver.SetScopeRegistry(registry)
+}
+
+// SetIntrospectionClients 设置可以通过introspection查询其他客户端token的资源服务客户端
+func SetIntrospectionClients(allowed func(clientID string) bool) {
+	httpserver.SetIntrospectionClients(allowed)
 }
@@ -0,0 +1,21 @@
+package ginserver
+
+import "github.com/tianlin0/go-plat-oauth/oauth/httpserver"
+
+// TokenExtractor 从请求中获取token，在Config.Extractors中按顺序使用
+type TokenExtractor = httpserver.TokenExtractor
+
+// HeaderExtractor 从Authorization: Bearer中获取
+func HeaderExtractor() TokenExtractor {
+	return httpserver.HeaderExtractor()
+}
+
+// CookieExtractor 从cookie中获取，例如浏览器中HttpOnly的cookie
+func CookieExtractor(name string) TokenExtractor {
+	return httpserver.CookieExtractor(name)
+}
+
+// QueryExtractor 从url参数中获取，例如websocket，只接受GET和HEAD请求
+func QueryExtractor(name string) TokenExtractor {
+	return httpserver.QueryExtractor(name)
+}
@@ -0,0 +1,22 @@
+package ginserver
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/tianlin0/go-plat-oauth/oauth/httpserver"
+)
+
+// IntrospectionResponse RFC 7662 的返回结果，token无效时只有active为false
+type IntrospectionResponse = httpserver.IntrospectionResponse
+
+// NewIntrospectionResponse 根据token生成返回结果
+func NewIntrospectionResponse(ti oauth2.TokenInfo) *IntrospectionResponse {
+	return httpserver.NewIntrospectionResponse(ti)
+}
+
+// HandleIntrospectionRequest RFC 7662 token查询，调用方需要使用客户端的id和密钥认证，
+// token不存在、已过期、已撤销或者调用方不能查询时返回active为false
+func HandleIntrospectionRequest(c *gin.Context) {
+	httpserver.HandleIntrospectionRequest(c.Writer, c.Request)
+	c.Abort()
+}
@@ -2,6 +2,8 @@ package ginserver
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/tianlin0/go-plat-oauth/oauth/httpserver"
 )
 
 type (
@@ -16,24 +18,37 @@ type (
 		// defines a function to skip middleware.Returning true skips processing
 		// the middleware.
 		Skipper func(*gin.Context) bool
+		// 当前服务的resource，设置以后只接受audience中包含其中一个的token
+		Audience []string
+		// 按顺序获取token，不同的路由可以使用不同的顺序，为空时从Authorization和access_token参数获取
+		Extractors []TokenExtractor
+		// 按顺序尝试的认证方式，例如httpserver.BearerAuthenticator、httpserver.APIKeyAuthenticator，
+		// 设置以后不使用VerifyFunc，认证通过的调用方通过GetPrincipal获取，Audience只检查bearer token
+		Authenticators []Authenticator
 	}
 )
 
 var (
 	// DefaultConfig is the default middleware config.
 	DefaultConfig = Config{
-		ErrorHandleFunc: func(ctx *gin.Context, err error) {
-			_ = ctx.AbortWithError(500, err)
-		},
-		TokenKey: "github.com/go-oauth2/gin-server/access-token",
+		ErrorHandleFunc: BearerErrorHandleFunc,
+		TokenKey:        "github.com/go-oauth2/gin-server/access-token",
 		Skipper: func(_ *gin.Context) bool {
 			return false
 		},
 	}
 )
 
+// VerifyFunc 验证请求中的token
+type VerifyFunc func(c *gin.Context) (oauth2.TokenInfo, error)
+
 // HandleTokenVerify Verify the access token of the middleware
 func HandleTokenVerify(config ...Config) gin.HandlerFunc {
+	return HandleTokenVerifyWith(verifyToken, config...)
+}
+
+// HandleTokenVerifyWith 使用其他的验证方式，例如在独立的资源服务中访问授权服务验证，其他处理与HandleTokenVerify相同
+func HandleTokenVerifyWith(verify VerifyFunc, config ...Config) gin.HandlerFunc {
 	cfg := DefaultConfig
 	if len(config) > 0 {
 		cfg = config[0]
@@ -53,13 +68,43 @@ func HandleTokenVerify(config ...Config) gin.HandlerFunc {
 			c.Next()
 			return
 		}
-		ti, err := oauthServer.ValidationBearerToken(c.Request)
+		c.Request = httpserver.WithTokenExtractors(c.Request, cfg.Extractors...)
+		p, err := authenticate(c, verify, cfg)
 		if err != nil {
 			cfg.ErrorHandleFunc(c, err)
 			return
 		}
 
-		c.Set(tokenKey, ti)
+		setPrincipal(c, tokenKey, p)
 		c.Next()
 	}
 }
+
+// authenticate 设置了Authenticators时按顺序认证，否则使用verify验证bearer token
+func authenticate(c *gin.Context, verify VerifyFunc, cfg Config) (*Principal, error) {
+	if len(cfg.Authenticators) > 0 {
+		p, err := httpserver.Authenticate(c.Request, cfg.Authenticators...)
+		if err != nil {
+			return nil, err
+		}
+		if p.Method == httpserver.AuthMethodBearer {
+			if err = httpserver.CheckAudience(p.TokenInfo, cfg.Audience); err != nil {
+				return nil, err
+			}
+		}
+		return p, nil
+	}
+	ti, err := verify(c)
+	if err == nil {
+		err = httpserver.CheckAudience(ti, cfg.Audience)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return httpserver.NewBearerPrincipal(ti), nil
+}
+
+// verifyToken 验证请求中的bearer token，并检查是否已被撤销
+func verifyToken(c *gin.Context) (oauth2.TokenInfo, error) {
+	return httpserver.VerifyRequest(c.Request)
+}
@@ -0,0 +1,66 @@
+package ginserver
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/tianlin0/go-plat-oauth/oauth/httpserver"
+)
+
+// tokenInfoKey HandleTokenVerify验证通过以后，无论Config.TokenKey是什么，都会以该key保存token
+const tokenInfoKey = "github.com/tianlin0/go-plat-oauth/token-info"
+
+// GetTokenInfo 获取HandleTokenVerify验证通过的token
+func GetTokenInfo(c *gin.Context) (oauth2.TokenInfo, bool) {
+	for _, key := range []string{tokenInfoKey, DefaultConfig.TokenKey} {
+		if v, exists := c.Get(key); exists {
+			if ti, ok := v.(oauth2.TokenInfo); ok && ti != nil {
+				return ti, true
+			}
+		}
+	}
+	return httpserver.TokenInfoFromContext(c.Request.Context())
+}
+
+// TokenScopes token的scope列表，不包含audience
+func TokenScopes(ti oauth2.TokenInfo) []string {
+	return httpserver.TokenScopes(ti)
+}
+
+// HasScope token是否包含某个scope，设置SetScopeRegistry以后按注册的包含关系和通配符判断
+func HasScope(ti oauth2.TokenInfo, scope string) bool {
+	return httpserver.HasScope(ti, scope)
+}
+
+// RequireScopes token必须包含所有的scope，前面没有HandleTokenVerify时会先验证token
+func RequireScopes(all ...string) gin.HandlerFunc {
+	return requireScopes(all, func(ti oauth2.TokenInfo) bool {
+		return httpserver.HasAllScopes(ti, all...)
+	})
+}
+
+// RequireAnyScope token至少包含其中一个scope，前面没有HandleTokenVerify时会先验证token
+func RequireAnyScope(any ...string) gin.HandlerFunc {
+	return requireScopes(any, func(ti oauth2.TokenInfo) bool {
+		return httpserver.HasAnyScope(ti, any...)
+	})
+}
+
+func requireScopes(scopes []string, allowed func(ti oauth2.TokenInfo) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ti, ok := GetTokenInfo(c)
+		if !ok {
+			var err error
+			c.Request = httpserver.WithTokenExtractors(c.Request, DefaultConfig.Extractors...)
+			if ti, err = verifyToken(c); err != nil {
+				DefaultConfig.ErrorHandleFunc(c, err)
+				return
+			}
+			setPrincipal(c, DefaultConfig.TokenKey, httpserver.NewBearerPrincipal(ti))
+		}
+		if !allowed(ti) {
+			DefaultConfig.ErrorHandleFunc(c, InsufficientScopeError(scopes...))
+			return
+		}
+		c.Next()
+	}
+}
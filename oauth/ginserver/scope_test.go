@@ -0,0 +1,36 @@
+package ginserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-oauth2/oauth2/v4/models"
+)
+
+func TestRequireScopes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(DefaultConfig.TokenKey, &models.Token{ClientID: "client1", Scope: "read profile"})
+	})
+	ok := func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	}
+	r.GET("/all", RequireScopes("read", "profile"), ok)
+	r.GET("/write", RequireScopes("read", "write"), ok)
+	r.GET("/any", RequireAnyScope("write", "profile"), ok)
+
+	for path, status := range map[string]int{"/all": http.StatusOK, "/write": http.StatusForbidden, "/any": http.StatusOK} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != status {
+			t.Fatalf("%s: unexpected status %d", path, w.Code)
+		}
+		if status == http.StatusForbidden && !strings.Contains(w.Header().Get("WWW-Authenticate"), `error="insufficient_scope"`) {
+			t.Fatalf("%s: unexpected header %q", path, w.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
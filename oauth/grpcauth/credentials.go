@@ -0,0 +1,116 @@
+package grpcauth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TokenSource 客户端获取access token
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// TokenFetchFunc 向授权服务申请token，返回token和有效期，例如使用client_credentials
+type TokenFetchFunc func(ctx context.Context) (token string, expiresIn time.Duration, err error)
+
+// RefreshingTokenSource 缓存申请到的token，过期前自动重新申请
+type RefreshingTokenSource struct {
+	fetch         TokenFetchFunc
+	refreshBefore time.Duration
+
+	mu       sync.Mutex
+	token    string
+	expireAt time.Time
+}
+
+// NewRefreshingTokenSource 在过期前refreshBefore重新申请，默认1分钟，有效期较短时在一半的时候重新申请
+func NewRefreshingTokenSource(fetch TokenFetchFunc, refreshBefore time.Duration) *RefreshingTokenSource {
+	if refreshBefore <= 0 {
+		refreshBefore = time.Minute
+	}
+	return &RefreshingTokenSource{fetch: fetch, refreshBefore: refreshBefore}
+}
+
+// Token 获取token，同时只会有一个申请
+func (s *RefreshingTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Now().Before(s.expireAt) {
+		return s.token, nil
+	}
+	token, expiresIn, err := s.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	early := s.refreshBefore
+	if expiresIn < 2*early {
+		early = expiresIn / 2
+	}
+	s.token = token
+	s.expireAt = time.Now().Add(expiresIn - early)
+	return token, nil
+}
+
+// Invalidate 清除缓存的token，下次重新申请，例如token被撤销以后
+func (s *RefreshingTokenSource) Invalidate() {
+	s.mu.Lock()
+	s.token = ""
+	s.mu.Unlock()
+}
+
+// oauth2TokenSource 使用oauth2.TokenSource获取token
+type oauth2TokenSource struct {
+	ts oauth2.TokenSource
+}
+
+// OAuth2TokenSource 使用oauth2.TokenSource，例如client包中自动刷新的TokenSource
+func OAuth2TokenSource(ts oauth2.TokenSource) TokenSource {
+	return &oauth2TokenSource{ts: ts}
+}
+
+// Token 获取token
+func (s *oauth2TokenSource) Token(_ context.Context) (string, error) {
+	token, err := s.ts.Token()
+	if err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
+
+// PerRPCCredentials 每次调用时在authorization中带上token，使用grpc.WithPerRPCCredentials设置
+type PerRPCCredentials struct {
+	Source        TokenSource //获取token的方式
+	AllowInsecure bool        //是否允许在不加密的连接上发送token，只用于本地测试
+}
+
+// GetRequestMetadata 获取token
+func (c *PerRPCCredentials) GetRequestMetadata(ctx context.Context, _ ...string) (map[string]string, error) {
+	token, err := c.Source.Token(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return map[string]string{"authorization": "Bearer " + token}, nil
+}
+
+// RequireTransportSecurity 默认只在TLS连接上发送token
+func (c *PerRPCCredentials) RequireTransportSecurity() bool {
+	return !c.AllowInsecure
+}
+
+// UnaryClientInterceptor 服务端返回Unauthenticated时，清除缓存的token并重试一次，需要同时设置PerRPCCredentials
+func UnaryClientInterceptor(source *RefreshingTokenSource) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if status.Code(err) != codes.Unauthenticated {
+			return err
+		}
+		source.Invalidate()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -0,0 +1,101 @@
+package grpcauth
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/errors"
+	"github.com/go-oauth2/oauth2/v4/models"
+	"github.com/tianlin0/go-plat-oauth/oauth/httpserver"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestInterceptors(t *testing.T) {
+	tokens := map[string]string{"good": "health", "noscope": "read"}
+	opt := ServerOption{
+		Verify: func(ctx context.Context, token string) (oauth2.TokenInfo, error) {
+			if scope, ok := tokens[token]; ok {
+				return &models.Token{ClientID: "client1", Access: token, Scope: scope}, nil
+			}
+			return nil, errors.ErrInvalidAccessToken
+		},
+		Scopes: map[string][]string{"/grpc.health.v1.Health/": {"health"}},
+	}
+	checkContext := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if _, ok := httpserver.TokenInfoFromContext(ctx); !ok {
+			t.Error("token not in context")
+		}
+		return handler(ctx, req)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(UnaryServerInterceptor(opt), checkContext))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go func() { _ = srv.Serve(lis) }()
+	defer srv.Stop()
+
+	call := func(dialOpts ...grpc.DialOption) error {
+		dialOpts = append(dialOpts,
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+			grpc.WithTransportCredentials(insecure.NewCredentials()))
+		conn, err := grpc.NewClient("passthrough:///bufnet", dialOpts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		_, err = healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+		return err
+	}
+	withToken := func(token string) grpc.DialOption {
+		return grpc.WithPerRPCCredentials(&PerRPCCredentials{Source: NewRefreshingTokenSource(func(ctx context.Context) (string, time.Duration, error) {
+			return token, time.Hour, nil
+		}, 0), AllowInsecure: true})
+	}
+
+	if code := status.Code(call()); code != codes.Unauthenticated {
+		t.Fatalf("unexpected code %v", code)
+	}
+	if code := status.Code(call(withToken("unknown"))); code != codes.Unauthenticated {
+		t.Fatalf("unexpected code %v", code)
+	}
+	if code := status.Code(call(withToken("noscope"))); code != codes.PermissionDenied {
+		t.Fatalf("unexpected code %v", code)
+	}
+	if err := call(withToken("good")); err != nil {
+		t.Fatal(err)
+	}
+
+	//token失效以后重新申请并重试
+	fetched := []string{"revoked", "good"}
+	source := NewRefreshingTokenSource(func(ctx context.Context) (string, time.Duration, error) {
+		token := fetched[0]
+		fetched = fetched[1:]
+		return token, time.Hour, nil
+	}, 0)
+	if err := call(grpc.WithPerRPCCredentials(&PerRPCCredentials{Source: source, AllowInsecure: true}),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor(source))); err != nil {
+		t.Fatal(err)
+	}
+	if len(fetched) != 0 {
+		t.Fatal("token not refreshed")
+	}
+}
+
+func TestAuthenticateWithoutServer(t *testing.T) {
+	//当前进程没有启动授权服务，默认的Verify不能panic
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer good"))
+	_, err := ServerOption{}.authenticate(ctx, "/grpc.health.v1.Health/Check")
+	if code := status.Code(err); code != codes.Unavailable {
+		t.Fatalf("unexpected code %v", code)
+	}
+}
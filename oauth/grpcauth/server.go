@@ -0,0 +1,126 @@
+// Package grpcauth gRPC的bearer token认证，服务端拦截器使用与HTTP相同的token，客户端自动带上token
+package grpcauth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/errors"
+	"github.com/tianlin0/go-plat-oauth/oauth/httpserver"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// VerifyFunc 验证token，默认为httpserver.VerifyAccessToken，独立的资源服务可以使用resource.Verifier的Verify
+type VerifyFunc func(ctx context.Context, token string) (oauth2.TokenInfo, error)
+
+// ServerOption 服务端拦截器的配置
+type ServerOption struct {
+	Verify   VerifyFunc                   //验证token的方式，默认使用当前进程中的授权服务
+	Scopes   map[string][]string          //方法需要的scope，key为/pkg.Service/Method，或者/pkg.Service/表示整个服务，没有配置的方法只验证token
+	Skip     func(fullMethod string) bool //返回true时不验证，例如健康检查
+	Audience []string                     //当前服务的resource，设置以后只接受audience中包含其中一个的token
+}
+
+// UnaryServerInterceptor 验证一元调用的token，通过以后可以用httpserver.TokenInfoFromContext获取token
+func UnaryServerInterceptor(opt ServerOption) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := opt.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor 验证流式调用的token
+func StreamServerInterceptor(opt ServerOption) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := opt.authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// serverStream 替换stream的ctx
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context 带有token的ctx
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// authenticate 验证token和方法需要的scope，把token保存在ctx中
+func (opt ServerOption) authenticate(ctx context.Context, fullMethod string) (context.Context, error) {
+	if opt.Skip != nil && opt.Skip(fullMethod) {
+		return ctx, nil
+	}
+	token, ok := bearerToken(ctx)
+	if !ok {
+		return nil, statusError(errors.ErrInvalidAccessToken, false)
+	}
+	verify := opt.Verify
+	if verify == nil {
+		verify = httpserver.VerifyAccessToken
+	}
+	ti, err := verify(ctx, token)
+	if err == nil {
+		err = httpserver.CheckAudience(ti, opt.Audience)
+	}
+	if err != nil {
+		return nil, statusError(err, true)
+	}
+	if scopes := opt.methodScopes(fullMethod); !httpserver.HasAllScopes(ti, scopes...) {
+		return nil, statusError(httpserver.InsufficientScopeError(scopes...), true)
+	}
+	return httpserver.WithTokenInfo(ctx, ti), nil
+}
+
+// methodScopes 方法的配置优先，没有时使用服务的配置
+func (opt ServerOption) methodScopes(fullMethod string) []string {
+	if scopes, ok := opt.Scopes[fullMethod]; ok {
+		return scopes
+	}
+	if i := strings.LastIndex(fullMethod, "/"); i > 0 {
+		return opt.Scopes[fullMethod[:i+1]]
+	}
+	return nil
+}
+
+// bearerToken 获取authorization中的token
+func bearerToken(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	for _, auth := range md.Get("authorization") {
+		if len(auth) > len("Bearer ") && strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+			return auth[len("Bearer "):], true
+		}
+	}
+	return "", false
+}
+
+// statusError 按照RFC 6750 中的错误转换为gRPC的状态码
+func statusError(err error, hasToken bool) error {
+	be := httpserver.ToBearerError(err, hasToken)
+	code := codes.Internal
+	switch be.Status {
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	}
+	return status.Error(code, be.Error())
+}
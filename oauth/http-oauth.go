@@ -0,0 +1,115 @@
+package oauth
+
+import (
+	"net/http"
+
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+	"github.com/tianlin0/go-plat-oauth/oauth/httpserver"
+)
+
+// HTTPOAuthServer 不依赖gin的oauth服务，可以直接挂载到net/http、chi、echo等路由上，例如：
+//
+//	http.Handle("/oauth2/", srv)
+//	chiRouter.Mount("/oauth2", srv)
+//	echoServer.Any("/oauth2/*", echo.WrapHandler(srv))
+//
+// 提供/oauth2/authorize、token、read、introspect、jwks，授权记录、退出登录和管理接口目前只有gin的版本
+type HTTPOAuthServer struct {
+	mux    *http.ServeMux
+	verify func(http.Handler) http.Handler
+}
+
+// NewHTTPOAuthServer 使用与StartGinOAuthServer相同的配置启动oauth服务，配置有误时返回nil
+func NewHTTPOAuthServer(oauthConfig *GinOauthOption) *HTTPOAuthServer {
+	stores := startOAuthServer(oauthConfig)
+	if stores == nil {
+		return nil
+	}
+	s := &HTTPOAuthServer{
+		mux:    http.NewServeMux(),
+		verify: getHTTPTokenVerifyHandle(oauthConfig),
+	}
+
+	authorize := func(w http.ResponseWriter, r *http.Request) {
+		if err := httpserver.HandleAuthorizeRequest(w, withSessionBinding(r)); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+	s.mux.HandleFunc("GET /oauth2/authorize", authorize)
+	s.mux.HandleFunc("POST /oauth2/authorize", authorize)
+
+	token := func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		if oauthConfig.TokenCreateNumber > 0 {
+			err = httpserver.HandleTokenNumberRequest(w, r, oauthConfig.TokenCreateNumber, oauthConfig.TokenCreateHandler)
+		} else {
+			err = httpserver.HandleTokenRequest(w, r, oauthConfig.TokenCreateHandler)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}
+	//POST时client_secret可以放在HTTP Basic认证中，GET只为兼容旧的调用方
+	s.mux.HandleFunc("GET /oauth2/token", token)
+	s.mux.HandleFunc("POST /oauth2/token", token)
+
+	s.mux.Handle("GET /oauth2/read", s.verify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data interface{}
+		//api key等其他认证方式没有用户的token
+		if p, ok := httpserver.PrincipalFromContext(r.Context()); ok && p.Method != httpserver.AuthMethodBearer {
+			writeReadResponse(w, nil)
+			return
+		}
+		if ti, ok := httpserver.TokenInfoFromContext(r.Context()); ok {
+			data = ti
+			if oauthConfig.HTTPReadUserCallbackHandler != nil {
+				data = oauthConfig.HTTPReadUserCallbackHandler(r, ti)
+			}
+		}
+		writeReadResponse(w, data)
+	})))
+
+	s.mux.HandleFunc("POST /oauth2/introspect", httpserver.HandleIntrospectionRequest)
+	if stores.jwtAccess != nil {
+		s.mux.HandleFunc("GET /oauth2/jwks", stores.jwtAccess.handleJWKS)
+	}
+	return s
+}
+
+// ServeHTTP 处理/oauth2下的请求
+func (s *HTTPOAuthServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// HandleTokenVerify 验证token的中间件，与/oauth2/read使用相同的配置，验证通过的token通过httpserver.TokenInfoFromContext获取
+func (s *HTTPOAuthServer) HandleTokenVerify(next http.Handler) http.Handler {
+	return s.verify(next)
+}
+
+// getHTTPErrorHandleFunc 验证token出错时的输出方式，默认按RFC 6750 输出
+func getHTTPErrorHandleFunc(oauthConfig *GinOauthOption) httpserver.ErrorHandleFunc {
+	if oauthConfig.HTTPErrorHandleFunc != nil {
+		return oauthConfig.HTTPErrorHandleFunc
+	}
+	if !oauthConfig.CommErrorResponse {
+		return httpserver.BearerErrorHandleFunc
+	}
+	return writeCommError
+}
+
+func getHTTPTokenVerifyHandle(oauthConfig *GinOauthOption) func(http.Handler) http.Handler {
+	verify := httpserver.VerifyRequest
+	if skipper := oauthConfig.HTTPTokenVerifySkipper; skipper != nil {
+		verify = func(r *http.Request) (oauth2.TokenInfo, error) {
+			if tokenInfo := skipper(r); tokenInfo != nil {
+				return tokenInfo, nil
+			}
+			return httpserver.VerifyRequest(r)
+		}
+	}
+	return httpserver.HandleTokenVerifyWith(verify, httpserver.Config{
+		ErrorHandleFunc: getHTTPErrorHandleFunc(oauthConfig),
+		Extractors:      oauthConfig.TokenExtractors,
+		Authenticators:  oauthConfig.Authenticators,
+	})
+}
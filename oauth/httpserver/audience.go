@@ -0,0 +1,99 @@
+package httpserver
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-oauth2/oauth2/v4"
+)
+
+// resourceScopePrefix token的audience以 resource:{uri} 的形式保存在scope中，所有存储方式都不需要额外的字段
+const resourceScopePrefix = "resource:"
+
+// sessionScopePrefix 通过单点登录会话授权的token，以 sid:{id} 的形式把会话保存在scope中，既不是scope也不是audience
+const sessionScopePrefix = "sid:"
+
+// SplitAudience 把scope拆分为普通的scope和audience，会话不包含在两者中
+func SplitAudience(scope string) (string, []string) {
+	scopes := make([]string, 0)
+	audience := make([]string, 0)
+	for _, one := range strings.Fields(scope) {
+		if strings.HasPrefix(one, sessionScopePrefix) {
+			continue
+		}
+		if strings.HasPrefix(one, resourceScopePrefix) {
+			audience = append(audience, strings.TrimPrefix(one, resourceScopePrefix))
+		} else {
+			scopes = append(scopes, one)
+		}
+	}
+	return strings.Join(scopes, " "), audience
+}
+
+// WithAudience 把audience加入scope
+func WithAudience(scope string, audience []string) string {
+	scopes := strings.Fields(scope)
+	for _, one := range audience {
+		scopes = append(scopes, resourceScopePrefix+one)
+	}
+	return strings.Join(scopes, " ")
+}
+
+// ScopeSessionID scope中保存的会话，第二个返回值表示scope中是否带有会话
+func ScopeSessionID(scope string) (string, bool) {
+	for _, one := range strings.Fields(scope) {
+		if strings.HasPrefix(one, sessionScopePrefix) {
+			return strings.TrimPrefix(one, sessionScopePrefix), true
+		}
+	}
+	return "", false
+}
+
+// WithSessionID 把会话加入scope，替换原来的会话
+func WithSessionID(scope string, sessionID string) string {
+	scope = WithAudience(SplitAudience(scope))
+	if sessionID == "" {
+		return scope
+	}
+	return strings.TrimSpace(scope + " " + sessionScopePrefix + sessionID)
+}
+
+// TokenSessionID 生成token时的单点登录会话，不是通过会话授权时为空
+func TokenSessionID(ti oauth2.TokenInfo) string {
+	if ti == nil {
+		return ""
+	}
+	sessionID, _ := ScopeSessionID(ti.GetScope())
+	return sessionID
+}
+
+// TokenAudience token可以访问的resource，为空表示不限制
+func TokenAudience(ti oauth2.TokenInfo) []string {
+	if ti == nil {
+		return nil
+	}
+	_, audience := SplitAudience(ti.GetScope())
+	return audience
+}
+
+// audienceError token不是为当前服务生成的
+var audienceError = &BearerError{
+	Status:      http.StatusUnauthorized,
+	Code:        "invalid_token",
+	Description: "the access token is not intended for this resource",
+}
+
+// CheckAudience token的audience必须包含其中一个，没有audience的token也不接受
+func CheckAudience(ti oauth2.TokenInfo, accepted []string) error {
+	if len(accepted) == 0 {
+		return nil
+	}
+	for _, one := range TokenAudience(ti) {
+		for _, resource := range accepted {
+			if one == resource {
+				return nil
+			}
+		}
+	}
+	return audienceError
+}
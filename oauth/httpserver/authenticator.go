@@ -0,0 +1,336 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	stderrors "errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/errors"
+	"github.com/go-oauth2/oauth2/v4/models"
+	gCache "github.com/patrickmn/go-cache"
+)
+
+// AuthMethod 认证方式，记录在Principal中用于审计
+type AuthMethod string
+
+const (
+	AuthMethodBearer AuthMethod = "bearer"  //oauth2的access token
+	AuthMethodAPIKey AuthMethod = "api_key" //固定的api key
+	AuthMethodMTLS   AuthMethod = "mtls"    //TLS客户端证书
+	AuthMethodHMAC   AuthMethod = "hmac"    //HMAC签名的请求
+)
+
+// ErrNoCredentials 请求中没有该认证方式的凭证，继续尝试下一个Authenticator
+var ErrNoCredentials = errors.New("no credentials")
+
+// Principal 认证通过的调用方
+type Principal struct {
+	Method    AuthMethod       //认证方式
+	Subject   string           //调用方，用户id、client id、证书的CN或者key id
+	ClientID  string           //客户端id
+	UserID    string           //用户id
+	Scopes    []string         //拥有的scope，用于RequireScopes
+	TokenInfo oauth2.TokenInfo //bearer token的信息，其他方式按ClientID、UserID和Scopes生成，只用于scope检查，代表用户的接口需要检查Method
+}
+
+// Authenticator 认证请求，请求中没有对应的凭证时返回ErrNoCredentials，凭证错误时返回其他错误，不再尝试后面的Authenticator
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// AuthenticatorFunc 函数形式的Authenticator
+type AuthenticatorFunc func(r *http.Request) (*Principal, error)
+
+// Authenticate 认证请求
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*Principal, error) {
+	return f(r)
+}
+
+type principalKey struct{}
+
+// WithPrincipal 把认证通过的调用方保存在ctx中
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext 获取HandleTokenVerify认证通过的调用方
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// Authenticate 按顺序使用authenticators认证，都没有凭证或者返回的调用方为空时返回ErrInvalidAccessToken
+func Authenticate(r *http.Request, authenticators ...Authenticator) (*Principal, error) {
+	for _, authenticator := range authenticators {
+		p, err := authenticator.Authenticate(r)
+		if err == ErrNoCredentials {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			return nil, errors.ErrInvalidAccessToken
+		}
+		if p.TokenInfo == nil {
+			principal := *p
+			principal.TokenInfo = &models.Token{ClientID: p.ClientID, UserID: p.UserID, Scope: strings.Join(p.Scopes, " ")}
+			p = &principal
+		}
+		return p, nil
+	}
+	return nil, errors.ErrInvalidAccessToken
+}
+
+// NewBearerPrincipal bearer token对应的调用方，没有用户时以client id作为Subject
+func NewBearerPrincipal(ti oauth2.TokenInfo) *Principal {
+	p := &Principal{
+		Method:    AuthMethodBearer,
+		Subject:   ti.GetUserID(),
+		ClientID:  ti.GetClientID(),
+		UserID:    ti.GetUserID(),
+		Scopes:    TokenScopes(ti),
+		TokenInfo: ti,
+	}
+	if p.Subject == "" {
+		p.Subject = p.ClientID
+	}
+	return p
+}
+
+// withMethod 复制查询到的调用方并设置认证方式，不修改查询方保存的数据
+func withMethod(p *Principal, method AuthMethod) *Principal {
+	principal := *p
+	principal.Method = method
+	return &principal
+}
+
+// invalidCredentials 凭证错误
+func invalidCredentials(description string) *BearerError {
+	return &BearerError{Status: http.StatusUnauthorized, Code: "invalid_token", Description: description}
+}
+
+// BearerAuthenticator 验证bearer token，verify为空时使用VerifyRequest，也可以使用resource.Verifier.VerifyRequest
+func BearerAuthenticator(verify VerifyFunc) Authenticator {
+	if verify == nil {
+		verify = VerifyRequest
+	}
+	return AuthenticatorFunc(func(r *http.Request) (*Principal, error) {
+		if _, ok := BearerToken(r); !ok {
+			return nil, ErrNoCredentials
+		}
+		ti, err := verify(r)
+		if err != nil {
+			return nil, err
+		}
+		return NewBearerPrincipal(ti), nil
+	})
+}
+
+// APIKeyLookup 查询api key对应的调用方，不存在时返回nil，建议只保存key的hash
+type APIKeyLookup func(ctx context.Context, key string) (*Principal, error)
+
+// APIKeyAuthenticator 从header中获取api key，header为空时使用X-API-Key
+func APIKeyAuthenticator(header string, lookup APIKeyLookup) Authenticator {
+	if header == "" {
+		header = "X-API-Key"
+	}
+	return AuthenticatorFunc(func(r *http.Request) (*Principal, error) {
+		key := r.Header.Get(header)
+		if key == "" {
+			return nil, ErrNoCredentials
+		}
+		p, err := lookup(r.Context(), key)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			return nil, invalidCredentials("the api key is invalid")
+		}
+		return withMethod(p, AuthMethodAPIKey), nil
+	})
+}
+
+// ClientCertLookup 查询证书对应的调用方，不存在时返回nil
+type ClientCertLookup func(ctx context.Context, cert *x509.Certificate) (*Principal, error)
+
+// ClientCertAuthenticator 使用已经验证过的TLS客户端证书，需要在tls.Config中设置ClientCAs和ClientAuth，
+// lookup为空时以证书的CN作为Subject
+func ClientCertAuthenticator(lookup ClientCertLookup) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (*Principal, error) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			return nil, ErrNoCredentials
+		}
+		cert := r.TLS.VerifiedChains[0][0]
+		if lookup == nil {
+			return &Principal{Method: AuthMethodMTLS, Subject: cert.Subject.CommonName}, nil
+		}
+		p, err := lookup(r.Context(), cert)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			return nil, invalidCredentials("the client certificate is not allowed")
+		}
+		return withMethod(p, AuthMethodMTLS), nil
+	})
+}
+
+// HMAC签名使用的header
+const (
+	HMACKeyHeader       = "X-Auth-Key"
+	HMACTimestampHeader = "X-Auth-Timestamp"
+	HMACNonceHeader     = "X-Auth-Nonce"
+	HMACSignatureHeader = "X-Auth-Signature"
+)
+
+// HMACMaxBodySize HMAC签名的请求body的最大长度，签名验证之前需要读取整个body，超过时直接拒绝，默认1MiB
+var HMACMaxBodySize int64 = 1 << 20
+
+// HMACKeyLookup 查询key id对应的密钥和调用方，不存在时返回nil的密钥，调用方为nil时以key id作为Subject
+type HMACKeyLookup func(ctx context.Context, keyID string) (secret []byte, p *Principal, err error)
+
+// NonceCache 记录已经使用过的nonce，防止签名的请求被重放，多实例部署时需要使用共享的存储
+type NonceCache interface {
+	// Use 记录nonce，exp以后可以清除，已经使用过时返回false
+	Use(ctx context.Context, nonce string, exp time.Duration) (bool, error)
+}
+
+// NewMemoryNonceCache 内存存储，只适合单机部署
+func NewMemoryNonceCache() NonceCache {
+	return &memoryNonceCache{cache: gCache.New(10*time.Minute, 10*time.Minute)}
+}
+
+type memoryNonceCache struct {
+	cache *gCache.Cache
+}
+
+// Use 已经存在时Add返回错误
+func (c *memoryNonceCache) Use(_ context.Context, nonce string, exp time.Duration) (bool, error) {
+	return c.cache.Add(nonce, struct{}{}, exp) == nil, nil
+}
+
+// HMACAuthenticator 验证SignRequest签名的请求，maxSkew为允许的时间误差，默认5分钟，
+// nonces记录时间误差范围内使用过的nonce，为空时使用内存存储
+func HMACAuthenticator(lookup HMACKeyLookup, maxSkew time.Duration, nonces NonceCache) Authenticator {
+	if maxSkew <= 0 {
+		maxSkew = 5 * time.Minute
+	}
+	if nonces == nil {
+		nonces = NewMemoryNonceCache()
+	}
+	return AuthenticatorFunc(func(r *http.Request) (*Principal, error) {
+		keyID := r.Header.Get(HMACKeyHeader)
+		if keyID == "" {
+			return nil, ErrNoCredentials
+		}
+		ts, err := strconv.ParseInt(r.Header.Get(HMACTimestampHeader), 10, 64)
+		if err != nil {
+			return nil, invalidCredentials("the request timestamp is invalid")
+		}
+		if skew := time.Since(time.Unix(ts, 0)); skew > maxSkew || skew < -maxSkew {
+			return nil, invalidCredentials("the request timestamp is out of range")
+		}
+		nonce := r.Header.Get(HMACNonceHeader)
+		if nonce == "" {
+			return nil, invalidCredentials("the request nonce is missing")
+		}
+		signature, err := base64.StdEncoding.DecodeString(r.Header.Get(HMACSignatureHeader))
+		if err != nil {
+			return nil, invalidCredentials("the request signature is invalid")
+		}
+		secret, p, err := lookup(r.Context(), keyID)
+		if err != nil {
+			return nil, err
+		}
+		if len(secret) == 0 {
+			return nil, invalidCredentials("the signing key is invalid")
+		}
+		expected, err := requestSignature(r, secret, ts, nonce, HMACMaxBodySize)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if stderrors.As(err, &tooLarge) {
+				return nil, &BearerError{Status: http.StatusRequestEntityTooLarge, Code: "invalid_request",
+					Description: "the request body is too large"}
+			}
+			return nil, err
+		}
+		if !hmac.Equal(signature, expected) {
+			log.Println("hmac signature mismatch:", keyID, r.Method, r.URL.Path)
+			return nil, invalidCredentials("the request signature is invalid")
+		}
+		//签名正确以后再记录nonce，时间误差范围以外的请求已经被拒绝
+		fresh, err := nonces.Use(r.Context(), keyID+":"+nonce, 2*maxSkew)
+		if err != nil {
+			return nil, err
+		}
+		if !fresh {
+			log.Println("hmac nonce replayed:", keyID, r.Method, r.URL.Path)
+			return nil, invalidCredentials("the request nonce has been used")
+		}
+		if p == nil {
+			p = &Principal{Subject: keyID}
+		}
+		return withMethod(p, AuthMethodHMAC), nil
+	})
+}
+
+// SignRequest 客户端对请求签名，签名内容为method、host、path和query、Content-Type、时间戳、nonce和body的sha256，
+// 每次签名使用新的nonce，重试时需要重新签名
+func SignRequest(r *http.Request, keyID string, secret []byte) error {
+	ts := time.Now().Unix()
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	nonce := hex.EncodeToString(buf)
+	signature, err := requestSignature(r, secret, ts, nonce, 0)
+	if err != nil {
+		return err
+	}
+	r.Header.Set(HMACKeyHeader, keyID)
+	r.Header.Set(HMACTimestampHeader, strconv.FormatInt(ts, 10))
+	r.Header.Set(HMACNonceHeader, nonce)
+	r.Header.Set(HMACSignatureHeader, base64.StdEncoding.EncodeToString(signature))
+	return nil
+}
+
+// requestSignature 计算签名，读取body以后重新设置，后面的处理可以继续读取，maxBodySize大于0时限制body的长度
+func requestSignature(r *http.Request, secret []byte, ts int64, nonce string, maxBodySize int64) ([]byte, error) {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		reader := r.Body
+		if maxBodySize > 0 {
+			reader = http.MaxBytesReader(nil, r.Body, maxBodySize)
+		}
+		var err error
+		if body, err = io.ReadAll(reader); err != nil {
+			return nil, err
+		}
+		_ = r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	//客户端创建的请求Host可能为空，以url中的host为准
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join([]string{r.Method, strings.ToLower(host), r.URL.RequestURI(), r.Header.Get("Content-Type"),
+		strconv.FormatInt(ts, 10), nonce, hex.EncodeToString(bodyHash[:])}, "\n")))
+	return mac.Sum(nil), nil
+}
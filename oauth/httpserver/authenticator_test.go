@@ -0,0 +1,173 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-oauth2/oauth2/v4/errors"
+)
+
+func TestAuthenticators(t *testing.T) {
+	apiKeys := map[string]*Principal{"key1": {Subject: "job", ClientID: "batch", Scopes: []string{"read"}}}
+	lookupKey := func(_ context.Context, key string) (*Principal, error) {
+		return apiKeys[key], nil
+	}
+	lookupSecret := func(_ context.Context, keyID string) ([]byte, *Principal, error) {
+		if keyID != "svc1" {
+			return nil, nil, nil
+		}
+		return []byte("secret1"), nil, nil
+	}
+
+	var got *Principal
+	handler := HandleTokenVerify(Config{Authenticators: []Authenticator{
+		APIKeyAuthenticator("", lookupKey),
+		HMACAuthenticator(lookupSecret, 0, nil),
+	}})(RequireScopes("read")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = PrincipalFromContext(r.Context())
+	})))
+	serve := func(req *http.Request) int {
+		got = nil
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/data", nil)
+	req.Header.Set("X-API-Key", "key1")
+	if code := serve(req); code != http.StatusOK || got.Method != AuthMethodAPIKey || got.Subject != "job" {
+		t.Fatalf("api key: unexpected %d %+v", code, got)
+	}
+	if apiKeys["key1"].Method != "" {
+		t.Fatal("lookup result modified")
+	}
+
+	//api key错误时不再尝试后面的认证方式
+	req = httptest.NewRequest(http.MethodGet, "/data", nil)
+	req.Header.Set("X-API-Key", "wrong")
+	if code := serve(req); code != http.StatusUnauthorized {
+		t.Fatalf("wrong api key: unexpected %d", code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/data?x=1", strings.NewReader(`{"a":1}`))
+	if err := SignRequest(req, "svc1", []byte("secret1")); err != nil {
+		t.Fatal(err)
+	}
+	//签名的调用方没有scope
+	if code := serve(req); code != http.StatusForbidden {
+		t.Fatalf("hmac: unexpected %d", code)
+	}
+	req = httptest.NewRequest(http.MethodPost, "/data?x=1", strings.NewReader(`{"a":1}`))
+	_ = SignRequest(req, "svc1", []byte("secret1"))
+	req.Body = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"a":2}`)).Body
+	if code := serve(req); code != http.StatusUnauthorized {
+		t.Fatalf("tampered hmac: unexpected %d", code)
+	}
+
+	if code := serve(httptest.NewRequest(http.MethodGet, "/data", nil)); code != http.StatusUnauthorized {
+		t.Fatalf("no credentials: unexpected %d", code)
+	}
+
+	//自定义的Authenticator返回空的调用方时视为认证失败
+	nilPrincipal := AuthenticatorFunc(func(*http.Request) (*Principal, error) {
+		return nil, nil
+	})
+	if _, err := Authenticate(httptest.NewRequest(http.MethodGet, "/data", nil), nilPrincipal); err != errors.ErrInvalidAccessToken {
+		t.Fatalf("nil principal: unexpected %v", err)
+	}
+}
+
+func TestHMACAuthenticator(t *testing.T) {
+	lookupSecret := func(_ context.Context, keyID string) ([]byte, *Principal, error) {
+		return []byte("secret1"), nil, nil
+	}
+	authenticator := HMACAuthenticator(lookupSecret, 0, nil)
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "http://api.example.com/data?x=1", strings.NewReader(`{"a":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		if err := SignRequest(req, "svc1", []byte("secret1")); err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+
+	req := newRequest()
+	if p, err := authenticator.Authenticate(req); err != nil || p.Subject != "svc1" || p.Method != AuthMethodHMAC {
+		t.Fatalf("signed request rejected: %+v %v", p, err)
+	}
+	//同一个nonce不能重复使用
+	if _, err := authenticator.Authenticate(req); err == nil {
+		t.Fatal("replayed request accepted")
+	}
+
+	req = newRequest()
+	req.Header.Del(HMACNonceHeader)
+	if _, err := authenticator.Authenticate(req); err == nil {
+		t.Fatal("request without nonce accepted")
+	}
+	req = newRequest()
+	req.Host = "other.example.com"
+	if _, err := authenticator.Authenticate(req); err == nil {
+		t.Fatal("request with a different host accepted")
+	}
+	req = newRequest()
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if _, err := authenticator.Authenticate(req); err == nil {
+		t.Fatal("request with a different content type accepted")
+	}
+
+	//签名验证之前不读取超过长度的body
+	large := httptest.NewRequest(http.MethodPost, "http://api.example.com/data",
+		strings.NewReader(strings.Repeat("a", int(HMACMaxBodySize)+1)))
+	if err := SignRequest(large, "svc1", []byte("secret1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := authenticator.Authenticate(large); err == nil || err.(*BearerError).Status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("large body accepted: %v", err)
+	}
+}
+
+func TestClientCertAuthenticator(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "svc1"}}
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "https://api.example.com/data", nil)
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		return req
+	}
+
+	if _, err := ClientCertAuthenticator(nil).Authenticate(httptest.NewRequest(http.MethodGet, "/data", nil)); err != ErrNoCredentials {
+		t.Fatalf("expected no credentials without tls, got %v", err)
+	}
+	//没有验证过的证书链时不使用证书
+	req := newRequest()
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if _, err := ClientCertAuthenticator(nil).Authenticate(req); err != ErrNoCredentials {
+		t.Fatalf("expected no credentials without verified chains, got %v", err)
+	}
+
+	p, err := ClientCertAuthenticator(nil).Authenticate(newRequest())
+	if err != nil || p.Subject != "svc1" || p.Method != AuthMethodMTLS {
+		t.Fatalf("unexpected principal: %+v %v", p, err)
+	}
+
+	allowed := map[string]*Principal{"svc1": {Subject: "svc1", ClientID: "client1", Scopes: []string{"read"}}}
+	authenticator := ClientCertAuthenticator(func(_ context.Context, cert *x509.Certificate) (*Principal, error) {
+		return allowed[cert.Subject.CommonName], nil
+	})
+	if p, err = authenticator.Authenticate(newRequest()); err != nil || p.ClientID != "client1" || p.Method != AuthMethodMTLS {
+		t.Fatalf("unexpected principal: %+v %v", p, err)
+	}
+	if allowed["svc1"].Method != "" {
+		t.Fatal("lookup result modified")
+	}
+	cert.Subject.CommonName = "svc2"
+	if _, err = authenticator.Authenticate(newRequest()); err == nil {
+		t.Fatal("unknown certificate accepted")
+	}
+}
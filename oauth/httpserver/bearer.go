@@ -0,0 +1,131 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-oauth2/oauth2/v4/errors"
+)
+
+// ErrRevokedAccessToken token已经被撤销
+var ErrRevokedAccessToken = errors.New("revoked access token")
+
+// bearerRealm WWW-Authenticate中的realm，为空时不输出
+var bearerRealm string
+
+// SetBearerRealm 设置WWW-Authenticate中的realm
+func SetBearerRealm(realm string) {
+	bearerRealm = realm
+}
+
+// BearerError RFC 6750 中定义的错误
+type BearerError struct {
+	Status      int    //HTTP状态码
+	Code        string //错误码，缺少token时为空
+	Description string //错误说明
+	Scope       string //insufficient_scope时需要的scope
+}
+
+// Error 错误说明
+func (e *BearerError) Error() string {
+	if e.Code == "" {
+		return e.Description
+	}
+	return e.Code + ": " + e.Description
+}
+
+// InsufficientScopeError token缺少需要的scope
+func InsufficientScopeError(scopes ...string) *BearerError {
+	return &BearerError{
+		Status:      http.StatusForbidden,
+		Code:        "insufficient_scope",
+		Description: "the request requires higher privileges than provided by the access token",
+		Scope:       strings.Join(scopes, " "),
+	}
+}
+
+// GetBearerError 把验证token时的错误转换为RFC 6750 中的错误，不是token的问题时返回500
+func GetBearerError(r *http.Request, err error) *BearerError {
+	_, hasToken := BearerToken(r)
+	return ToBearerError(err, hasToken)
+}
+
+// ToBearerError 与GetBearerError相同，hasToken为请求中是否带有token
+func ToBearerError(err error, hasToken bool) *BearerError {
+	if be, ok := err.(*BearerError); ok {
+		return be
+	}
+	switch err {
+	case errors.ErrInvalidAccessToken:
+		if !hasToken {
+			return &BearerError{Status: http.StatusUnauthorized, Description: "missing access token"}
+		}
+		return &BearerError{Status: http.StatusUnauthorized, Code: "invalid_token", Description: "the access token is invalid"}
+	case errors.ErrExpiredAccessToken, errors.ErrExpiredRefreshToken:
+		return &BearerError{Status: http.StatusUnauthorized, Code: "invalid_token", Description: "the access token expired"}
+	case ErrRevokedAccessToken:
+		return &BearerError{Status: http.StatusUnauthorized, Code: "invalid_token", Description: "the access token has been revoked"}
+	}
+	return &BearerError{Status: http.StatusInternalServerError, Code: "server_error", Description: http.StatusText(http.StatusInternalServerError)}
+}
+
+// BearerToken 获取请求中的token，设置了WithTokenExtractors时使用获取到的token，不需要初始化服务，
+// 否则依次从Authorization header和表单body中获取，url参数中的token只接受GET和HEAD请求，与QueryExtractor相同
+func BearerToken(r *http.Request) (string, bool) {
+	if found, ok := r.Context().Value(extractedTokenKey{}).(extractedToken); ok {
+		return found.token, found.ok
+	}
+	auth := r.Header.Get("Authorization")
+	token := ""
+	if strings.HasPrefix(auth, "Bearer ") {
+		token = auth[len("Bearer "):]
+	} else if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		token = r.URL.Query().Get("access_token")
+	} else {
+		token = r.PostFormValue("access_token")
+	}
+	return token, token != ""
+}
+
+// BearerErrorHandleFunc 按RFC 6750 输出错误，401和403时带有WWW-Authenticate
+func BearerErrorHandleFunc(w http.ResponseWriter, r *http.Request, err error) {
+	be := GetBearerError(r, err)
+	if be.Status == http.StatusUnauthorized || be.Status == http.StatusForbidden {
+		w.Header().Set("WWW-Authenticate", be.authenticate())
+	}
+	body := map[string]string{"error_description": be.Description}
+	if be.Code != "" {
+		body["error"] = be.Code
+	}
+	if be.Scope != "" {
+		body["scope"] = be.Scope
+	}
+	writeJSON(w, be.Status, body)
+}
+
+// writeJSON 输出json
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+// authenticate WWW-Authenticate的内容，缺少token时只输出realm
+func (e *BearerError) authenticate() string {
+	params := make([]string, 0, 4)
+	if bearerRealm != "" {
+		params = append(params, fmt.Sprintf(`realm="%s"`, bearerRealm))
+	}
+	if e.Code != "" {
+		params = append(params, fmt.Sprintf(`error="%s"`, e.Code), fmt.Sprintf(`error_description="%s"`, e.Description))
+	}
+	if e.Scope != "" {
+		params = append(params, fmt.Sprintf(`scope="%s"`, e.Scope))
+	}
+	if len(params) == 0 {
+		return "Bearer"
+	}
+	return "Bearer " + strings.Join(params, ", ")
+}
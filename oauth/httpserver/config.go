@@ -0,0 +1,119 @@
+package httpserver
+
+import (
+	"net/http"
+
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/server"
+	"github.com/tianlin0/go-plat-oauth/oauth/scope"
+)
+
+// scopeRegistry RequireScopes 判断scope时使用
+var scopeRegistry *scope.Registry
+
+// introspectionClients 可以查询其他客户端token的资源服务，为空时客户端只能查询自己的token
+var introspectionClients func(clientID string) bool
+
+// SetTokenType token type
+func SetTokenType(tokenType string) {
+	oauthServer.Config.TokenType = tokenType
+}
+
+// SetAllowGetAccessRequest to allow GET requests for the token
+func SetAllowGetAccessRequest(allow bool) {
+	oauthServer.Config.AllowGetAccessRequest = allow
+}
+
+// SetAllowedResponseType allow the authorization types
+func SetAllowedResponseType(types ...oauth2.ResponseType) {
+	oauthServer.Config.AllowedResponseTypes = types
+}
+
+// SetAllowedGrantType allow the grant types
+func SetAllowedGrantType(types ...oauth2.GrantType) {
+	oauthServer.Config.AllowedGrantTypes = types
+}
+
+// SetClientInfoHandler get client info from request
+func SetClientInfoHandler(handler server.ClientInfoHandler) {
+	oauthServer.ClientInfoHandler = handler
+}
+
+// ClientBasicOrFormHandler 优先使用HTTP Basic认证中的client_id、client_secret，没有时从表单中获取
+func ClientBasicOrFormHandler(r *http.Request) (string, string, error) {
+	if _, _, ok := r.BasicAuth(); ok {
+		return server.ClientBasicHandler(r)
+	}
+	return server.ClientFormHandler(r)
+}
+
+// SetClientAuthorizedHandler check the client allows to use this authorization grant type
+func SetClientAuthorizedHandler(handler server.ClientAuthorizedHandler) {
+	oauthServer.ClientAuthorizedHandler = handler
+}
+
+// SetClientScopeHandler check the client allows to use scope
+func SetClientScopeHandler(handler server.ClientScopeHandler) {
+	oauthServer.ClientScopeHandler = handler
+}
+
+// SetUserAuthorizationHandler get user id from request authorization
+func SetUserAuthorizationHandler(handler server.UserAuthorizationHandler) {
+	oauthServer.UserAuthorizationHandler = handler
+}
+
+// SetPasswordAuthorizationHandler get user id from username and password
+func SetPasswordAuthorizationHandler(handler server.PasswordAuthorizationHandler) {
+	oauthServer.PasswordAuthorizationHandler = handler
+}
+
+// SetRefreshingScopeHandler check the scope of the refreshing token
+func SetRefreshingScopeHandler(handler server.RefreshingScopeHandler) {
+	oauthServer.RefreshingScopeHandler = handler
+}
+
+// SetRefreshingValidationHandler check if refresh_token is still valid
+func SetRefreshingValidationHandler(handler server.RefreshingValidationHandler) {
+	oauthServer.RefreshingValidationHandler = handler
+}
+
+// SetAccessValidationHandler check if access_token is still valid when verifying it
+func SetAccessValidationHandler(handler AccessValidationHandler) {
+	accessValidationHandler = handler
+}
+
+// SetResponseErrorHandler response error handling
+func SetResponseErrorHandler(handler server.ResponseErrorHandler) {
+	oauthServer.ResponseErrorHandler = handler
+}
+
+// SetInternalErrorHandler internal error handling
+func SetInternalErrorHandler(handler server.InternalErrorHandler) {
+	oauthServer.InternalErrorHandler = handler
+}
+
+// SetExtensionFieldsHandler in response to the access token with the extension of the field
+func SetExtensionFieldsHandler(handler server.ExtensionFieldsHandler) {
+	oauthServer.ExtensionFieldsHandler = handler
+}
+
+// SetAccessTokenExpHandler set expiration date for the access token
+func SetAccessTokenExpHandler(handler server.AccessTokenExpHandler) {
+	oauthServer.AccessTokenExpHandler = handler
+}
+
+// SetAuthorizeScopeHandler set scope for the access token
+func SetAuthorizeScopeHandler(handler server.AuthorizeScopeHandler) {
+	oauthServer.AuthorizeScopeHandler = handler
+}
+
+// SetScopeRegistry RequireScopes、RequireAnyScope 按注册的包含关系和通配符判断scope
+func SetScopeRegistry(registry *scope.Registry) {
+	scopeRegistry = registry
+}
+
+// SetIntrospectionClients 设置可以通过introspection查询其他客户端token的资源服务客户端，
+// 其他客户端只能查询自己的token，查询别的token时返回active为false
+func SetIntrospectionClients(allowed func(clientID string) bool) {
+	introspectionClients = allowed
+}
@@ -0,0 +1,70 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// TokenExtractor 从请求中获取token，没有时返回false
+type TokenExtractor func(r *http.Request) (string, bool)
+
+// HeaderExtractor 从Authorization: Bearer中获取
+func HeaderExtractor() TokenExtractor {
+	return func(r *http.Request) (string, bool) {
+		auth := r.Header.Get("Authorization")
+		if len(auth) > len("Bearer ") && strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+			return auth[len("Bearer "):], true
+		}
+		return "", false
+	}
+}
+
+// CookieExtractor 从cookie中获取，浏览器中使用HttpOnly的cookie，需要设置SameSite防止跨站请求
+func CookieExtractor(name string) TokenExtractor {
+	return func(r *http.Request) (string, bool) {
+		cookie, err := r.Cookie(name)
+		if err != nil || cookie.Value == "" {
+			return "", false
+		}
+		return cookie.Value, true
+	}
+}
+
+// QueryExtractor 从url参数中获取，例如websocket，name为空时使用access_token，
+// 只接受GET和HEAD请求，防止修改数据的请求使用容易泄露的url中的token
+func QueryExtractor(name string) TokenExtractor {
+	if name == "" {
+		name = "access_token"
+	}
+	return func(r *http.Request) (string, bool) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			return "", false
+		}
+		token := r.URL.Query().Get(name)
+		return token, token != ""
+	}
+}
+
+// extractedToken 按Config.Extractors获取到的token
+type extractedToken struct {
+	token string
+	ok    bool
+}
+
+type extractedTokenKey struct{}
+
+// WithTokenExtractors 按顺序使用extractors获取token，之后BearerToken只返回获取到的token，extractors为空时不处理
+func WithTokenExtractors(r *http.Request, extractors ...TokenExtractor) *http.Request {
+	if len(extractors) == 0 {
+		return r
+	}
+	found := extractedToken{}
+	for _, extractor := range extractors {
+		if token, ok := extractor(r); ok {
+			found = extractedToken{token: token, ok: true}
+			break
+		}
+	}
+	return r.WithContext(context.WithValue(r.Context(), extractedTokenKey{}, found))
+}
@@ -0,0 +1,63 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithTokenExtractors(t *testing.T) {
+	extractors := []TokenExtractor{CookieExtractor("session"), QueryExtractor(""), HeaderExtractor()}
+	cases := []struct {
+		method string
+		target string
+		cookie string
+		header string
+		token  string
+	}{
+		{http.MethodGet, "/ws?access_token=q", "", "", "q"},
+		{http.MethodPost, "/api?access_token=q", "", "", ""},
+		{http.MethodPost, "/api?access_token=q", "", "bearer h", "h"},
+		{http.MethodPost, "/api", "c", "Bearer h", "c"},
+	}
+	for _, one := range cases {
+		req := httptest.NewRequest(one.method, one.target, nil)
+		if one.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "session", Value: one.cookie})
+		}
+		if one.header != "" {
+			req.Header.Set("Authorization", one.header)
+		}
+		token, ok := BearerToken(WithTokenExtractors(req, extractors...))
+		if token != one.token || ok != (one.token != "") {
+			t.Fatalf("%s %s: unexpected token %q", one.method, one.target, token)
+		}
+	}
+}
+
+func TestBearerTokenDefault(t *testing.T) {
+	cases := []struct {
+		method string
+		target string
+		body   string
+		token  string
+	}{
+		{http.MethodGet, "/api?access_token=q", "", "q"},
+		{http.MethodHead, "/api?access_token=q", "", "q"},
+		{http.MethodPost, "/api?access_token=q", "", ""},
+		{http.MethodDelete, "/api?access_token=q", "", ""},
+		{http.MethodPost, "/api?access_token=q", "access_token=b", "b"},
+		{http.MethodPut, "/api", "access_token=b", "b"},
+	}
+	for _, one := range cases {
+		req := httptest.NewRequest(one.method, one.target, strings.NewReader(one.body))
+		if one.body != "" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		token, ok := BearerToken(req)
+		if token != one.token || ok != (one.token != "") {
+			t.Fatalf("%s %s: unexpected token %q", one.method, one.target, token)
+		}
+	}
+}
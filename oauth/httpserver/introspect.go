@@ -0,0 +1,108 @@
+package httpserver
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/models"
+)
+
+// IntrospectionResponse RFC 7662 的返回结果，token无效时只有active为false
+type IntrospectionResponse struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	Audience  []string `json:"aud,omitempty"`
+}
+
+// NewIntrospectionResponse 根据token生成返回结果
+func NewIntrospectionResponse(ti oauth2.TokenInfo) *IntrospectionResponse {
+	scope, audience := SplitAudience(ti.GetScope())
+	resp := &IntrospectionResponse{
+		Active:    true,
+		Scope:     scope,
+		ClientID:  ti.GetClientID(),
+		Subject:   ti.GetUserID(),
+		TokenType: "Bearer",
+		IssuedAt:  ti.GetAccessCreateAt().Unix(),
+		Audience:  audience,
+	}
+	if ti.GetAccessExpiresIn() > 0 {
+		resp.ExpiresAt = ti.GetAccessCreateAt().Add(ti.GetAccessExpiresIn()).Unix()
+	}
+	return resp
+}
+
+// TokenInfo 转换为token，资源服务中使用
+func (resp *IntrospectionResponse) TokenInfo(access string) oauth2.TokenInfo {
+	ti := &models.Token{
+		ClientID:       resp.ClientID,
+		UserID:         resp.Subject,
+		Scope:          WithAudience(resp.Scope, resp.Audience),
+		Access:         access,
+		AccessCreateAt: time.Unix(resp.IssuedAt, 0),
+	}
+	if resp.ExpiresAt > 0 {
+		ti.AccessExpiresIn = time.Unix(resp.ExpiresAt, 0).Sub(ti.AccessCreateAt)
+	}
+	return ti
+}
+
+// HandleIntrospectionRequest RFC 7662 token查询，调用方需要使用客户端的id和密钥认证，
+// token不存在、已过期、已撤销或者调用方不能查询时返回active为false
+func HandleIntrospectionRequest(w http.ResponseWriter, r *http.Request) {
+	if oauthServer == nil {
+		writeJSON(w, ErrServerNotStarted.Status, map[string]string{"error": ErrServerNotStarted.Code})
+		return
+	}
+	clientID, ok := authenticateClient(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="introspect"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	ctx := r.Context()
+	ti, err := oauthServer.Manager.LoadAccessToken(ctx, r.PostFormValue("token"))
+	if err == nil {
+		err = validationAccessToken(ctx, ti)
+	}
+	if err != nil || !introspectionAllowed(clientID, ti) {
+		writeJSON(w, http.StatusOK, &IntrospectionResponse{Active: false})
+		return
+	}
+	writeJSON(w, http.StatusOK, NewIntrospectionResponse(ti))
+}
+
+// introspectionAllowed RFC 7662 第4节，客户端只能查询自己的token，SetIntrospectionClients设置的资源服务可以查询所有token
+func introspectionAllowed(clientID string, ti oauth2.TokenInfo) bool {
+	if ti.GetClientID() == clientID {
+		return true
+	}
+	return introspectionClients != nil && introspectionClients(clientID)
+}
+
+// authenticateClient 支持basic认证和表单中的client_id、client_secret，返回认证通过的客户端
+func authenticateClient(r *http.Request) (string, bool) {
+	if err := r.ParseForm(); err != nil {
+		return "", false
+	}
+	clientID, secret, err := ClientBasicOrFormHandler(r)
+	if err != nil {
+		return "", false
+	}
+	cli, err := oauthServer.Manager.GetClient(r.Context(), clientID)
+	if err != nil || cli == nil {
+		return "", false
+	}
+	if verifier, ok := cli.(oauth2.ClientPasswordVerifier); ok {
+		return clientID, verifier.VerifyPassword(secret)
+	}
+	return clientID, cli.GetSecret() != "" && subtle.ConstantTimeCompare([]byte(cli.GetSecret()), []byte(secret)) == 1
+}
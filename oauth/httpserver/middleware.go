@@ -0,0 +1,129 @@
+package httpserver
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/errors"
+)
+
+type (
+	// ErrorHandleFunc 验证token出错时的处理
+	ErrorHandleFunc func(w http.ResponseWriter, r *http.Request, err error)
+	// Config 验证token中间件的配置
+	Config struct {
+		// 验证出错时的处理，默认按RFC 6750 输出
+		ErrorHandleFunc ErrorHandleFunc
+		// 返回true时跳过验证
+		Skipper func(r *http.Request) bool
+		// 当前服务的resource，设置以后只接受audience中包含其中一个的token
+		Audience []string
+		// 按顺序获取token，为空时从Authorization和access_token参数获取
+		Extractors []TokenExtractor
+		// 按顺序尝试的认证方式，例如BearerAuthenticator、APIKeyAuthenticator，为空时只验证bearer token，
+		// 认证通过的调用方通过PrincipalFromContext获取，Audience只检查bearer token
+		Authenticators []Authenticator
+	}
+)
+
+// DefaultConfig 默认的中间件配置
+var DefaultConfig = Config{
+	ErrorHandleFunc: BearerErrorHandleFunc,
+}
+
+type tokenInfoKey struct{}
+
+// WithTokenInfo 把验证通过的token保存在ctx中
+func WithTokenInfo(ctx context.Context, ti oauth2.TokenInfo) context.Context {
+	return context.WithValue(ctx, tokenInfoKey{}, ti)
+}
+
+// TokenInfoFromContext 获取HandleTokenVerify验证通过的token
+func TokenInfoFromContext(ctx context.Context) (oauth2.TokenInfo, bool) {
+	ti, ok := ctx.Value(tokenInfoKey{}).(oauth2.TokenInfo)
+	return ti, ok && ti != nil
+}
+
+// VerifyFunc 验证请求中的token
+type VerifyFunc func(r *http.Request) (oauth2.TokenInfo, error)
+
+// HandleTokenVerify 验证token的中间件，验证通过的token通过TokenInfoFromContext获取，调用方通过PrincipalFromContext获取
+func HandleTokenVerify(config ...Config) func(http.Handler) http.Handler {
+	return HandleTokenVerifyWith(VerifyRequest, config...)
+}
+
+// HandleTokenVerifyWith 使用其他的验证方式，例如在独立的资源服务中访问授权服务验证，其他处理与HandleTokenVerify相同
+func HandleTokenVerifyWith(verify VerifyFunc, config ...Config) func(http.Handler) http.Handler {
+	cfg := DefaultConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.ErrorHandleFunc == nil {
+		cfg.ErrorHandleFunc = DefaultConfig.ErrorHandleFunc
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cfg.Skipper != nil && cfg.Skipper(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			r = WithTokenExtractors(r, cfg.Extractors...)
+			p, err := authenticate(r, verify, cfg)
+			if err != nil {
+				cfg.ErrorHandleFunc(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(WithTokenInfo(r.Context(), p.TokenInfo), p)))
+		})
+	}
+}
+
+// authenticate 设置了Authenticators时按顺序认证，否则使用verify验证bearer token
+func authenticate(r *http.Request, verify VerifyFunc, cfg Config) (*Principal, error) {
+	if len(cfg.Authenticators) > 0 {
+		p, err := Authenticate(r, cfg.Authenticators...)
+		if err != nil {
+			return nil, err
+		}
+		if p.Method == AuthMethodBearer {
+			if err = CheckAudience(p.TokenInfo, cfg.Audience); err != nil {
+				return nil, err
+			}
+		}
+		return p, nil
+	}
+	ti, err := verify(r)
+	if err == nil {
+		err = CheckAudience(ti, cfg.Audience)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewBearerPrincipal(ti), nil
+}
+
+// VerifyRequest 验证请求中的bearer token，并检查是否已被撤销
+func VerifyRequest(r *http.Request) (oauth2.TokenInfo, error) {
+	token, ok := BearerToken(r)
+	if !ok {
+		return nil, errors.ErrInvalidAccessToken
+	}
+	return VerifyAccessToken(r.Context(), token)
+}
+
+// VerifyAccessToken 验证token，并检查是否已被撤销，gRPC等非http的请求使用，没有启动授权服务时返回ErrServerNotStarted
+func VerifyAccessToken(ctx context.Context, token string) (oauth2.TokenInfo, error) {
+	if oauthServer == nil {
+		return nil, ErrServerNotStarted
+	}
+	ti, err := oauthServer.Manager.LoadAccessToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if err = validationAccessToken(ctx, ti); err != nil {
+		return nil, err
+	}
+	return ti, nil
+}
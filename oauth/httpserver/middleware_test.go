@@ -0,0 +1,92 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/manage"
+	"github.com/go-oauth2/oauth2/v4/models"
+	"github.com/go-oauth2/oauth2/v4/store"
+)
+
+func TestHandleTokenVerify(t *testing.T) {
+	manager := manage.NewDefaultManager()
+	manager.MustTokenStorage(store.NewMemoryTokenStore())
+	clientStore := store.NewClientStore()
+	_ = clientStore.Set("client1", &models.Client{ID: "client1", Secret: "secret1"})
+	_ = clientStore.Set("api", &models.Client{ID: "api", Secret: "secret2"})
+	manager.MapClientStorage(clientStore)
+	InitServer(manager)
+
+	ti, err := manager.GenerateAccessToken(context.Background(), oauth2.ClientCredentials, &oauth2.TokenGenerateRequest{
+		ClientID:     "client1",
+		ClientSecret: "secret1",
+		Scope:        "read resource:https://api.example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, exists := TokenInfoFromContext(r.Context()); !exists {
+			t.Error("token not in context")
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/read", HandleTokenVerify(Config{Audience: []string{"https://api.example.com"}})(RequireScopes("read")(ok)))
+	mux.Handle("/write", HandleTokenVerify()(RequireScopes("write")(ok)))
+	mux.Handle("/other", HandleTokenVerify(Config{Audience: []string{"https://other.example.com"}})(ok))
+	mux.HandleFunc("/introspect", HandleIntrospectionRequest)
+
+	for path, status := range map[string]int{"/read": http.StatusOK, "/write": http.StatusForbidden, "/other": http.StatusUnauthorized} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+ti.GetAccess())
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != status {
+			t.Fatalf("%s: unexpected status %d", path, w.Code)
+		}
+	}
+
+	introspect := func(clientID, secret string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/introspect", strings.NewReader(url.Values{"token": {ti.GetAccess()}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(clientID, secret)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	if w := introspect("client1", "wrong"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+	resp := &IntrospectionResponse{}
+	if err = json.NewDecoder(introspect("client1", "secret1").Body).Decode(resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Active || resp.Scope != "read" || len(resp.Audience) != 1 || resp.ClientID != "client1" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+
+	//其他客户端不能查询，设置为资源服务以后可以查询
+	resp = &IntrospectionResponse{}
+	_ = json.NewDecoder(introspect("api", "secret2").Body).Decode(resp)
+	if resp.Active || resp.Subject != "" || resp.Scope != "" {
+		t.Fatalf("token of another client introspected: %+v", resp)
+	}
+	SetIntrospectionClients(func(clientID string) bool {
+		return clientID == "api"
+	})
+	defer SetIntrospectionClients(nil)
+	resp = &IntrospectionResponse{}
+	_ = json.NewDecoder(introspect("api", "secret2").Body).Decode(resp)
+	if !resp.Active || resp.ClientID != "client1" {
+		t.Fatalf("resource server introspection rejected: %+v", resp)
+	}
+}
@@ -0,0 +1,86 @@
+package httpserver
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-oauth2/oauth2/v4"
+)
+
+// TokenScopes token的scope列表，不包含audience
+func TokenScopes(ti oauth2.TokenInfo) []string {
+	if ti == nil {
+		return nil
+	}
+	scope, _ := SplitAudience(ti.GetScope())
+	return strings.Fields(scope)
+}
+
+// HasScope token是否包含某个scope，设置SetScopeRegistry以后按注册的包含关系和通配符判断
+func HasScope(ti oauth2.TokenInfo, scope string) bool {
+	if scopeRegistry != nil {
+		return scopeRegistry.Allows(TokenScopes(ti), scope)
+	}
+	for _, one := range TokenScopes(ti) {
+		if one == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAllScopes token是否包含所有的scope
+func HasAllScopes(ti oauth2.TokenInfo, scopes ...string) bool {
+	for _, scope := range scopes {
+		if !HasScope(ti, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// HasAnyScope token是否至少包含其中一个scope，scopes为空时返回true
+func HasAnyScope(ti oauth2.TokenInfo, scopes ...string) bool {
+	for _, scope := range scopes {
+		if HasScope(ti, scope) {
+			return true
+		}
+	}
+	return len(scopes) == 0
+}
+
+// RequireScopes token必须包含所有的scope，前面没有HandleTokenVerify时会先验证token
+func RequireScopes(all ...string) func(http.Handler) http.Handler {
+	return requireScopes(all, func(ti oauth2.TokenInfo) bool {
+		return HasAllScopes(ti, all...)
+	})
+}
+
+// RequireAnyScope token至少包含其中一个scope，前面没有HandleTokenVerify时会先验证token
+func RequireAnyScope(any ...string) func(http.Handler) http.Handler {
+	return requireScopes(any, func(ti oauth2.TokenInfo) bool {
+		return HasAnyScope(ti, any...)
+	})
+}
+
+func requireScopes(scopes []string, allowed func(ti oauth2.TokenInfo) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ti, ok := TokenInfoFromContext(r.Context())
+			if !ok {
+				var err error
+				r = WithTokenExtractors(r, DefaultConfig.Extractors...)
+				if ti, err = VerifyRequest(r); err != nil {
+					DefaultConfig.ErrorHandleFunc(w, r, err)
+					return
+				}
+				r = r.WithContext(WithTokenInfo(r.Context(), ti))
+			}
+			if !allowed(ti) {
+				DefaultConfig.ErrorHandleFunc(w, r, InsufficientScopeError(scopes...))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
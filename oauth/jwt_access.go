@@ -0,0 +1,145 @@
+package oauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/tianlin0/go-plat-oauth/oauth/ginserver"
+	"github.com/tianlin0/go-plat-startupcfg/startupcfg"
+)
+
+// JWTAccessOption 使用JWT格式的access token，资源服务可以通过/oauth2/jwks中的公钥在本地验证
+type JWTAccessOption struct {
+	Issuer        string            //token的签发方
+	SigningMethod jwt.SigningMethod //签名方式，默认RSA密钥为RS256，ECDSA密钥为ES256
+	SigningKey    crypto.Signer     //签名的私钥，只支持*rsa.PrivateKey和*ecdsa.PrivateKey
+	KeyID         string            //签名密钥的kid
+}
+
+// jwtAccessGenerate 生成JWT格式的access token，refresh token与默认方式相同
+type jwtAccessGenerate struct {
+	opt JWTAccessOption
+}
+
+// checkJWTAccessStore mysql和postgres的access字段为VARCHAR(255)，放不下JWT，需要设置TokenHashOption只保存HMAC
+func checkJWTAccessStore(driverName string, hashed bool) error {
+	if hashed {
+		return nil
+	}
+	if driverName == string(startupcfg.DriverMysql) || driverName == driverPostgres {
+		return fmt.Errorf("jwt access token does not fit the %s access column, set TokenHashOption", driverName)
+	}
+	return nil
+}
+
+func newJWTAccessGenerate(opt *JWTAccessOption) (*jwtAccessGenerate, error) {
+	g := &jwtAccessGenerate{opt: *opt}
+	switch opt.SigningKey.(type) {
+	case *rsa.PrivateKey:
+		if g.opt.SigningMethod == nil {
+			g.opt.SigningMethod = jwt.SigningMethodRS256
+		}
+		if !strings.HasPrefix(g.opt.SigningMethod.Alg(), "RS") && !strings.HasPrefix(g.opt.SigningMethod.Alg(), "PS") {
+			return nil, fmt.Errorf("signing method %s does not match rsa key", g.opt.SigningMethod.Alg())
+		}
+	case *ecdsa.PrivateKey:
+		if g.opt.SigningMethod == nil {
+			g.opt.SigningMethod = jwt.SigningMethodES256
+		}
+		if !strings.HasPrefix(g.opt.SigningMethod.Alg(), "ES") {
+			return nil, fmt.Errorf("signing method %s does not match ecdsa key", g.opt.SigningMethod.Alg())
+		}
+	default:
+		return nil, fmt.Errorf("unsupported signing key %T", opt.SigningKey)
+	}
+	return g, nil
+}
+
+// Token 生成token，scope中的audience放到aud中
+func (g *jwtAccessGenerate) Token(_ context.Context, data *oauth2.GenerateBasic, isGenRefresh bool) (string, string, error) {
+	scope, audience := ginserver.SplitAudience(data.TokenInfo.GetScope())
+	createAt := data.TokenInfo.GetAccessCreateAt()
+	claims := jwt.MapClaims{
+		"sub":       data.UserID,
+		"client_id": data.Client.GetID(),
+		"iat":       createAt.Unix(),
+		"jti":       uuid.NewString(),
+	}
+	if g.opt.Issuer != "" {
+		claims["iss"] = g.opt.Issuer
+	}
+	if scope != "" {
+		claims["scope"] = scope
+	}
+	if len(audience) > 0 {
+		claims["aud"] = audience
+	}
+	if data.TokenInfo.GetAccessExpiresIn() > 0 {
+		claims["exp"] = createAt.Add(data.TokenInfo.GetAccessExpiresIn()).Unix()
+	}
+	token := jwt.NewWithClaims(g.opt.SigningMethod, claims)
+	if g.opt.KeyID != "" {
+		token.Header["kid"] = g.opt.KeyID
+	}
+	access, err := token.SignedString(g.opt.SigningKey)
+	if err != nil {
+		return "", "", err
+	}
+	refresh := ""
+	if isGenRefresh {
+		refresh = strings.ToUpper(strings.TrimRight(base64.URLEncoding.EncodeToString(
+			[]byte(uuid.NewSHA1(uuid.Must(uuid.NewRandom()), []byte(access)).String())), "="))
+	}
+	return access, refresh, nil
+}
+
+// jwk 签名公钥的JWK格式
+func (g *jwtAccessGenerate) jwk() map[string]interface{} {
+	key := map[string]interface{}{
+		"use": "sig",
+		"alg": g.opt.SigningMethod.Alg(),
+	}
+	if g.opt.KeyID != "" {
+		key["kid"] = g.opt.KeyID
+	}
+	encode := func(b []byte) string {
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	switch pub := g.opt.SigningKey.Public().(type) {
+	case *rsa.PublicKey:
+		key["kty"] = "RSA"
+		key["n"] = encode(pub.N.Bytes())
+		key["e"] = encode(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		key["kty"] = "EC"
+		key["crv"] = pub.Curve.Params().Name
+		key["x"] = encode(pub.X.FillBytes(make([]byte, size)))
+		key["y"] = encode(pub.Y.FillBytes(make([]byte, size)))
+	}
+	return key
+}
+
+// handleJWKS 输出签名公钥
+func (g *jwtAccessGenerate) handleJWKS(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []interface{}{g.jwk()}})
+}
+
+// startJWKSRoute 输出签名公钥
+func startJWKSRoute(auth *gin.RouterGroup, g *jwtAccessGenerate) {
+	auth.GET("/jwks", gin.WrapF(g.handleJWKS))
+}
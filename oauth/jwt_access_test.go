@@ -0,0 +1,158 @@
+package oauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"database/sql"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/models"
+	"github.com/tianlin0/go-plat-oauth/oauth/resource"
+)
+
+func TestJWTAccessGenerate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := newJWTAccessGenerate(&JWTAccessOption{Issuer: "https://auth.example.com", SigningKey: key, KeyID: "k1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	startJWKSRoute(router.Group("/oauth2"), g)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	ti := &models.Token{
+		ClientID:        "client1",
+		UserID:          "user1",
+		Scope:           "read resource:https://api.example.com",
+		AccessCreateAt:  time.Now(),
+		AccessExpiresIn: time.Hour,
+	}
+	access, refresh, err := g.Token(context.Background(), &oauth2.GenerateBasic{
+		Client:    &models.Client{ID: "client1"},
+		UserID:    "user1",
+		CreateAt:  ti.AccessCreateAt,
+		TokenInfo: ti,
+	}, true)
+	if err != nil || refresh == "" {
+		t.Fatalf("generate error %v", err)
+	}
+
+	//资源服务使用/oauth2/jwks中的公钥验证
+	v, err := resource.NewVerifier(resource.Option{JWKSURL: srv.URL + "/oauth2/jwks", Issuer: "https://auth.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := v.Verify(context.Background(), access)
+	if err != nil || got.GetUserID() != "user1" || got.GetScope() != ti.Scope {
+		t.Fatalf("unexpected token %v %v", got, err)
+	}
+}
+
+func TestJWTAccessSQLStore(t *testing.T) {
+	if err := checkJWTAccessStore("mysql", false); err == nil {
+		t.Fatal("expected error for mysql without token hash")
+	}
+	if err := checkJWTAccessStore(driverPostgres, false); err == nil {
+		t.Fatal("expected error for postgres without token hash")
+	}
+	if err := checkJWTAccessStore("mysql", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkJWTAccessStore("redis", false); err != nil {
+		t.Fatal(err)
+	}
+
+	//需要本地的数据库，例如OAUTH_TEST_MYSQL_DSN="user:pass@tcp(127.0.0.1:3306)/oauth"
+	sqlStores := []struct {
+		env      string
+		driver   string
+		newStore func(db *sql.DB) (oauth2.TokenStore, error)
+	}{
+		{"OAUTH_TEST_MYSQL_DSN", "mysql", func(db *sql.DB) (oauth2.TokenStore, error) {
+			return NewMysqlTokenStore(db, "oauth2_token_jwt_test", time.Minute)
+		}},
+		{"OAUTH_TEST_POSTGRES_DSN", driverPostgres, func(db *sql.DB) (oauth2.TokenStore, error) {
+			return NewPostgresTokenStore(db, "oauth2_token_jwt_test", time.Minute)
+		}},
+	}
+	for _, one := range sqlStores {
+		dsn := os.Getenv(one.env)
+		if dsn == "" {
+			continue
+		}
+		db, err := sql.Open(one.driver, dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		backend, err := one.newStore(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		issueJWTAccess(t, newHashedTokenStore(backend, &TokenHashOption{Pepper: "pepper"}))
+		_, _ = db.Exec("DROP TABLE oauth2_token_jwt_test")
+		_ = db.Close()
+	}
+	issueJWTAccess(t, newHashedTokenStore(mustMemoryTokenStore(t), &TokenHashOption{Pepper: "pepper"}))
+}
+
+func mustMemoryTokenStore(t *testing.T) *buntTokenStore {
+	ts, err := newMemoryTokenStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+// issueJWTAccess 生成RS256的JWT并写入存储，存储中只有HMAC
+func issueJWTAccess(t *testing.T, ts oauth2.TokenStore) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := newJWTAccessGenerate(&JWTAccessOption{Issuer: "https://auth.example.com", SigningKey: key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ti := &models.Token{
+		ClientID:         "client1",
+		UserID:           "user1",
+		Scope:            "read",
+		AccessCreateAt:   time.Now(),
+		AccessExpiresIn:  time.Hour,
+		RefreshCreateAt:  time.Now(),
+		RefreshExpiresIn: time.Hour,
+	}
+	access, refresh, err := g.Token(context.Background(), &oauth2.GenerateBasic{
+		Client:    &models.Client{ID: "client1"},
+		UserID:    "user1",
+		CreateAt:  ti.AccessCreateAt,
+		TokenInfo: ti,
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(access) <= 255 {
+		t.Fatalf("expected jwt longer than 255, got %d", len(access))
+	}
+	ti.Access, ti.Refresh = access, refresh
+	if err = ts.Create(context.Background(), ti); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ts.GetByAccess(context.Background(), access)
+	if err != nil || got == nil || got.GetAccess() != access {
+		t.Fatalf("jwt not found: %v", err)
+	}
+}
@@ -0,0 +1,329 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-oauth2/oauth2/v4/models"
+	"github.com/golang-jwt/jwt"
+	"github.com/tianlin0/go-plat-utils/utils/httputil"
+)
+
+// backChannelLogoutEvent https://openid.net/specs/openid-connect-backchannel-1_0.html#LogoutToken
+const backChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// LogoutClientInfo 支持退出登录通知的客户端，ClientStore返回的客户端实现了该接口才会收到通知
+type LogoutClientInfo interface {
+	GetPostLogoutRedirectURIs() []string //退出以后允许跳转的地址
+	GetBackChannelLogoutURI() string     //服务端通知地址，POST logout_token
+	GetFrontChannelLogoutURI() string    //浏览器通知地址，以iframe方式加载
+}
+
+// LogoutClient 带有退出登录配置的客户端
+type LogoutClient struct {
+	models.Client
+	PostLogoutRedirectURIs []string
+	BackChannelLogoutURI   string
+	FrontChannelLogoutURI  string
+}
+
+// GetPostLogoutRedirectURIs 退出以后允许跳转的地址
+func (c *LogoutClient) GetPostLogoutRedirectURIs() []string {
+	return c.PostLogoutRedirectURIs
+}
+
+// GetBackChannelLogoutURI 服务端通知地址
+func (c *LogoutClient) GetBackChannelLogoutURI() string {
+	return c.BackChannelLogoutURI
+}
+
+// GetFrontChannelLogoutURI 浏览器通知地址
+func (c *LogoutClient) GetFrontChannelLogoutURI() string {
+	return c.FrontChannelLogoutURI
+}
+
+// LogoutOption 退出登录配置
+type LogoutOption struct {
+	Issuer        string            //logout_token的签发方，为空时使用当前请求的地址
+	SigningMethod jwt.SigningMethod //logout_token的签名方式，默认为HS256
+	SigningKey    interface{}       //签名的密钥，为空时使用客户端的secret
+	KeyID         string            //签名密钥的kid
+	HTTPClient    *http.Client      //服务端通知使用的http客户端，默认5秒超时
+}
+
+// logoutHandler 退出登录的处理
+type logoutHandler struct {
+	opt       LogoutOption
+	sessions  *sessionManager
+	revoker   *TokenRevoker //未开启撤销时为空，退出登录不撤销token
+	getClient func(ctx context.Context, clientID string) (LogoutClientInfo, string, error)
+}
+
+func newLogoutHandler(oauthConfig *GinOauthOption, stores *oauthStores) *logoutHandler {
+	h := &logoutHandler{
+		sessions: stores.sessions,
+		revoker:  defaultTokenRevoker,
+	}
+	if oauthConfig.LogoutOption != nil {
+		h.opt = *oauthConfig.LogoutOption
+	}
+	if h.opt.SigningMethod == nil {
+		h.opt.SigningMethod = jwt.SigningMethodHS256
+	}
+	if h.opt.HTTPClient == nil {
+		h.opt.HTTPClient = &http.Client{Timeout: 5 * time.Second}
+	}
+	h.getClient = func(ctx context.Context, clientID string) (LogoutClientInfo, string, error) {
+		cli, err := oauthConfig.ClientStore.GetByID(ctx, clientID)
+		if err != nil || cli == nil {
+			return nil, "", err
+		}
+		logoutClient, _ := cli.(LogoutClientInfo)
+		return logoutClient, cli.GetSecret(), nil
+	}
+	return h
+}
+
+// issuer 签发方
+func (h *logoutHandler) issuer(r *http.Request) string {
+	if h.opt.Issuer != "" {
+		return h.opt.Issuer
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// checkPostLogoutRedirectURI 退出以后的跳转地址必须是客户端登记过的
+func (h *logoutHandler) checkPostLogoutRedirectURI(ctx context.Context, clientID, redirectURI string) error {
+	if redirectURI == "" {
+		return nil
+	}
+	if clientID == "" {
+		return fmt.Errorf("client_id is required with post_logout_redirect_uri")
+	}
+	logoutClient, _, err := h.getClient(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	if logoutClient != nil {
+		for _, one := range logoutClient.GetPostLogoutRedirectURIs() {
+			if one == redirectURI {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("post_logout_redirect_uri is not registered")
+}
+
+// logoutToken 生成服务端通知的logout_token
+func (h *logoutHandler) logoutToken(r *http.Request, session *Session, clientID, clientSecret string) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":    h.issuer(r),
+		"sub":    session.UserID,
+		"aud":    clientID,
+		"iat":    now.Unix(),
+		"exp":    now.Add(2 * time.Minute).Unix(),
+		"jti":    randomString(16),
+		"sid":    session.ID,
+		"events": map[string]interface{}{backChannelLogoutEvent: map[string]interface{}{}},
+	}
+	token := jwt.NewWithClaims(h.opt.SigningMethod, claims)
+	if h.opt.KeyID != "" {
+		token.Header["kid"] = h.opt.KeyID
+	}
+	key := h.opt.SigningKey
+	if key == nil {
+		key = []byte(clientSecret)
+	}
+	return token.SignedString(key)
+}
+
+// backChannelLogout 并发通知所有客户端，等待全部完成
+func (h *logoutHandler) backChannelLogout(r *http.Request, session *Session) {
+	var wg sync.WaitGroup
+	for _, clientID := range session.Clients {
+		logoutClient, clientSecret, err := h.getClient(r.Context(), clientID)
+		if err != nil || logoutClient == nil || logoutClient.GetBackChannelLogoutURI() == "" {
+			continue
+		}
+		logoutToken, err := h.logoutToken(r, session, clientID, clientSecret)
+		if err != nil {
+			log.Println("logout token error:", clientID, err)
+			continue
+		}
+
+		wg.Add(1)
+		go func(clientID, logoutURI, logoutToken string) {
+			defer wg.Done()
+			resp, err := h.opt.HTTPClient.PostForm(logoutURI, url.Values{"logout_token": {logoutToken}})
+			if err != nil {
+				log.Println("back-channel logout error:", clientID, err)
+				return
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+				log.Println("back-channel logout status:", clientID, resp.StatusCode)
+			}
+		}(clientID, logoutClient.GetBackChannelLogoutURI(), logoutToken)
+	}
+	wg.Wait()
+}
+
+// frontChannelLogoutURIs 需要在浏览器中加载的通知地址
+func (h *logoutHandler) frontChannelLogoutURIs(r *http.Request, session *Session) []string {
+	uris := make([]string, 0)
+	for _, clientID := range session.Clients {
+		logoutClient, _, err := h.getClient(r.Context(), clientID)
+		if err != nil || logoutClient == nil || logoutClient.GetFrontChannelLogoutURI() == "" {
+			continue
+		}
+		u, err := url.Parse(logoutClient.GetFrontChannelLogoutURI())
+		if err != nil {
+			continue
+		}
+		q := u.Query()
+		q.Set("iss", h.issuer(r))
+		q.Set("sid", session.ID)
+		u.RawQuery = q.Encode()
+		uris = append(uris, u.String())
+	}
+	return uris
+}
+
+var frontChannelLogoutTemplate = template.Must(template.New("logout").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Logout</title></head>
+<body>
+{{range .URIs}}<iframe src="{{.}}" style="display:none"></iframe>
+{{end}}{{if .RedirectURI}}<script>window.onload = function () { window.location.href = "{{.RedirectURI}}"; };</script>{{end}}
+</body></html>`))
+
+var logoutConfirmTemplate = template.Must(template.New("logout_confirm").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Logout</title></head>
+<body>
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+{{if .ClientID}}<input type="hidden" name="client_id" value="{{.ClientID}}">
+{{end}}{{if .RedirectURI}}<input type="hidden" name="post_logout_redirect_uri" value="{{.RedirectURI}}">
+{{end}}{{if .State}}<input type="hidden" name="state" value="{{.State}}">
+{{end}}<p>Do you want to log out?</p>
+<button type="submit">Log out</button>
+</form>
+</body></html>`))
+
+const logoutCSRFAction = "logout"
+
+// sameOrigin 浏览器带有Origin时必须与当前地址一致
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// confirmed 只有同源的POST并且带有会话的csrf_token时才退出，防止第三方页面强制用户退出
+func (h *logoutHandler) confirmed(r *http.Request, session *Session) bool {
+	return r.Method == http.MethodPost && sameOrigin(r) &&
+		h.sessions.checkCSRFToken(r, session, logoutCSRFAction)
+}
+
+// confirm 展示退出确认页面，用户确认以后带上csrf_token重新提交
+func (h *logoutHandler) confirm(c *gin.Context, session *Session, clientID, redirectURI string) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Frame-Options", "DENY")
+	c.Status(http.StatusOK)
+	_ = logoutConfirmTemplate.Execute(c.Writer, map[string]interface{}{
+		"Action":      c.Request.URL.Path,
+		"CSRFToken":   h.sessions.csrfToken(session, logoutCSRFAction),
+		"ClientID":    clientID,
+		"RedirectURI": redirectURI,
+		"State":       c.Request.FormValue("state"),
+	})
+}
+
+// Handle 退出登录: 用户确认以后删除会话，撤销通过该会话授权的token，通知各个客户端，最后跳转
+func (h *logoutHandler) Handle(c *gin.Context) {
+	r := c.Request
+	clientID := c.Request.FormValue("client_id")
+	redirectURI := c.Request.FormValue("post_logout_redirect_uri")
+
+	if err := h.checkPostLogoutRedirectURI(r.Context(), clientID, redirectURI); err != nil {
+		_ = httputil.WriteCommResponse(c.Writer, &httputil.CommResponse{
+			Code:    http.StatusBadRequest,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	session, err := h.sessions.Load(r)
+	if err != nil {
+		log.Println("logout load session error:", err)
+	}
+	if session != nil && !h.confirmed(r, session) {
+		h.confirm(c, session, clientID, redirectURI)
+		return
+	}
+
+	if redirectURI != "" {
+		if state := c.Request.FormValue("state"); state != "" {
+			if u, err := url.Parse(redirectURI); err == nil {
+				q := u.Query()
+				q.Set("state", state)
+				u.RawQuery = q.Encode()
+				redirectURI = u.String()
+			}
+		}
+	}
+
+	if err = h.sessions.Destroy(c.Writer, r, session); err != nil {
+		log.Println("logout destroy session error:", err)
+	}
+
+	frontChannelURIs := make([]string, 0)
+	if session != nil && h.revoker != nil {
+		//只撤销通过该会话授权的token，用户在其他设备上的token不受影响
+		if _, err = h.revoker.RevokeBySession(r.Context(), session.ID); err != nil {
+			log.Println("logout revoke token error:", session.ID, err)
+		}
+	}
+	if session != nil {
+		h.backChannelLogout(r, session)
+		frontChannelURIs = h.frontChannelLogoutURIs(r, session)
+	}
+
+	if len(frontChannelURIs) > 0 {
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.Header("Cache-Control", "no-store")
+		c.Status(http.StatusOK)
+		_ = frontChannelLogoutTemplate.Execute(c.Writer, map[string]interface{}{
+			"URIs":        frontChannelURIs,
+			"RedirectURI": redirectURI,
+		})
+		return
+	}
+	if redirectURI != "" {
+		c.Redirect(http.StatusFound, redirectURI)
+		return
+	}
+	_ = httputil.WriteCommResponse(c.Writer, &httputil.CommResponse{})
+}
+
+// startLogoutRoute RP发起的退出登录 end_session_endpoint，GET时只展示确认页面
+func startLogoutRoute(auth *gin.RouterGroup, oauthConfig *GinOauthOption, stores *oauthStores) {
+	h := newLogoutHandler(oauthConfig, stores)
+	auth.GET("/logout", h.Handle)
+	auth.POST("/logout", h.Handle)
+}
@@ -0,0 +1,97 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-oauth2/oauth2/v4/models"
+	"github.com/go-oauth2/oauth2/v4/store"
+	"github.com/golang-jwt/jwt"
+)
+
+func TestBackChannelLogout(t *testing.T) {
+	received := make(chan string, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.FormValue("logout_token")
+	}))
+	defer receiver.Close()
+
+	cli := &LogoutClient{
+		Client:               models.Client{ID: "client1", Secret: "secret1"},
+		BackChannelLogoutURI: receiver.URL,
+	}
+	h := newLogoutHandler(&GinOauthOption{LogoutOption: &LogoutOption{Issuer: "https://auth.example.com"}},
+		&oauthStores{})
+	h.getClient = func(_ context.Context, clientID string) (LogoutClientInfo, string, error) {
+		return cli, cli.Secret, nil
+	}
+
+	session := &Session{ID: "sid1", UserID: "user1", Clients: []string{"client1"}}
+	r := httptest.NewRequest(http.MethodGet, "/oauth2/logout", nil)
+	h.backChannelLogout(r, session)
+
+	logoutToken := <-received
+	token, err := jwt.Parse(logoutToken, func(*jwt.Token) (interface{}, error) {
+		return []byte("secret1"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if claims["sid"] != "sid1" || claims["sub"] != "user1" || claims["aud"] != "client1" {
+		t.Fatalf("unexpected claims: %v", claims)
+	}
+	if _, ok := claims["events"].(map[string]interface{})[backChannelLogoutEvent]; !ok {
+		t.Fatalf("missing logout event: %v", claims)
+	}
+}
+
+func TestLogoutConfirmation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c := newSessionTestClient(&SessionOption{Secret: []byte("secret")})
+	if _, err := c.authorize(""); err != nil {
+		t.Fatal(err)
+	}
+	session := c.session(t)
+	h := newLogoutHandler(&GinOauthOption{ClientStore: store.NewClientStore()}, &oauthStores{sessions: c.sessions})
+	router := gin.New()
+	router.GET("/oauth2/logout", h.Handle)
+	router.POST("/oauth2/logout", h.Handle)
+	logout := func(method string, form url.Values, origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/oauth2/logout", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		r.AddCookie(c.cookie)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	csrfToken := c.sessions.csrfToken(session, logoutCSRFAction)
+
+	//GET、没有或者错误的csrf_token、跨站的POST只展示确认页面，不退出
+	for _, w := range []*httptest.ResponseRecorder{
+		logout(http.MethodGet, nil, ""),
+		logout(http.MethodPost, nil, ""),
+		logout(http.MethodPost, url.Values{"csrf_token": {"wrong"}}, ""),
+		logout(http.MethodPost, url.Values{"csrf_token": {csrfToken}}, "https://evil.example.com"),
+	} {
+		if !strings.Contains(w.Body.String(), `name="csrf_token" value="`+csrfToken+`"`) {
+			t.Fatalf("confirmation page not shown: %s", w.Body.String())
+		}
+	}
+	if one, _ := c.sessions.store.Get(context.Background(), session.ID); one == nil {
+		t.Fatal("session destroyed without confirmation")
+	}
+
+	logout(http.MethodPost, url.Values{"csrf_token": {csrfToken}}, "http://example.com")
+	if one, _ := c.sessions.store.Get(context.Background(), session.ID); one != nil {
+		t.Fatal("session kept after confirmed logout")
+	}
+}
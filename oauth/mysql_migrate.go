@@ -0,0 +1,80 @@
+package oauth
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+const schemaMigrationsTableName = "oauth2_schema_migrations"
+
+// schemaMigration 表结构的一个版本，版本号从1开始递增，已经发布的版本不能修改，只能追加
+type schemaMigration struct {
+	version     int
+	description string
+	statements  func(tableName string) []string
+}
+
+// migrateMysqlTable 按版本依次执行未执行过的变更，执行记录保存在oauth2_schema_migrations中，
+// 多个实例同时启动时通过GET_LOCK保证只有一个实例执行
+func migrateMysqlTable(db *sql.DB, tableName string, migrations []schemaMigration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	var locked sql.NullInt64
+	if err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 30)", schemaMigrationsTableName).Scan(&locked); err != nil {
+		return err
+	}
+	if locked.Int64 != 1 {
+		return fmt.Errorf("migrate %s: get lock timeout", tableName)
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", schemaMigrationsTableName)
+	}()
+
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` ("+
+		"`table_name` VARCHAR(128) NOT NULL,"+
+		"`version` INT NOT NULL,"+
+		"`description` VARCHAR(255) NOT NULL DEFAULT '',"+
+		"`applied_at` BIGINT NOT NULL,"+
+		"PRIMARY KEY (`table_name`, `version`)"+
+		") DEFAULT CHARSET=utf8mb4", schemaMigrationsTableName))
+	if err != nil {
+		return err
+	}
+
+	var current sql.NullInt64
+	err = conn.QueryRowContext(ctx, fmt.Sprintf("SELECT MAX(`version`) FROM `%s` WHERE `table_name` = ?",
+		schemaMigrationsTableName), tableName).Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		if int64(migration.version) <= current.Int64 {
+			continue
+		}
+		for _, statement := range migration.statements(tableName) {
+			if _, err = conn.ExecContext(ctx, statement); err != nil {
+				return fmt.Errorf("migrate %s to version %d: %w", tableName, migration.version, err)
+			}
+		}
+		_, err = conn.ExecContext(ctx, fmt.Sprintf("INSERT INTO `%s` (`table_name`, `version`, `description`, `applied_at`) "+
+			"VALUES (?, ?, ?, ?)", schemaMigrationsTableName), tableName, migration.version, migration.description, time.Now().Unix())
+		if err != nil {
+			return err
+		}
+		log.Println("mysql migrate:", tableName, migration.version, migration.description)
+	}
+	return nil
+}
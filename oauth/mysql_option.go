@@ -0,0 +1,150 @@
+package oauth
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	mysql "github.com/go-oauth2/mysql/v4"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/tianlin0/go-plat-utils/conv"
+)
+
+const mysqlTLSConfigName = "go-plat-oauth"
+
+// MysqlOption mysql存储的配置，也可以通过TokenStoreConnect.Extend设置，
+// 对应的key为 tokenTable、sessionTable、revocationTable、tokenIndexTable、gcInterval、
+// maxOpenConns、maxIdleConns、connMaxLifetime，时间可以是秒数或者time.ParseDuration的格式，TLS的配置见TLSOption
+type MysqlOption struct {
+	TokenTable      string        //token的表名，默认为oauth2_token
+	SessionTable    string        //会话的表名，默认为oauth2_session
+	RevocationTable string        //撤销记录的表名，默认为oauth2_revocation
+	TokenIndexTable string        //token索引的表名，默认为oauth2_token_index
+	GCInterval      time.Duration //过期数据的清理间隔，默认为10分钟
+	MaxOpenConns    int           //最大连接数，默认50
+	MaxIdleConns    int           //最大空闲连接数，默认25
+	ConnMaxLifetime time.Duration //连接的最长使用时间，默认2小时
+	TLS             *TLSOption    //TLS配置
+}
+
+// extendInt 读取Extend中的数字配置，支持数字和字符串
+func extendInt(extend func(key string) (interface{}, bool), key string) int {
+	if extend == nil {
+		return 0
+	}
+	if value, ok := extend(key); ok {
+		n, _ := conv.Int64(value)
+		return int(n)
+	}
+	return 0
+}
+
+// extendDuration 读取Extend中的时间配置，数字表示秒
+func extendDuration(extend func(key string) (interface{}, bool), key string) time.Duration {
+	if extend == nil {
+		return 0
+	}
+	value, ok := extend(key)
+	if !ok {
+		return 0
+	}
+	switch v := value.(type) {
+	case time.Duration:
+		return v
+	case string:
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	n, _ := conv.Int64(value)
+	return time.Duration(n) * time.Second
+}
+
+// getMysqlOption 合并GinOauthOption.MysqlOption和Extend中的配置，MysqlOption优先
+func getMysqlOption(oauthConfig *GinOauthOption) *MysqlOption {
+	opt := &MysqlOption{}
+	if oauthConfig.MysqlOption != nil {
+		*opt = *oauthConfig.MysqlOption
+	}
+	var extend func(key string) (interface{}, bool)
+	if oauthConfig.TokenStoreConnect != nil {
+		extend = oauthConfig.TokenStoreConnect.Extend
+	}
+	tables := []struct {
+		value *string
+		key   string
+	}{
+		{&opt.TokenTable, "tokenTable"},
+		{&opt.SessionTable, "sessionTable"},
+		{&opt.RevocationTable, "revocationTable"},
+		{&opt.TokenIndexTable, "tokenIndexTable"},
+	}
+	for _, table := range tables {
+		if *table.value == "" {
+			*table.value = extendString(extend, table.key)
+		}
+	}
+	if opt.TokenTable == "" {
+		opt.TokenTable = "oauth2_token"
+	}
+	if opt.GCInterval <= 0 {
+		opt.GCInterval = extendDuration(extend, "gcInterval")
+	}
+	if opt.GCInterval <= 0 {
+		opt.GCInterval = 10 * time.Minute
+	}
+	if opt.MaxOpenConns <= 0 {
+		opt.MaxOpenConns = extendInt(extend, "maxOpenConns")
+	}
+	if opt.MaxIdleConns <= 0 {
+		opt.MaxIdleConns = extendInt(extend, "maxIdleConns")
+	}
+	if opt.ConnMaxLifetime <= 0 {
+		opt.ConnMaxLifetime = extendDuration(extend, "connMaxLifetime")
+	}
+	opt.TLS = getTLSOption(opt.TLS, extend)
+	return opt
+}
+
+// poolConfig 连接池配置，未配置的使用mysql.NewConfig的默认值
+func (opt *MysqlOption) poolConfig() *mysql.Config {
+	mysqlConfig := mysql.NewConfig("")
+	if opt.MaxOpenConns > 0 {
+		mysqlConfig.MaxOpenConns = opt.MaxOpenConns
+	}
+	if opt.MaxIdleConns > 0 {
+		mysqlConfig.MaxIdleConns = opt.MaxIdleConns
+	}
+	if opt.ConnMaxLifetime > 0 {
+		mysqlConfig.MaxLifetime = opt.ConnMaxLifetime
+	}
+	return mysqlConfig
+}
+
+// setConnPool 设置连接池
+func (opt *MysqlOption) setConnPool(db *sql.DB) {
+	mysqlConfig := opt.poolConfig()
+	db.SetMaxOpenConns(mysqlConfig.MaxOpenConns)
+	db.SetMaxIdleConns(mysqlConfig.MaxIdleConns)
+	db.SetConnMaxLifetime(mysqlConfig.MaxLifetime)
+}
+
+// mysqlConfig 开启TLS时注册TLS配置并修改dsn
+func (opt *MysqlOption) mysqlConfig(dsn string) (*mysql.Config, error) {
+	mysqlConfig := mysql.NewConfig(dsn)
+
+	tlsConfig, err := opt.TLS.tlsConfig()
+	if err != nil || tlsConfig == nil {
+		return mysqlConfig, err
+	}
+	cfg, err := mysqldriver.ParseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("mysql dsn: %w", err)
+	}
+	if err = mysqldriver.RegisterTLSConfig(mysqlTLSConfigName, tlsConfig); err != nil {
+		return nil, err
+	}
+	cfg.TLSConfig = mysqlTLSConfigName
+	mysqlConfig.DSN = cfg.FormatDSN()
+	return mysqlConfig, nil
+}
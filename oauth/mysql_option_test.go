@@ -0,0 +1,67 @@
+package oauth
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMysqlOption(t *testing.T) {
+	opt := getMysqlOption(&GinOauthOption{MysqlOption: &MysqlOption{
+		TokenTable:   "auth_token",
+		MaxOpenConns: 10,
+		TLS:          &TLSOption{Enable: true, ServerName: "mysql.internal"},
+	}})
+	if opt.TokenTable != "auth_token" || opt.GCInterval != 10*time.Minute {
+		t.Fatalf("unexpected option: %+v", opt)
+	}
+
+	mysqlConfig, err := opt.mysqlConfig("user:pass@tcp(127.0.0.1:3306)/oauth?charset=utf8mb4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool := opt.poolConfig(); pool.MaxOpenConns != 10 || pool.MaxIdleConns != 25 {
+		t.Fatalf("unexpected pool: %+v", pool)
+	}
+	if !strings.Contains(mysqlConfig.DSN, "tls="+mysqlTLSConfigName) {
+		t.Fatalf("tls not enabled in dsn: %s", mysqlConfig.DSN)
+	}
+
+	opt.TLS = &TLSOption{CertPEM: "cert without key"}
+	if _, err = opt.mysqlConfig("user:pass@tcp(127.0.0.1:3306)/oauth"); !errors.Is(err, errStoreConfig) {
+		t.Fatalf("expected tls config error, got %v", err)
+	}
+}
+
+func TestSetConnPool(t *testing.T) {
+	db, err := sql.Open("mysql", "user:pass@tcp(127.0.0.1:3306)/oauth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	(&MysqlOption{MaxOpenConns: 10}).setConnPool(db)
+	if n := db.Stats().MaxOpenConnections; n != 10 {
+		t.Fatalf("unexpected max open conns %d", n)
+	}
+	(&MysqlOption{}).setConnPool(db)
+	if n := db.Stats().MaxOpenConnections; n != 50 {
+		t.Fatalf("unexpected default max open conns %d", n)
+	}
+}
+
+func TestPostgresOption(t *testing.T) {
+	opt, err := getPostgresOption(&GinOauthOption{
+		MysqlOption:    &MysqlOption{TokenTable: "auth_token", MaxOpenConns: 10},
+		PostgresOption: &PostgresOption{MaxOpenConns: 20},
+	})
+	if err != nil || opt.TokenTable != "auth_token" || opt.MaxOpenConns != 20 {
+		t.Fatalf("unexpected option %+v %v", opt, err)
+	}
+	if _, err = getPostgresOption(&GinOauthOption{MysqlOption: &MysqlOption{TLS: &TLSOption{Enable: true}}}); !errors.Is(err, errStoreConfig) {
+		t.Fatal("expected tls error")
+	}
+}
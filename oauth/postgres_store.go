@@ -0,0 +1,374 @@
+package oauth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/models"
+	_ "github.com/lib/pq" //导入postgres驱动
+)
+
+// driverPostgres TokenStoreConnect.DriverName() 为该值时使用postgres存储
+const driverPostgres = "postgres"
+
+const (
+	defaultPostgresTokenTableName  = "oauth2_token"
+	defaultPostgresClientTableName = "oauth2_client"
+)
+
+// PostgresOption postgres存储的配置，未设置的字段使用MysqlOption和Extend中的配置，
+// TLS通过DSN中的sslmode、sslrootcert、sslcert、sslkey设置，不支持TLSOption。
+// 会话、撤销记录和token索引没有postgres的实现，使用内存存储，多个实例时需要设置RevocationStore等
+type PostgresOption struct {
+	TokenTable      string        //token的表名，默认为oauth2_token
+	GCInterval      time.Duration //过期数据的清理间隔，默认为10分钟
+	MaxOpenConns    int           //最大连接数，默认50
+	MaxIdleConns    int           //最大空闲连接数，默认25
+	ConnMaxLifetime time.Duration //连接的最长使用时间，默认2小时
+}
+
+// getPostgresOption 合并PostgresOption、MysqlOption和Extend中的配置，设置了TLSOption时返回错误
+func getPostgresOption(oauthConfig *GinOauthOption) (*MysqlOption, error) {
+	opt := getMysqlOption(oauthConfig)
+	if opt.TLS.enabled() {
+		return nil, fmt.Errorf("%w: postgres: TLSOption is not supported, set sslmode and sslrootcert in the DSN", errStoreConfig)
+	}
+	if p := oauthConfig.PostgresOption; p != nil {
+		if p.TokenTable != "" {
+			opt.TokenTable = p.TokenTable
+		}
+		if p.GCInterval > 0 {
+			opt.GCInterval = p.GCInterval
+		}
+		if p.MaxOpenConns > 0 {
+			opt.MaxOpenConns = p.MaxOpenConns
+		}
+		if p.MaxIdleConns > 0 {
+			opt.MaxIdleConns = p.MaxIdleConns
+		}
+		if p.ConnMaxLifetime > 0 {
+			opt.ConnMaxLifetime = p.ConnMaxLifetime
+		}
+	}
+	return opt, nil
+}
+
+// migratePostgresTable 与migrateMysqlTable相同，多个实例同时启动时通过pg_advisory_lock保证只有一个实例执行
+func migratePostgresTable(db *sql.DB, tableName string, migrations []schemaMigration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(schemaMigrationsTableName))
+	lockID := int64(h.Sum64() >> 1)
+	if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+	}()
+
+	_, err = conn.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS "%s" (`+
+		`"table_name" VARCHAR(128) NOT NULL,`+
+		`"version" INT NOT NULL,`+
+		`"description" VARCHAR(255) NOT NULL DEFAULT '',`+
+		`"applied_at" BIGINT NOT NULL,`+
+		`PRIMARY KEY ("table_name", "version"))`, schemaMigrationsTableName))
+	if err != nil {
+		return err
+	}
+
+	var current sql.NullInt64
+	err = conn.QueryRowContext(ctx, fmt.Sprintf(`SELECT MAX("version") FROM "%s" WHERE "table_name" = $1`,
+		schemaMigrationsTableName), tableName).Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		if int64(migration.version) <= current.Int64 {
+			continue
+		}
+		for _, statement := range migration.statements(tableName) {
+			if _, err = conn.ExecContext(ctx, statement); err != nil {
+				return fmt.Errorf("migrate %s to version %d: %w", tableName, migration.version, err)
+			}
+		}
+		_, err = conn.ExecContext(ctx, fmt.Sprintf(`INSERT INTO "%s" ("table_name", "version", "description", "applied_at") `+
+			`VALUES ($1, $2, $3, $4)`, schemaMigrationsTableName), tableName, migration.version, migration.description, time.Now().Unix())
+		if err != nil {
+			return err
+		}
+		log.Println("postgres migrate:", tableName, migration.version, migration.description)
+	}
+	return nil
+}
+
+// postgresTokenMigrations 表结构的版本
+var postgresTokenMigrations = []schemaMigration{
+	{version: 1, description: "create token table", statements: func(tableName string) []string {
+		return []string{
+			fmt.Sprintf(`CREATE TABLE IF NOT EXISTS "%s" (`+
+				`"id" BIGSERIAL PRIMARY KEY,`+
+				`"code" VARCHAR(255) NOT NULL DEFAULT '',`+
+				`"access" VARCHAR(255) NOT NULL DEFAULT '',`+
+				`"refresh" VARCHAR(255) NOT NULL DEFAULT '',`+
+				`"data" TEXT NOT NULL,`+
+				`"expired_at" BIGINT NOT NULL)`, tableName),
+			fmt.Sprintf(`CREATE INDEX IF NOT EXISTS "idx_%s_code" ON "%s" ("code")`, tableName, tableName),
+			fmt.Sprintf(`CREATE INDEX IF NOT EXISTS "idx_%s_access" ON "%s" ("access")`, tableName, tableName),
+			fmt.Sprintf(`CREATE INDEX IF NOT EXISTS "idx_%s_refresh" ON "%s" ("refresh")`, tableName, tableName),
+			fmt.Sprintf(`CREATE INDEX IF NOT EXISTS "idx_%s_expired_at" ON "%s" ("expired_at")`, tableName, tableName),
+		}
+	}},
+}
+
+// PostgresTokenStore token存储到postgres中，表结构与mysql存储相同
+type PostgresTokenStore struct {
+	db        *sql.DB
+	tableName string
+}
+
+// NewPostgresTokenStore tableName为空时默认为oauth2_token，gcInterval为过期数据的清理间隔，默认10分钟
+func NewPostgresTokenStore(db *sql.DB, tableName string, gcInterval time.Duration) (*PostgresTokenStore, error) {
+	if tableName == "" {
+		tableName = defaultPostgresTokenTableName
+	}
+	if gcInterval <= 0 {
+		gcInterval = 10 * time.Minute
+	}
+	s := &PostgresTokenStore{
+		db:        db,
+		tableName: tableName,
+	}
+	if err := migratePostgresTable(db, tableName, postgresTokenMigrations); err != nil {
+		return nil, err
+	}
+	go s.gc(gcInterval)
+	return s, nil
+}
+
+func (s *PostgresTokenStore) gc(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		_, err := s.db.Exec(fmt.Sprintf(`DELETE FROM "%s" WHERE "expired_at" <= $1 OR `+
+			`("code" = '' AND "access" = '' AND "refresh" = '')`, s.tableName), time.Now().Unix())
+		if err != nil {
+			log.Println("postgres token gc error:", err)
+		}
+	}
+}
+
+// Create create and store the new token information
+func (s *PostgresTokenStore) Create(ctx context.Context, info oauth2.TokenInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	var code, access, refresh string
+	var expiredAt int64
+	if code = info.GetCode(); code != "" {
+		expiredAt = info.GetCodeCreateAt().Add(info.GetCodeExpiresIn()).Unix()
+	} else {
+		access = info.GetAccess()
+		expiredAt = info.GetAccessCreateAt().Add(info.GetAccessExpiresIn()).Unix()
+		if refresh = info.GetRefresh(); refresh != "" {
+			expiredAt = info.GetRefreshCreateAt().Add(info.GetRefreshExpiresIn()).Unix()
+		}
+	}
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO "%s" ("code", "access", "refresh", "data", "expired_at") `+
+		`VALUES ($1, $2, $3, $4, $5)`, s.tableName), code, access, refresh, string(data), expiredAt)
+	return err
+}
+
+func (s *PostgresTokenStore) remove(ctx context.Context, column, value string) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`UPDATE "%s" SET "%s" = '' WHERE "%s" = $1`,
+		s.tableName, column, column), value)
+	return err
+}
+
+// RemoveByCode delete the authorization code
+func (s *PostgresTokenStore) RemoveByCode(ctx context.Context, code string) error {
+	return s.remove(ctx, "code", code)
+}
+
+// RemoveByAccess use the access token to delete the token information
+func (s *PostgresTokenStore) RemoveByAccess(ctx context.Context, access string) error {
+	return s.remove(ctx, "access", access)
+}
+
+// RemoveByRefresh use the refresh token to delete the token information
+func (s *PostgresTokenStore) RemoveByRefresh(ctx context.Context, refresh string) error {
+	return s.remove(ctx, "refresh", refresh)
+}
+
+func (s *PostgresTokenStore) get(ctx context.Context, column, value string) (oauth2.TokenInfo, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var data string
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT "data" FROM "%s" WHERE "%s" = $1 AND "expired_at" > $2 LIMIT 1`,
+		s.tableName, column), value, time.Now().Unix()).Scan(&data)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var tm models.Token
+	if err = json.Unmarshal([]byte(data), &tm); err != nil {
+		return nil, err
+	}
+	return &tm, nil
+}
+
+// GetByCode use the authorization code for token information data
+func (s *PostgresTokenStore) GetByCode(ctx context.Context, code string) (oauth2.TokenInfo, error) {
+	return s.get(ctx, "code", code)
+}
+
+// GetByAccess use the access token for token information data
+func (s *PostgresTokenStore) GetByAccess(ctx context.Context, access string) (oauth2.TokenInfo, error) {
+	return s.get(ctx, "access", access)
+}
+
+// GetByRefresh use the refresh token for token information data
+func (s *PostgresTokenStore) GetByRefresh(ctx context.Context, refresh string) (oauth2.TokenInfo, error) {
+	return s.get(ctx, "refresh", refresh)
+}
+
+// ScanTokens 按id的顺序查询未过期的token，cursor为上一批最后的id
+func (s *PostgresTokenStore) ScanTokens(ctx context.Context, cursor string, limit int) ([]oauth2.TokenInfo, string, error) {
+	lastID, _ := strconv.ParseInt(cursor, 10, 64)
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT "id", "data" FROM "%s" WHERE "id" > $1 AND "expired_at" > $2 `+
+		`ORDER BY "id" LIMIT $3`, s.tableName), lastID, time.Now().Unix(), limit)
+	if err != nil {
+		return nil, "", err
+	}
+	return scanTokenRows(rows, limit)
+}
+
+// PurgeTokens 分批查询未过期的token，删除满足条件的
+func (s *PostgresTokenStore) PurgeTokens(ctx context.Context, match func(ti oauth2.TokenInfo) bool) (int, error) {
+	count := 0
+	lastID := int64(0)
+	for {
+		rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT "id", "data" FROM "%s" WHERE "id" > $1 AND "expired_at" > $2 `+
+			`ORDER BY "id" LIMIT 500`, s.tableName), lastID, time.Now().Unix())
+		if err != nil {
+			return count, err
+		}
+		ids := make([]interface{}, 0)
+		n := 0
+		for rows.Next() {
+			var data string
+			if err = rows.Scan(&lastID, &data); err != nil {
+				_ = rows.Close()
+				return count, err
+			}
+			n++
+			if ti := parseStoredToken(data); ti != nil && match(ti) {
+				ids = append(ids, lastID)
+			}
+		}
+		_ = rows.Close()
+		if err = rows.Err(); err != nil {
+			return count, err
+		}
+
+		if len(ids) > 0 {
+			placeholders := make([]string, len(ids))
+			for i := range ids {
+				placeholders[i] = fmt.Sprintf("$%d", i+1)
+			}
+			_, err = s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM "%s" WHERE "id" IN (%s)`, s.tableName,
+				strings.Join(placeholders, ",")), ids...)
+			if err != nil {
+				return count, err
+			}
+			count += len(ids)
+		}
+		if n < 500 {
+			return count, nil
+		}
+	}
+}
+
+// postgresClientMigrations 表结构的版本
+var postgresClientMigrations = []schemaMigration{
+	{version: 1, description: "create client table", statements: func(tableName string) []string {
+		return []string{fmt.Sprintf(`CREATE TABLE IF NOT EXISTS "%s" (`+
+			`"id" VARCHAR(255) PRIMARY KEY,`+
+			`"secret" VARCHAR(255) NOT NULL DEFAULT '',`+
+			`"domain" VARCHAR(2048) NOT NULL DEFAULT '',`+
+			`"user_id" VARCHAR(255) NOT NULL DEFAULT '',`+
+			`"public" BOOLEAN NOT NULL DEFAULT FALSE)`, tableName)}
+	}},
+}
+
+// PostgresClientStore 客户端存储到postgres中
+type PostgresClientStore struct {
+	db        *sql.DB
+	tableName string
+}
+
+// NewPostgresClientStore tableName为空时默认为oauth2_client
+func NewPostgresClientStore(db *sql.DB, tableName string) (*PostgresClientStore, error) {
+	if tableName == "" {
+		tableName = defaultPostgresClientTableName
+	}
+	s := &PostgresClientStore{
+		db:        db,
+		tableName: tableName,
+	}
+	if err := migratePostgresTable(db, tableName, postgresClientMigrations); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// GetByID according to the ID for the client information
+func (s *PostgresClientStore) GetByID(ctx context.Context, id string) (oauth2.ClientInfo, error) {
+	cli := &models.Client{ID: id}
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT "secret", "domain", "user_id", "public" FROM "%s" WHERE "id" = $1`,
+		s.tableName), id).Scan(&cli.Secret, &cli.Domain, &cli.UserID, &cli.Public)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("client not found: %s", id)
+		}
+		return nil, err
+	}
+	return cli, nil
+}
+
+// Save 新增或者更新客户端
+func (s *PostgresClientStore) Save(ctx context.Context, info oauth2.ClientInfo) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO "%s" ("id", "secret", "domain", "user_id", "public") `+
+		`VALUES ($1, $2, $3, $4, $5) ON CONFLICT ("id") DO UPDATE SET "secret" = EXCLUDED."secret", `+
+		`"domain" = EXCLUDED."domain", "user_id" = EXCLUDED."user_id", "public" = EXCLUDED."public"`, s.tableName),
+		info.GetID(), info.GetSecret(), info.GetDomain(), info.GetUserID(), info.IsPublic())
+	return err
+}
+
+// Remove 删除客户端
+func (s *PostgresClientStore) Remove(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM "%s" WHERE "id" = $1`, s.tableName), id)
+	return err
+}
@@ -0,0 +1,161 @@
+package oauth
+
+import (
+	"fmt"
+	"strings"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// redis的部署模式
+const (
+	RedisModeStandalone = "standalone" //单节点，也可以是twemproxy等代理，代理不支持multi
+	RedisModeSentinel   = "sentinel"   //哨兵模式，ServerAddress为哨兵的地址
+	RedisModeCluster    = "cluster"    //集群模式，ServerAddress为多个节点的地址
+)
+
+const defaultKeyNamespace = "{default-oauth}"
+
+// RedisOption redis连接的特殊配置，也可以通过TokenStoreConnect.Extend设置，
+// 对应的key为 redisMode、masterName、sentinelAddrs、sentinelUser、sentinelPassword、keyNameSpace，TLS的配置见TLSOption
+type RedisOption struct {
+	Mode             string     //部署模式，默认为standalone
+	Addrs            []string   //节点地址，为空时使用TokenStoreConnect.ServerAddress，多个地址以逗号分隔
+	MasterName       string     //哨兵模式下的master名称
+	SentinelAddrs    []string   //哨兵的地址，为空时使用Addrs
+	SentinelUser     string     //哨兵的用户名
+	SentinelPassword string     //哨兵的密码
+	KeyNamespace     string     //key的前缀，集群模式下会加上{}，保证同一个token的key在同一个分片
+	TLS              *TLSOption //TLS配置
+}
+
+// splitAddrs 逗号分隔的地址
+func splitAddrs(addrs string) []string {
+	list := make([]string, 0)
+	for _, one := range strings.Split(addrs, ",") {
+		if one = strings.TrimSpace(one); one != "" {
+			list = append(list, one)
+		}
+	}
+	return list
+}
+
+// extendString 读取Extend中的字符串配置
+func extendString(extend func(key string) (interface{}, bool), key string) string {
+	if extend == nil {
+		return ""
+	}
+	if value, ok := extend(key); ok {
+		if str, ok := value.(string); ok {
+			return str
+		}
+	}
+	return ""
+}
+
+// extendStrings 读取Extend中的地址列表，支持[]string和逗号分隔的字符串
+func extendStrings(extend func(key string) (interface{}, bool), key string) []string {
+	if extend == nil {
+		return nil
+	}
+	value, ok := extend(key)
+	if !ok {
+		return nil
+	}
+	switch v := value.(type) {
+	case []string:
+		return v
+	case string:
+		return splitAddrs(v)
+	}
+	return nil
+}
+
+// getRedisOption 合并GinOauthOption.RedisOption和Extend中的配置，RedisOption优先
+func getRedisOption(oauthConfig *GinOauthOption) *RedisOption {
+	opt := &RedisOption{}
+	if oauthConfig.RedisOption != nil {
+		*opt = *oauthConfig.RedisOption
+	}
+	conn := oauthConfig.TokenStoreConnect
+	extend := conn.Extend
+	if opt.Mode == "" {
+		opt.Mode = extendString(extend, "redisMode")
+	}
+	if len(opt.Addrs) == 0 {
+		opt.Addrs = splitAddrs(conn.ServerAddress())
+	}
+	if opt.MasterName == "" {
+		opt.MasterName = extendString(extend, "masterName")
+	}
+	if len(opt.SentinelAddrs) == 0 {
+		opt.SentinelAddrs = extendStrings(extend, "sentinelAddrs")
+	}
+	if opt.SentinelUser == "" {
+		opt.SentinelUser = extendString(extend, "sentinelUser")
+	}
+	if opt.SentinelPassword == "" {
+		opt.SentinelPassword = extendString(extend, "sentinelPassword")
+	}
+	if opt.KeyNamespace == "" {
+		opt.KeyNamespace = extendString(extend, "keyNameSpace")
+	}
+	opt.TLS = getTLSOption(opt.TLS, extend)
+	return opt
+}
+
+// keyNamespace 集群模式下token、会话等多个key需要在同一个分片，所以前缀必须带有hash tag
+func (opt *RedisOption) keyNamespace() string {
+	ns := opt.KeyNamespace
+	if ns == "" {
+		return defaultKeyNamespace
+	}
+	if opt.Mode == RedisModeCluster && !strings.Contains(ns, "{") {
+		ns = "{" + ns + "}"
+	}
+	return ns
+}
+
+// newRedisClient 根据部署模式创建客户端，baseOpts中为账号、密码、库以及TLS等公共配置
+func newRedisClient(opt *RedisOption, baseOpts *redis.Options) (redis.UniversalClient, error) {
+	switch opt.Mode {
+	case "", RedisModeStandalone:
+		if len(opt.Addrs) > 0 {
+			baseOpts.Addr = opt.Addrs[0]
+		}
+		return redis.NewClient(baseOpts), nil
+	case RedisModeSentinel:
+		if opt.MasterName == "" {
+			return nil, fmt.Errorf("redis sentinel masterName is required")
+		}
+		sentinelAddrs := opt.SentinelAddrs
+		if len(sentinelAddrs) == 0 {
+			sentinelAddrs = opt.Addrs
+		}
+		if len(sentinelAddrs) == 0 {
+			return nil, fmt.Errorf("redis sentinel addrs is required")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       opt.MasterName,
+			SentinelAddrs:    sentinelAddrs,
+			SentinelUsername: opt.SentinelUser,
+			SentinelPassword: opt.SentinelPassword,
+			Username:         baseOpts.Username,
+			Password:         baseOpts.Password,
+			DB:               baseOpts.DB,
+			TLSConfig:        baseOpts.TLSConfig,
+		}), nil
+	case RedisModeCluster:
+		if len(opt.Addrs) == 0 {
+			return nil, fmt.Errorf("redis cluster addrs is required")
+		}
+		//集群模式不支持选择库
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     opt.Addrs,
+			Username:  baseOpts.Username,
+			Password:  baseOpts.Password,
+			TLSConfig: baseOpts.TLSConfig,
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown redis mode: %s", opt.Mode)
+}
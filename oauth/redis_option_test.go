@@ -0,0 +1,54 @@
+package oauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-oauth2/oauth2/v4/models"
+	redis "github.com/go-redis/redis/v8"
+)
+
+func TestRedisModes(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	for _, opt := range []*RedisOption{
+		{Mode: RedisModeStandalone, Addrs: []string{mr.Addr()}},
+		{Mode: RedisModeCluster, Addrs: []string{mr.Addr()}, KeyNamespace: "oauth"},
+	} {
+		cli, err := newRedisClient(opt, &redis.Options{})
+		if err != nil {
+			t.Fatal(opt.Mode, err)
+		}
+		ns := opt.keyNamespace()
+		if opt.Mode == RedisModeCluster && ns != "{oauth}" {
+			t.Fatalf("cluster namespace without hash tag: %s", ns)
+		}
+
+		ctx := context.Background()
+		tokenStore := newRedisTokenStore(cli, ns)
+		err = tokenStore.Create(ctx, &models.Token{
+			ClientID:        "client1",
+			Access:          "access-" + opt.Mode,
+			AccessCreateAt:  time.Now(),
+			AccessExpiresIn: time.Hour,
+		})
+		if err != nil {
+			t.Fatal(opt.Mode, err)
+		}
+		ti, err := tokenStore.GetByAccess(ctx, "access-"+opt.Mode)
+		if err != nil || ti == nil || ti.GetClientID() != "client1" {
+			t.Fatalf("%s: unexpected token %v %v", opt.Mode, ti, err)
+		}
+		_ = cli.Close()
+	}
+
+	if _, err = newRedisClient(&RedisOption{Mode: RedisModeSentinel}, &redis.Options{}); err == nil {
+		t.Fatal("sentinel without masterName should fail")
+	}
+}
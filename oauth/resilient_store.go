@@ -0,0 +1,407 @@
+package oauth
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+	redis "github.com/go-redis/redis/v8"
+	"github.com/tianlin0/go-plat-utils/utils/httputil"
+)
+
+// token存储连接失败时的启动方式
+const (
+	StoreStartupFallback  = "fallback"  //连接失败时使用内存存储，默认方式，配置错误时仍然启动失败
+	StoreStartupError     = "error"     //连接失败时启动失败
+	StoreStartupResilient = "resilient" //连接失败时仍然启动，后台重连
+)
+
+// 后端恢复以后，对不可用期间写入本地的token的处理方式
+const (
+	StoreRecoverReplay  = "replay"  //写入后端，默认方式
+	StoreRecoverDiscard = "discard" //丢弃，期间生成的token全部失效
+)
+
+// StoreOption token存储的容错配置，设置以后会在后台检查存储的状态，并在断开时重连
+type StoreOption struct {
+	StartupMode    string        //连接失败时的启动方式，默认为fallback
+	CheckInterval  time.Duration //检查和重连的间隔，默认5秒
+	Degrade        bool          //后端不可用时是否降级使用本地存储，否则直接返回错误
+	MaxLocalTokens int           //降级期间本地最多缓存的写操作数量，超过以后返回错误，默认10000
+	RecoverPolicy  string        //后端恢复以后本地写操作的处理方式，默认为replay
+}
+
+// StoreHealth token存储的状态
+type StoreHealth struct {
+	Healthy   bool      `json:"healthy"`              //后端是否可用
+	Degraded  bool      `json:"degraded"`             //是否正在使用本地存储
+	Buffered  int       `json:"buffered"`             //等待写入后端的操作数量
+	LastError string    `json:"last_error,omitempty"` //最近一次的错误
+	LastCheck time.Time `json:"last_check"`           //最近一次检查的时间
+}
+
+// ErrStoreUnavailable 后端不可用，并且本地缓存已满或者没有开启降级
+var ErrStoreUnavailable = fmt.Errorf("token store unavailable")
+
+// errStoreConfig 存储的配置错误，例如TLS配置错误，不论StartupMode都启动失败，不使用内存存储
+var errStoreConfig = fmt.Errorf("token store config error")
+
+// storeStartupFailed 连接存储出错时是否启动失败
+func storeStartupFailed(storeOption *StoreOption, err error) bool {
+	if err == nil {
+		return false
+	}
+	return errors.Is(err, errStoreConfig) || (storeOption != nil && storeOption.StartupMode == StoreStartupError)
+}
+
+// pendingStoreOp 降级期间的写操作，恢复以后按顺序写入后端
+type pendingStoreOp struct {
+	create oauth2.TokenInfo
+	remove func(ctx context.Context, ts oauth2.TokenStore) error
+}
+
+// resilientTokenStore 带有健康检查和降级的token存储
+type resilientTokenStore struct {
+	opt     StoreOption
+	connect func(ctx context.Context) (oauth2.TokenStore, error) //建立连接并创建存储
+	ping    func(ctx context.Context) error
+
+	lock      sync.RWMutex
+	primary   oauth2.TokenStore
+	healthy   bool
+	lastErr   error
+	lastCheck time.Time
+	local     *buntTokenStore
+	pending   []*pendingStoreOp
+}
+
+var defaultResilientStore *resilientTokenStore
+
+// GetStoreHealth 获取StartGinOAuthServer启动的服务所使用的token存储的状态，未设置StoreOption时返回false
+func GetStoreHealth() (StoreHealth, bool) {
+	if defaultResilientStore == nil {
+		return StoreHealth{}, false
+	}
+	return defaultResilientStore.Health(), true
+}
+
+// connectTokenStore 连接token存储，设置了StoreOption时返回带有健康检查的存储，
+// resilient模式下连接失败也会启动，并在后台重连
+func connectTokenStore(storeOption *StoreOption, connect func(ctx context.Context) (oauth2.TokenStore, error),
+	ping func(ctx context.Context) error) (oauth2.TokenStore, error) {
+	ts, err := connect(context.Background())
+	if storeOption == nil {
+		return ts, err
+	}
+	if err != nil && storeOption.StartupMode != StoreStartupResilient {
+		return nil, err
+	}
+	rs := newResilientTokenStore(storeOption, connect, ping)
+	rs.primary = ts
+	rs.healthy = err == nil
+	rs.lastErr = err
+	rs.lastCheck = time.Now()
+	defaultResilientStore = rs
+	go rs.run()
+	return rs, nil
+}
+
+func newResilientTokenStore(storeOption *StoreOption, connect func(ctx context.Context) (oauth2.TokenStore, error),
+	ping func(ctx context.Context) error) *resilientTokenStore {
+	rs := &resilientTokenStore{
+		opt:     *storeOption,
+		connect: connect,
+		ping:    ping,
+	}
+	if rs.opt.CheckInterval <= 0 {
+		rs.opt.CheckInterval = 5 * time.Second
+	}
+	if rs.opt.MaxLocalTokens <= 0 {
+		rs.opt.MaxLocalTokens = 10000
+	}
+	if rs.opt.RecoverPolicy == "" {
+		rs.opt.RecoverPolicy = StoreRecoverReplay
+	}
+	return rs
+}
+
+// Health 当前状态
+func (rs *resilientTokenStore) Health() StoreHealth {
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+	health := StoreHealth{
+		Healthy:   rs.healthy,
+		Degraded:  !rs.healthy && rs.opt.Degrade,
+		Buffered:  len(rs.pending),
+		LastCheck: rs.lastCheck,
+	}
+	if rs.lastErr != nil {
+		health.LastError = rs.lastErr.Error()
+	}
+	return health
+}
+
+func (rs *resilientTokenStore) run() {
+	ticker := time.NewTicker(rs.opt.CheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), rs.opt.CheckInterval)
+		rs.check(ctx)
+		cancel()
+	}
+}
+
+// check 检查后端状态，从不可用恢复时处理降级期间的写操作
+func (rs *resilientTokenStore) check(ctx context.Context) {
+	rs.lock.RLock()
+	primary := rs.primary
+	rs.lock.RUnlock()
+
+	var err error
+	if primary == nil {
+		primary, err = rs.connect(ctx)
+	} else {
+		err = rs.ping(ctx)
+	}
+
+	rs.lock.Lock()
+	rs.lastCheck = time.Now()
+	if err != nil {
+		if rs.healthy {
+			log.Println("token store unavailable:", err)
+		}
+		rs.healthy = false
+		rs.lastErr = err
+		rs.lock.Unlock()
+		return
+	}
+	rs.primary = primary
+	healthy := rs.healthy
+	rs.lock.Unlock()
+	if healthy {
+		return
+	}
+	if err = rs.recover(ctx, primary); err != nil {
+		log.Println("token store recover error:", err)
+		rs.lock.Lock()
+		rs.lastErr = err
+		rs.lock.Unlock()
+		return
+	}
+	log.Println("token store recovered")
+}
+
+// recover 按照恢复策略处理本地的写操作，不持有锁写入后端，写入期间新增的操作继续写入，
+// 全部写入以后在锁内切换为后端存储
+func (rs *resilientTokenStore) recover(ctx context.Context, primary oauth2.TokenStore) error {
+	replayed := 0
+	for {
+		rs.lock.Lock()
+		if rs.opt.RecoverPolicy != StoreRecoverReplay && len(rs.pending) > 0 {
+			log.Println("token store discard local operations:", len(rs.pending))
+			replayed = len(rs.pending)
+		}
+		ops := rs.pending[replayed:]
+		if len(ops) == 0 {
+			rs.pending = nil
+			rs.local = nil
+			rs.healthy = true
+			rs.lastErr = nil
+			rs.lock.Unlock()
+			return nil
+		}
+		rs.lock.Unlock()
+
+		for i, op := range ops {
+			var err error
+			if op.create != nil {
+				err = primary.Create(ctx, op.create)
+			} else {
+				err = op.remove(ctx, primary)
+			}
+			if err != nil {
+				rs.lock.Lock()
+				rs.pending = rs.pending[replayed+i:]
+				rs.lock.Unlock()
+				return err
+			}
+		}
+		replayed += len(ops)
+	}
+}
+
+// unavailableError 网络错误和超时才认为后端不可用，其他错误直接返回
+func unavailableError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, redis.ErrClosed)
+}
+
+// markDown 请求后端出现网络错误时标记为不可用，由后台检查恢复，返回是否标记
+func (rs *resilientTokenStore) markDown(err error) bool {
+	if !unavailableError(err) {
+		return false
+	}
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	if rs.healthy {
+		log.Println("token store unavailable:", err)
+	}
+	rs.healthy = false
+	rs.lastErr = err
+	return true
+}
+
+// backend 后端可用时返回后端的存储
+func (rs *resilientTokenStore) backend() oauth2.TokenStore {
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+	if rs.healthy {
+		return rs.primary
+	}
+	return nil
+}
+
+// write 降级期间写入本地存储，并记录到待写入列表
+func (rs *resilientTokenStore) write(ctx context.Context, op *pendingStoreOp) error {
+	if !rs.opt.Degrade {
+		return ErrStoreUnavailable
+	}
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	if len(rs.pending) >= rs.opt.MaxLocalTokens {
+		return ErrStoreUnavailable
+	}
+	if rs.local == nil {
+		local, err := newMemoryTokenStore()
+		if err != nil {
+			return err
+		}
+		rs.local = local
+	}
+	var err error
+	if op.create != nil {
+		err = rs.local.Create(ctx, op.create)
+	} else {
+		err = op.remove(ctx, rs.local)
+	}
+	if err != nil {
+		return err
+	}
+	rs.pending = append(rs.pending, op)
+	return nil
+}
+
+// read 降级期间从本地存储读取
+func (rs *resilientTokenStore) read(ctx context.Context, get func(ctx context.Context, ts oauth2.TokenStore) (oauth2.TokenInfo, error)) (oauth2.TokenInfo, error) {
+	if ts := rs.backend(); ts != nil {
+		ti, err := get(ctx, ts)
+		if err == nil || !rs.markDown(err) {
+			return ti, err
+		}
+		if !rs.opt.Degrade {
+			return nil, err
+		}
+	} else if !rs.opt.Degrade {
+		return nil, ErrStoreUnavailable
+	}
+
+	rs.lock.RLock()
+	local := rs.local
+	rs.lock.RUnlock()
+	if local == nil {
+		return nil, nil
+	}
+	return get(ctx, local)
+}
+
+// Create create and store the new token information
+func (rs *resilientTokenStore) Create(ctx context.Context, info oauth2.TokenInfo) error {
+	if ts := rs.backend(); ts != nil {
+		err := ts.Create(ctx, info)
+		if err == nil || !rs.markDown(err) {
+			return err
+		}
+	}
+	return rs.write(ctx, &pendingStoreOp{create: info})
+}
+
+func (rs *resilientTokenStore) remove(ctx context.Context, remove func(ctx context.Context, ts oauth2.TokenStore) error) error {
+	if ts := rs.backend(); ts != nil {
+		err := remove(ctx, ts)
+		if err == nil || !rs.markDown(err) {
+			return err
+		}
+	}
+	return rs.write(ctx, &pendingStoreOp{remove: remove})
+}
+
+// RemoveByCode use the authorization code to delete the token information
+func (rs *resilientTokenStore) RemoveByCode(ctx context.Context, code string) error {
+	return rs.remove(ctx, func(ctx context.Context, ts oauth2.TokenStore) error {
+		return ts.RemoveByCode(ctx, code)
+	})
+}
+
+// RemoveByAccess use the access token to delete the token information
+func (rs *resilientTokenStore) RemoveByAccess(ctx context.Context, access string) error {
+	return rs.remove(ctx, func(ctx context.Context, ts oauth2.TokenStore) error {
+		return ts.RemoveByAccess(ctx, access)
+	})
+}
+
+// RemoveByRefresh use the refresh token to delete the token information
+func (rs *resilientTokenStore) RemoveByRefresh(ctx context.Context, refresh string) error {
+	return rs.remove(ctx, func(ctx context.Context, ts oauth2.TokenStore) error {
+		return ts.RemoveByRefresh(ctx, refresh)
+	})
+}
+
+// GetByCode use the authorization code for token information data
+func (rs *resilientTokenStore) GetByCode(ctx context.Context, code string) (oauth2.TokenInfo, error) {
+	return rs.read(ctx, func(ctx context.Context, ts oauth2.TokenStore) (oauth2.TokenInfo, error) {
+		return ts.GetByCode(ctx, code)
+	})
+}
+
+// GetByAccess use the access token for token information data
+func (rs *resilientTokenStore) GetByAccess(ctx context.Context, access string) (oauth2.TokenInfo, error) {
+	return rs.read(ctx, func(ctx context.Context, ts oauth2.TokenStore) (oauth2.TokenInfo, error) {
+		return ts.GetByAccess(ctx, access)
+	})
+}
+
+// GetByRefresh use the refresh token for token information data
+func (rs *resilientTokenStore) GetByRefresh(ctx context.Context, refresh string) (oauth2.TokenInfo, error) {
+	return rs.read(ctx, func(ctx context.Context, ts oauth2.TokenStore) (oauth2.TokenInfo, error) {
+		return ts.GetByRefresh(ctx, refresh)
+	})
+}
+
+// startHealthRoute token存储的状态，不可用并且没有降级时返回503
+func startHealthRoute(auth *gin.RouterGroup) {
+	auth.GET("/health", func(c *gin.Context) {
+		health, ok := GetStoreHealth()
+		if !ok {
+			_ = httputil.WriteCommResponse(c.Writer, &httputil.CommResponse{})
+			return
+		}
+		resp := &httputil.CommResponse{Data: health}
+		if !health.Healthy && !health.Degraded {
+			resp.Code = http.StatusServiceUnavailable
+			resp.Message = ErrStoreUnavailable.Error()
+		}
+		_ = httputil.WriteCommResponse(c.Writer, resp)
+	})
+}
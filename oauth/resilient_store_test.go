@@ -0,0 +1,160 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/models"
+	redis "github.com/go-redis/redis/v8"
+)
+
+func TestResilientTokenStore(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	defer func() {
+		_ = cli.Close()
+	}()
+	ts, err := connectTokenStore(&StoreOption{Degrade: true, CheckInterval: time.Hour},
+		func(ctx context.Context) (oauth2.TokenStore, error) {
+			return newRedisTokenStore(cli, defaultKeyNamespace), cli.Ping(ctx).Err()
+		}, func(ctx context.Context) error {
+			return cli.Ping(ctx).Err()
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := ts.(*resilientTokenStore)
+
+	ctx := context.Background()
+	newToken := func(access string) *models.Token {
+		return &models.Token{ClientID: "client1", Access: access, AccessCreateAt: time.Now(), AccessExpiresIn: time.Hour}
+	}
+
+	mr.Close()
+	if err = rs.Create(ctx, newToken("access1")); err != nil {
+		t.Fatal(err)
+	}
+	health := rs.Health()
+	if health.Healthy || !health.Degraded || health.Buffered != 1 {
+		t.Fatalf("unexpected health: %+v", health)
+	}
+	if ti, err := rs.GetByAccess(ctx, "access1"); err != nil || ti == nil {
+		t.Fatalf("degraded read failed: %v %v", ti, err)
+	}
+
+	if err = mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	rs.check(ctx)
+	if health = rs.Health(); !health.Healthy || health.Buffered != 0 {
+		t.Fatalf("unexpected health after recover: %+v", health)
+	}
+	if ti, err := newRedisTokenStore(cli, defaultKeyNamespace).GetByAccess(ctx, "access1"); err != nil || ti == nil {
+		t.Fatalf("token not replayed: %v %v", ti, err)
+	}
+}
+
+// blockingTokenStore 写入时等待release，用于检查重放期间不持有锁
+type blockingTokenStore struct {
+	oauth2.TokenStore
+	started chan struct{}
+	release chan struct{}
+	err     error
+}
+
+func (s *blockingTokenStore) Create(ctx context.Context, info oauth2.TokenInfo) error {
+	if s.started != nil {
+		s.started <- struct{}{}
+		<-s.release
+	}
+	if s.err != nil {
+		return s.err
+	}
+	return s.TokenStore.Create(ctx, info)
+}
+
+func TestResilientTokenStoreReplayUnlocked(t *testing.T) {
+	ctx := context.Background()
+	backend, err := newMemoryTokenStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary := &blockingTokenStore{TokenStore: backend, started: make(chan struct{}), release: make(chan struct{})}
+	rs := newResilientTokenStore(&StoreOption{Degrade: true},
+		func(ctx context.Context) (oauth2.TokenStore, error) { return primary, nil },
+		func(ctx context.Context) error { return nil })
+	rs.primary = primary
+	newToken := func(access string) *models.Token {
+		return &models.Token{ClientID: "client1", Access: access, AccessCreateAt: time.Now(), AccessExpiresIn: time.Hour}
+	}
+	if err = rs.Create(ctx, newToken("access1")); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		rs.check(ctx)
+		close(done)
+	}()
+	<-primary.started
+	//重放期间仍然可以读写本地存储
+	if err = rs.Create(ctx, newToken("access2")); err != nil {
+		t.Fatal(err)
+	}
+	if health := rs.Health(); health.Healthy || health.Buffered != 2 {
+		t.Fatalf("unexpected health during replay: %+v", health)
+	}
+	primary.release <- struct{}{}
+	<-primary.started
+	primary.release <- struct{}{}
+	<-done
+
+	if health := rs.Health(); !health.Healthy || health.Buffered != 0 {
+		t.Fatalf("unexpected health after recover: %+v", health)
+	}
+	for _, access := range []string{"access1", "access2"} {
+		if ti, err := backend.GetByAccess(ctx, access); err != nil || ti == nil {
+			t.Fatalf("token %s not replayed: %v %v", access, ti, err)
+		}
+	}
+}
+
+func TestResilientTokenStoreMarkDown(t *testing.T) {
+	ctx := context.Background()
+	backend, err := newMemoryTokenStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary := &blockingTokenStore{TokenStore: backend, err: fmt.Errorf("invalid token")}
+	rs := newResilientTokenStore(&StoreOption{Degrade: true},
+		func(ctx context.Context) (oauth2.TokenStore, error) { return primary, nil },
+		func(ctx context.Context) error { return nil })
+	rs.primary = primary
+	rs.healthy = true
+
+	//不是网络错误时直接返回，不降级
+	if err = rs.Create(ctx, &models.Token{ClientID: "client1", Access: "access1"}); err != primary.err {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if health := rs.Health(); !health.Healthy || health.Buffered != 0 {
+		t.Fatalf("store marked down by a non network error: %+v", health)
+	}
+
+	primary.err = &net.OpError{Op: "dial", Net: "tcp", Err: fmt.Errorf("connection refused")}
+	if err = rs.Create(ctx, &models.Token{ClientID: "client1", Access: "access1"}); err != nil {
+		t.Fatal(err)
+	}
+	if health := rs.Health(); health.Healthy || health.Buffered != 1 {
+		t.Fatalf("store not marked down by a network error: %+v", health)
+	}
+}
@@ -0,0 +1,53 @@
+package resource
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tianlin0/go-plat-oauth/oauth/httpserver"
+)
+
+// introspect 访问授权服务的/oauth2/introspect，失败时计入熔断
+func (v *Verifier) introspect(token string) (*httpserver.IntrospectionResponse, error) {
+	if !v.breaker.allow() {
+		return nil, ErrUnavailable
+	}
+	resp, err := v.postIntrospect(token)
+	v.breaker.done(err == nil)
+	if err != nil {
+		log.Println("token introspection error:", err)
+		return nil, ErrUnavailable
+	}
+	return resp, nil
+}
+
+func (v *Verifier) postIntrospect(token string) (*httpserver.IntrospectionResponse, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequest(http.MethodPost, v.opt.IntrospectionURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(v.opt.ClientID, v.opt.ClientSecret)
+
+	res, err := v.opt.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return nil, fmt.Errorf("introspection status %d", res.StatusCode)
+	}
+	resp := &httpserver.IntrospectionResponse{}
+	if err = json.NewDecoder(res.Body).Decode(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,229 @@
+package resource
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-oauth2/oauth2/v4/errors"
+	"github.com/golang-jwt/jwt"
+	"github.com/tianlin0/go-plat-oauth/oauth/httpserver"
+)
+
+// jwtMethods 只接受非对称签名，防止使用公钥作为HMAC密钥伪造
+var jwtMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// keySet 从授权服务获取的公钥
+type keySet struct {
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// jsonWebKey JWK中用到的字段
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// verifyJWT 在本地验证JWT，并转换为introspect的结果
+func (v *Verifier) verifyJWT(token string) (*httpserver.IntrospectionResponse, error) {
+	claims := jwt.MapClaims{}
+	parser := &jwt.Parser{ValidMethods: jwtMethods}
+	_, err := parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.publicKey(kid)
+	})
+	if err != nil {
+		if ve, ok := err.(*jwt.ValidationError); ok {
+			if ve.Inner == ErrUnavailable {
+				return nil, ErrUnavailable
+			}
+			if ve.Errors&jwt.ValidationErrorExpired != 0 {
+				return nil, errors.ErrExpiredAccessToken
+			}
+		}
+		return nil, errors.ErrInvalidAccessToken
+	}
+	if v.opt.Issuer != "" && !claims.VerifyIssuer(v.opt.Issuer, true) {
+		return nil, errors.ErrInvalidAccessToken
+	}
+	resp := &httpserver.IntrospectionResponse{Active: true, TokenType: "Bearer"}
+	resp.Subject, _ = claims["sub"].(string)
+	resp.ClientID, _ = claims["client_id"].(string)
+	resp.Scope, _ = claims["scope"].(string)
+	resp.ExpiresAt = numberClaim(claims["exp"])
+	resp.IssuedAt = numberClaim(claims["iat"])
+	switch aud := claims["aud"].(type) {
+	case string:
+		resp.Audience = []string{aud}
+	case []interface{}:
+		for _, one := range aud {
+			if s, ok := one.(string); ok {
+				resp.Audience = append(resp.Audience, s)
+			}
+		}
+	}
+	return resp, nil
+}
+
+func numberClaim(value interface{}) int64 {
+	switch n := value.(type) {
+	case float64:
+		return int64(n)
+	case json.Number:
+		i, _ := n.Int64()
+		return i
+	}
+	return 0
+}
+
+// publicKey 获取kid对应的公钥，过期或者找不到时重新获取
+func (v *Verifier) publicKey(kid string) (interface{}, error) {
+	key, found, fresh := v.keys.get(kid, v.opt.JWKSRefresh)
+	if found && fresh {
+		return key, nil
+	}
+	_, err := v.group.do("jwks", func() (interface{}, error) {
+		return nil, v.fetchKeys()
+	})
+	if err != nil {
+		//授权服务不可用时继续使用旧的公钥
+		if found {
+			return key, nil
+		}
+		return nil, err
+	}
+	if key, found, _ = v.keys.get(kid, v.opt.JWKSRefresh); !found {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+// get 没有kid时使用唯一的公钥
+func (s *keySet) get(kid string, refresh time.Duration) (crypto.PublicKey, bool, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	fresh := time.Since(s.fetchedAt) < refresh
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true, fresh
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok, fresh
+}
+
+// fetchKeys 访问授权服务的/oauth2/jwks，失败时计入熔断
+func (v *Verifier) fetchKeys() error {
+	//刚获取过的不再重复获取，防止未知的kid导致频繁请求
+	v.keys.mu.RLock()
+	recent := time.Since(v.keys.fetchedAt) < 10*time.Second
+	v.keys.mu.RUnlock()
+	if recent {
+		return nil
+	}
+	if !v.breaker.allow() {
+		return ErrUnavailable
+	}
+	keys, err := v.getKeys()
+	v.breaker.done(err == nil)
+	if err != nil {
+		log.Println("fetch jwks error:", err)
+		return ErrUnavailable
+	}
+	v.keys.mu.Lock()
+	v.keys.keys = keys
+	v.keys.fetchedAt = time.Now()
+	v.keys.mu.Unlock()
+	return nil
+}
+
+func (v *Verifier) getKeys() (map[string]crypto.PublicKey, error) {
+	res, err := v.opt.HTTPClient.Get(v.opt.JWKSURL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return nil, fmt.Errorf("jwks status %d", res.StatusCode)
+	}
+	set := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	if err = json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, one := range set.Keys {
+		key, err := one.publicKey()
+		if err != nil {
+			log.Println("jwks key", one.Kid, "error:", err)
+			continue
+		}
+		keys[one.Kid] = key
+	}
+	return keys, nil
+}
+
+// publicKey 只支持RSA和EC
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
@@ -0,0 +1,182 @@
+// Package resource 独立部署的资源服务验证token，通过授权服务的/oauth2/introspect或者/oauth2/jwks验证，
+// 不需要初始化授权服务
+package resource
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/errors"
+	"github.com/patrickmn/go-cache"
+	"github.com/tianlin0/go-plat-oauth/oauth/ginserver"
+	"github.com/tianlin0/go-plat-oauth/oauth/httpserver"
+)
+
+// ErrUnavailable 授权服务无法访问或者熔断中，返回503
+var ErrUnavailable = &httpserver.BearerError{
+	Status:      http.StatusServiceUnavailable,
+	Code:        "temporarily_unavailable",
+	Description: "the token verification service is unavailable",
+}
+
+// Option 资源服务的配置，IntrospectionURL和JWKSURL至少设置一个
+type Option struct {
+	IntrospectionURL string        //授权服务的/oauth2/introspect地址，可以及时发现已撤销的token
+	ClientID         string        //访问introspect使用的客户端，需要在授权服务的IntrospectionClients中
+	ClientSecret     string        //客户端的密钥
+	JWKSURL          string        //授权服务的/oauth2/jwks地址，设置以后JWT格式的token在本地验证，撤销要等到过期才生效
+	Issuer           string        //JWT的签发方，设置以后需要一致
+	CacheTTL         time.Duration //验证结果的缓存时间，默认1分钟，不超过token的过期时间
+	NegativeTTL      time.Duration //无效token的缓存时间，默认5秒，小于0时不缓存
+	JWKSRefresh      time.Duration //公钥的刷新间隔，默认1小时，出现未知的kid时也会刷新
+	HTTPClient       *http.Client  //访问授权服务的http客户端，默认5秒超时
+	FailureThreshold int           //连续失败多少次以后熔断，默认5次
+	OpenTimeout      time.Duration //熔断的时间，之后放一个请求尝试，默认30秒
+}
+
+// Verifier 资源服务的token验证
+type Verifier struct {
+	opt     Option
+	cache   *cache.Cache
+	group   *group
+	breaker *breaker
+	keys    *keySet
+}
+
+// cacheEntry 缓存的验证结果
+type cacheEntry struct {
+	resp *httpserver.IntrospectionResponse
+	err  error
+}
+
+// NewVerifier 创建验证
+func NewVerifier(opt Option) (*Verifier, error) {
+	if opt.IntrospectionURL == "" && opt.JWKSURL == "" {
+		return nil, fmt.Errorf("introspection url or jwks url is required")
+	}
+	if opt.CacheTTL <= 0 {
+		opt.CacheTTL = time.Minute
+	}
+	if opt.NegativeTTL == 0 {
+		opt.NegativeTTL = 5 * time.Second
+	}
+	if opt.JWKSRefresh <= 0 {
+		opt.JWKSRefresh = time.Hour
+	}
+	if opt.HTTPClient == nil {
+		opt.HTTPClient = &http.Client{Timeout: 5 * time.Second}
+	}
+	if opt.FailureThreshold <= 0 {
+		opt.FailureThreshold = 5
+	}
+	if opt.OpenTimeout <= 0 {
+		opt.OpenTimeout = 30 * time.Second
+	}
+	v := &Verifier{
+		opt:     opt,
+		cache:   cache.New(opt.CacheTTL, 2*opt.CacheTTL),
+		group:   &group{},
+		breaker: newBreaker(opt.FailureThreshold, opt.OpenTimeout),
+	}
+	if opt.JWKSURL != "" {
+		v.keys = &keySet{}
+	}
+	return v, nil
+}
+
+// Verify 验证token，相同的token同时只会请求一次授权服务
+func (v *Verifier) Verify(_ context.Context, token string) (oauth2.TokenInfo, error) {
+	if token == "" {
+		return nil, errors.ErrInvalidAccessToken
+	}
+	key := cacheKey(token)
+	if one, ok := v.cache.Get(key); ok {
+		entry := one.(*cacheEntry)
+		return tokenInfo(entry.resp, entry.err, token)
+	}
+	result, err := v.group.do(key, func() (interface{}, error) {
+		resp, err := v.lookup(token)
+		v.store(key, resp, err)
+		return resp, err
+	})
+	resp, _ := result.(*httpserver.IntrospectionResponse)
+	return tokenInfo(resp, err, token)
+}
+
+// VerifyRequest 验证请求中的bearer token，可以用于httpserver.HandleTokenVerifyWith
+func (v *Verifier) VerifyRequest(r *http.Request) (oauth2.TokenInfo, error) {
+	token, _ := httpserver.BearerToken(r)
+	return v.Verify(r.Context(), token)
+}
+
+// HandleTokenVerify 与ginserver.HandleTokenVerify相同的中间件，之后可以继续使用ginserver.RequireScopes等
+func (v *Verifier) HandleTokenVerify(config ...ginserver.Config) gin.HandlerFunc {
+	return ginserver.HandleTokenVerifyWith(func(c *gin.Context) (oauth2.TokenInfo, error) {
+		return v.VerifyRequest(c.Request)
+	}, config...)
+}
+
+// Middleware 与httpserver.HandleTokenVerify相同的net/http中间件
+func (v *Verifier) Middleware(config ...httpserver.Config) func(http.Handler) http.Handler {
+	return httpserver.HandleTokenVerifyWith(v.VerifyRequest, config...)
+}
+
+// lookup JWT格式并且设置了JWKSURL时在本地验证，否则访问introspect
+func (v *Verifier) lookup(token string) (*httpserver.IntrospectionResponse, error) {
+	if v.keys != nil && strings.Count(token, ".") == 2 {
+		return v.verifyJWT(token)
+	}
+	if v.opt.IntrospectionURL == "" {
+		return nil, errors.ErrInvalidAccessToken
+	}
+	return v.introspect(token)
+}
+
+// store 缓存验证结果，授权服务不可用时不缓存
+func (v *Verifier) store(key string, resp *httpserver.IntrospectionResponse, err error) {
+	if err == ErrUnavailable {
+		return
+	}
+	if err != nil || !resp.Active {
+		if v.opt.NegativeTTL > 0 {
+			v.cache.Set(key, &cacheEntry{resp: resp, err: err}, v.opt.NegativeTTL)
+		}
+		return
+	}
+	ttl := v.opt.CacheTTL
+	if resp.ExpiresAt > 0 {
+		if left := time.Until(time.Unix(resp.ExpiresAt, 0)); left < ttl {
+			ttl = left
+		}
+	}
+	if ttl > 0 {
+		v.cache.Set(key, &cacheEntry{resp: resp}, ttl)
+	}
+}
+
+// tokenInfo 每次都生成新的token，调用方修改不会影响缓存
+func tokenInfo(resp *httpserver.IntrospectionResponse, err error, token string) (oauth2.TokenInfo, error) {
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || !resp.Active {
+		return nil, errors.ErrInvalidAccessToken
+	}
+	if resp.ExpiresAt > 0 && time.Now().Unix() >= resp.ExpiresAt {
+		return nil, errors.ErrExpiredAccessToken
+	}
+	return resp.TokenInfo(token), nil
+}
+
+// cacheKey 缓存中不保存token的明文
+func cacheKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,143 @@
+package resource
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-oauth2/oauth2/v4/errors"
+	"github.com/golang-jwt/jwt"
+	"github.com/tianlin0/go-plat-oauth/oauth/httpserver"
+)
+
+func TestVerifierIntrospection(t *testing.T) {
+	var calls int32
+	var failing atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if id, secret, _ := r.BasicAuth(); id != "api" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		resp := &httpserver.IntrospectionResponse{Active: r.PostFormValue("token") == "good"}
+		if resp.Active {
+			resp.ClientID = "client1"
+			resp.Subject = "user1"
+			resp.Scope = "read"
+			resp.Audience = []string{"https://api.example.com"}
+			resp.IssuedAt = time.Now().Unix()
+			resp.ExpiresAt = time.Now().Add(time.Hour).Unix()
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	v, err := NewVerifier(Option{IntrospectionURL: srv.URL, ClientID: "api", ClientSecret: "secret", FailureThreshold: 2, OpenTimeout: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//并发的相同请求只访问一次，之后使用缓存
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ti, err := v.Verify(context.Background(), "good")
+			if err != nil || ti.GetUserID() != "user1" || ti.GetScope() != "read resource:https://api.example.com" {
+				t.Errorf("unexpected token %v %v", ti, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if _, err = v.Verify(context.Background(), "good"); err != nil || atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("calls %d, err %v", calls, err)
+	}
+	if _, err = v.Verify(context.Background(), "bad"); err != errors.ErrInvalidAccessToken {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	//连续失败以后熔断，不再访问授权服务
+	failing.Store(true)
+	for _, token := range []string{"t1", "t2", "t3", "t4"} {
+		if _, err = v.Verify(context.Background(), token); err != ErrUnavailable {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&calls); n != 4 {
+		t.Fatalf("breaker not open, calls %d", n)
+	}
+	//缓存中的token不受影响
+	if _, err = v.Verify(context.Background(), "good"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifierJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []interface{}{map[string]string{
+			"kty": "RSA",
+			"kid": "k1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	}))
+	defer srv.Close()
+
+	v, err := NewVerifier(Option{JWKSURL: srv.URL, Issuer: "https://auth.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(method jwt.SigningMethod, signKey interface{}, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = "k1"
+		s, err := token.SignedString(signKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	claims := jwt.MapClaims{
+		"iss":       "https://auth.example.com",
+		"sub":       "user1",
+		"client_id": "client1",
+		"scope":     "read",
+		"aud":       []string{"https://api.example.com"},
+		"exp":       time.Now().Add(time.Hour).Unix(),
+	}
+	ti, err := v.Verify(context.Background(), sign(jwt.SigningMethodRS256, key, claims))
+	if err != nil || ti.GetClientID() != "client1" || ti.GetScope() != "read resource:https://api.example.com" {
+		t.Fatalf("unexpected token %v %v", ti, err)
+	}
+
+	claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	if _, err = v.Verify(context.Background(), sign(jwt.SigningMethodRS256, key, claims)); err != errors.ErrExpiredAccessToken {
+		t.Fatalf("unexpected error %v", err)
+	}
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	claims["iss"] = "https://other.example.com"
+	if _, err = v.Verify(context.Background(), sign(jwt.SigningMethodRS256, key, claims)); err != errors.ErrInvalidAccessToken {
+		t.Fatalf("unexpected error %v", err)
+	}
+	//不接受HMAC签名
+	if _, err = v.Verify(context.Background(), sign(jwt.SigningMethodHS256, []byte("secret"), claims)); err != errors.ErrInvalidAccessToken {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
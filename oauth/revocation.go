@@ -0,0 +1,267 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/manage"
+	"github.com/tianlin0/go-plat-oauth/oauth/ginserver"
+	"github.com/tianlin0/go-plat-oauth/oauth/httpserver"
+	"github.com/tianlin0/go-plat-utils/utils/httputil"
+)
+
+// RevocationStore token撤销时间的存储，在撤销时间之前生成的token全部无效
+type RevocationStore interface {
+	// SetRevokedAt 记录撤销时间，exp为记录保存的时间，超过以后相关token都已经过期，为0时不过期
+	SetRevokedAt(ctx context.Context, key string, revokedAt time.Time, exp time.Duration) error
+	// GetRevokedAt 获取多个key中最晚的撤销时间，都不存在时返回零值
+	GetRevokedAt(ctx context.Context, keys ...string) (time.Time, error)
+}
+
+// tokenValidation token的检查方法，createAt为access或者refresh的生成时间
+type tokenValidation func(ctx context.Context, ti oauth2.TokenInfo, createAt time.Time) (allowed bool, err error)
+
+const revokeAllKey = "all" //全局撤销记录，在此之前生成的所有token都无效
+
+// revokeUserClientKey 用户在某个客户端上的token撤销记录，id中带有:时加上用户id的长度，
+// 避免 a:b/c 与 a/b:c 相同，不带:时与原来的格式一致，已有的撤销记录仍然有效
+func revokeUserClientKey(userID, clientID string) string {
+	if strings.Contains(userID, ":") || strings.Contains(clientID, ":") {
+		return "user_client:" + strconv.Itoa(len(userID)) + ":" + userID + ":" + clientID
+	}
+	return "user_client:" + userID + ":" + clientID
+}
+
+// revokeUserKey 用户所有token的撤销记录
+func revokeUserKey(userID string) string {
+	return "user:" + userID
+}
+
+// revokeClientKey 客户端所有token的撤销记录
+func revokeClientKey(clientID string) string {
+	return "client:" + clientID
+}
+
+// revokeSessionKey 通过某个单点登录会话授权的token的撤销记录
+func revokeSessionKey(sessionID string) string {
+	return "session:" + sessionID
+}
+
+// getRevocationValidation 在撤销时间之前生成的token视为无效
+func getRevocationValidation(revocationStore RevocationStore) tokenValidation {
+	return func(ctx context.Context, ti oauth2.TokenInfo, createAt time.Time) (bool, error) {
+		keys := []string{revokeAllKey, revokeClientKey(ti.GetClientID())}
+		if userID := ti.GetUserID(); userID != "" {
+			keys = append(keys, revokeUserKey(userID), revokeUserClientKey(userID, ti.GetClientID()))
+		}
+		if sessionID := httpserver.TokenSessionID(ti); sessionID != "" {
+			keys = append(keys, revokeSessionKey(sessionID))
+		}
+		revokedAt, err := revocationStore.GetRevokedAt(ctx, keys...)
+		if err != nil {
+			return false, err
+		}
+		return revokedAt.IsZero() || createAt.After(revokedAt), nil
+	}
+}
+
+// TokenRevoker 批量撤销token，先记录撤销时间使token立即失效，再从存储中删除
+type TokenRevoker struct {
+	revocationStore RevocationStore
+	purger          TokenPurger //为空时只记录撤销时间，token到期后自动删除
+}
+
+var defaultTokenRevoker *TokenRevoker
+
+// NewTokenRevoker 创建批量撤销，purger可以为空
+func NewTokenRevoker(revocationStore RevocationStore, purger TokenPurger) *TokenRevoker {
+	return &TokenRevoker{
+		revocationStore: revocationStore,
+		purger:          purger,
+	}
+}
+
+// GetTokenRevoker 获取StartGinOAuthServer启动的服务所使用的批量撤销，未启动或者未开启EnableRevocation时返回nil
+func GetTokenRevoker() *TokenRevoker {
+	return defaultTokenRevoker
+}
+
+// revocationRecordExp 撤销记录的保存时间，不能短于最长的token有效期，否则记录过期以后被撤销的token又会有效，
+// 有不过期的token时撤销记录也不过期
+func revocationRecordExp() time.Duration {
+	exp := httpserver.DefaultCacheAccessTokenMaxExpiresIn
+	for _, cfg := range []*manage.Config{manage.DefaultAuthorizeCodeTokenCfg, manage.DefaultImplicitTokenCfg,
+		manage.DefaultPasswordTokenCfg, manage.DefaultClientTokenCfg} {
+		if cfg == nil {
+			continue
+		}
+		if cfg.AccessTokenExp <= 0 || (cfg.IsGenerateRefresh && cfg.RefreshTokenExp <= 0) {
+			return 0
+		}
+		if cfg.AccessTokenExp > exp {
+			exp = cfg.AccessTokenExp
+		}
+		if cfg.IsGenerateRefresh && cfg.RefreshTokenExp > exp {
+			exp = cfg.RefreshTokenExp
+		}
+	}
+	return exp
+}
+
+func (r *TokenRevoker) revoke(ctx context.Context, key string, revokedAt time.Time, match func(ti oauth2.TokenInfo) bool) (int, error) {
+	err := r.revocationStore.SetRevokedAt(ctx, key, revokedAt, revocationRecordExp())
+	if err != nil {
+		return 0, err
+	}
+	if r.purger == nil {
+		return 0, nil
+	}
+	return r.purger.PurgeTokens(ctx, func(ti oauth2.TokenInfo) bool {
+		return match(ti) && !issuedAfter(ti, revokedAt)
+	})
+}
+
+// issuedAfter token是否在某个时间之后生成，授权码以生成授权码的时间为准
+func issuedAfter(ti oauth2.TokenInfo, t time.Time) bool {
+	if ti.GetCode() != "" {
+		return ti.GetCodeCreateAt().After(t)
+	}
+	return ti.GetAccessCreateAt().After(t)
+}
+
+// RevokeBySubject 撤销用户的所有token，返回从存储中删除的数量
+func (r *TokenRevoker) RevokeBySubject(ctx context.Context, userID string) (int, error) {
+	return r.revoke(ctx, revokeUserKey(userID), time.Now(), func(ti oauth2.TokenInfo) bool {
+		return ti.GetUserID() == userID
+	})
+}
+
+// RevokeByClient 撤销客户端的所有token，返回从存储中删除的数量
+func (r *TokenRevoker) RevokeByClient(ctx context.Context, clientID string) (int, error) {
+	return r.revoke(ctx, revokeClientKey(clientID), time.Now(), func(ti oauth2.TokenInfo) bool {
+		return ti.GetClientID() == clientID
+	})
+}
+
+// RevokeBySubjectClient 撤销用户在某个客户端上的所有token，返回从存储中删除的数量
+func (r *TokenRevoker) RevokeBySubjectClient(ctx context.Context, userID, clientID string) (int, error) {
+	return r.revoke(ctx, revokeUserClientKey(userID, clientID), time.Now(), func(ti oauth2.TokenInfo) bool {
+		return ti.GetUserID() == userID && ti.GetClientID() == clientID
+	})
+}
+
+// RevokeBySession 撤销通过某个单点登录会话授权的所有token，其他设备和会话的token不受影响，返回从存储中删除的数量
+func (r *TokenRevoker) RevokeBySession(ctx context.Context, sessionID string) (int, error) {
+	return r.revoke(ctx, revokeSessionKey(sessionID), time.Now(), func(ti oauth2.TokenInfo) bool {
+		return httpserver.TokenSessionID(ti) == sessionID
+	})
+}
+
+// RevokeIssuedBefore 撤销某个时间之前生成的所有token，时间晚于当前时间时以当前时间为准
+func (r *TokenRevoker) RevokeIssuedBefore(ctx context.Context, issuedBefore time.Time) (int, error) {
+	if now := time.Now(); issuedBefore.After(now) {
+		issuedBefore = now
+	}
+	revokedAt, err := r.revocationStore.GetRevokedAt(ctx, revokeAllKey)
+	if err != nil {
+		return 0, err
+	}
+	if revokedAt.After(issuedBefore) {
+		//不能把已有的撤销时间往前推
+		issuedBefore = revokedAt
+	}
+	return r.revoke(ctx, revokeAllKey, issuedBefore, func(oauth2.TokenInfo) bool {
+		return true
+	})
+}
+
+// setTokenValidations 使用和刷新token时，所有检查都通过才有效
+func setTokenValidations(validations ...tokenValidation) {
+	if len(validations) == 0 {
+		return
+	}
+	check := func(ctx context.Context, ti oauth2.TokenInfo, createAt time.Time) (bool, error) {
+		for _, validation := range validations {
+			allowed, err := validation(ctx, ti, createAt)
+			if err != nil || !allowed {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	ginserver.SetAccessValidationHandler(func(ctx context.Context, ti oauth2.TokenInfo) (bool, error) {
+		return check(ctx, ti, ti.GetAccessCreateAt())
+	})
+	ginserver.SetRefreshingValidationHandler(func(ti oauth2.TokenInfo) (bool, error) {
+		return check(context.Background(), ti, ti.GetRefreshCreateAt())
+	})
+}
+
+// parseIssuedBefore 支持unix秒和RFC3339两种格式
+func parseIssuedBefore(value string) (time.Time, error) {
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(n, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// startRevokeAdminRoute 管理员批量撤销token，user_id、client_id可以单独或者组合使用，
+// issued_before 撤销该时间之前生成的所有token，不能与user_id、client_id同时使用
+func startRevokeAdminRoute(admin *gin.RouterGroup, revoker *TokenRevoker) {
+	admin.POST("/revoke", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		userID := c.Request.FormValue("user_id")
+		clientID := c.Request.FormValue("client_id")
+		issuedBefore := c.Request.FormValue("issued_before")
+
+		if issuedBefore != "" && (userID != "" || clientID != "") {
+			_ = httputil.WriteCommResponse(c.Writer, &httputil.CommResponse{
+				Code:    http.StatusBadRequest,
+				Message: "issued_before cannot be combined with user_id or client_id",
+			})
+			return
+		}
+
+		var purged int
+		var err error
+		switch {
+		case userID != "" && clientID != "":
+			purged, err = revoker.RevokeBySubjectClient(ctx, userID, clientID)
+		case userID != "":
+			purged, err = revoker.RevokeBySubject(ctx, userID)
+		case clientID != "":
+			purged, err = revoker.RevokeByClient(ctx, clientID)
+		case issuedBefore != "":
+			var t time.Time
+			if t, err = parseIssuedBefore(issuedBefore); err != nil {
+				_ = httputil.WriteCommResponse(c.Writer, &httputil.CommResponse{
+					Code:    http.StatusBadRequest,
+					Message: "invalid issued_before",
+				})
+				return
+			}
+			purged, err = revoker.RevokeIssuedBefore(ctx, t)
+		default:
+			_ = httputil.WriteCommResponse(c.Writer, &httputil.CommResponse{
+				Code:    http.StatusBadRequest,
+				Message: "user_id, client_id or issued_before is required",
+			})
+			return
+		}
+		if err != nil {
+			_ = httputil.WriteCommResponse(c.Writer, &httputil.CommResponse{
+				Code:    http.StatusInternalServerError,
+				Message: err.Error(),
+			})
+			return
+		}
+		_ = httputil.WriteCommResponse(c.Writer, &httputil.CommResponse{
+			Data: map[string]interface{}{"purged": purged},
+		})
+	})
+}
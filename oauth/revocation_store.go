@@ -0,0 +1,178 @@
+package oauth
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+	gCache "github.com/patrickmn/go-cache"
+)
+
+const defaultRevocationTableName = "oauth2_revocation"
+
+// NewMemoryRevocationStore 内存存储，只适合单机部署
+func NewMemoryRevocationStore() RevocationStore {
+	return &memoryRevocationStore{
+		cache: gCache.New(gCache.NoExpiration, 30*time.Minute),
+	}
+}
+
+type memoryRevocationStore struct {
+	cache *gCache.Cache
+}
+
+// SetRevokedAt 记录撤销时间
+func (s *memoryRevocationStore) SetRevokedAt(_ context.Context, key string, revokedAt time.Time, exp time.Duration) error {
+	s.cache.Set(key, revokedAt, exp)
+	return nil
+}
+
+// GetRevokedAt 获取撤销时间
+func (s *memoryRevocationStore) GetRevokedAt(_ context.Context, keys ...string) (time.Time, error) {
+	var last time.Time
+	for _, key := range keys {
+		if one, ok := s.cache.Get(key); ok {
+			if revokedAt := one.(time.Time); revokedAt.After(last) {
+				last = revokedAt
+			}
+		}
+	}
+	return last, nil
+}
+
+// NewRedisRevocationStore 撤销时间存储到redis中
+func NewRedisRevocationStore(cli redis.UniversalClient, keyNamespace ...string) RevocationStore {
+	s := &redisRevocationStore{
+		cli: cli,
+		ns:  "{default-oauth}",
+	}
+	if len(keyNamespace) > 0 && keyNamespace[0] != "" {
+		s.ns = keyNamespace[0]
+	}
+	return s
+}
+
+type redisRevocationStore struct {
+	cli redis.UniversalClient
+	ns  string
+}
+
+func (s *redisRevocationStore) revokeKey(key string) string {
+	return fmt.Sprintf("%srevoke:%s", s.ns, key)
+}
+
+// SetRevokedAt 记录撤销时间
+func (s *redisRevocationStore) SetRevokedAt(ctx context.Context, key string, revokedAt time.Time, exp time.Duration) error {
+	return s.cli.Set(ctx, s.revokeKey(key), revokedAt.UnixNano(), exp).Err()
+}
+
+// GetRevokedAt 获取撤销时间，cluster模式下不同key可能不在同一个分片，所以逐个获取
+func (s *redisRevocationStore) GetRevokedAt(ctx context.Context, keys ...string) (time.Time, error) {
+	var last time.Time
+	for _, key := range keys {
+		n, err := s.cli.Get(ctx, s.revokeKey(key)).Int64()
+		if err != nil {
+			if err == redis.Nil {
+				continue
+			}
+			return time.Time{}, err
+		}
+		if revokedAt := time.Unix(0, n); revokedAt.After(last) {
+			last = revokedAt
+		}
+	}
+	return last, nil
+}
+
+// NewMysqlRevocationStore 撤销时间存储到mysql中，tableName为空时默认为oauth2_revocation
+func NewMysqlRevocationStore(db *sql.DB, tableName string) (RevocationStore, error) {
+	return newMysqlRevocationStore(db, tableName, 30*time.Minute)
+}
+
+// revocationMysqlMigrations 表结构的版本
+var revocationMysqlMigrations = []schemaMigration{
+	{version: 1, description: "create revocation table", statements: func(tableName string) []string {
+		return []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` ("+
+			"`revoke_key` VARCHAR(512) NOT NULL,"+
+			"`revoked_at` BIGINT NOT NULL,"+
+			"`expired_at` BIGINT NOT NULL,"+
+			"PRIMARY KEY (`revoke_key`),"+
+			"KEY `idx_expired_at` (`expired_at`)"+
+			") DEFAULT CHARSET=utf8mb4", tableName)}
+	}},
+}
+
+func newMysqlRevocationStore(db *sql.DB, tableName string, gcInterval time.Duration) (RevocationStore, error) {
+	if tableName == "" {
+		tableName = defaultRevocationTableName
+	}
+	s := &mysqlRevocationStore{
+		db:        db,
+		tableName: tableName,
+	}
+	if err := migrateMysqlTable(db, tableName, revocationMysqlMigrations); err != nil {
+		return nil, err
+	}
+	go s.gc(gcInterval)
+	return s, nil
+}
+
+type mysqlRevocationStore struct {
+	db        *sql.DB
+	tableName string
+}
+
+func (s *mysqlRevocationStore) gc(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		_, err := s.db.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE `expired_at` <= ?", s.tableName), time.Now().Unix())
+		if err != nil {
+			log.Println("revocation gc error:", err)
+		}
+	}
+}
+
+// SetRevokedAt 记录撤销时间
+func (s *mysqlRevocationStore) SetRevokedAt(ctx context.Context, key string, revokedAt time.Time, exp time.Duration) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf("INSERT INTO `%s` (`revoke_key`, `revoked_at`, `expired_at`) VALUES (?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE `revoked_at` = VALUES(`revoked_at`), `expired_at` = VALUES(`expired_at`)", s.tableName),
+		key, revokedAt.UnixNano(), revocationExpiredAt(exp))
+	return err
+}
+
+// revocationExpiredAt 记录的过期时间，exp为0时不过期
+func revocationExpiredAt(exp time.Duration) int64 {
+	if exp <= 0 {
+		return math.MaxInt64
+	}
+	return time.Now().Add(exp).Unix()
+}
+
+// GetRevokedAt 获取撤销时间
+func (s *mysqlRevocationStore) GetRevokedAt(ctx context.Context, keys ...string) (time.Time, error) {
+	if len(keys) == 0 {
+		return time.Time{}, nil
+	}
+	args := make([]interface{}, 0, len(keys)+1)
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	args = append(args, time.Now().Unix())
+
+	var last sql.NullInt64
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT MAX(`revoked_at`) FROM `%s` WHERE `revoke_key` IN (%s) AND `expired_at` > ?",
+		s.tableName, strings.TrimSuffix(strings.Repeat("?,", len(keys)), ",")), args...).Scan(&last)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !last.Valid {
+		return time.Time{}, nil
+	}
+	return time.Unix(0, last.Int64), nil
+}
@@ -0,0 +1,147 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-oauth2/oauth2/v4/manage"
+	"github.com/go-oauth2/oauth2/v4/models"
+)
+
+func TestTokenRevoker(t *testing.T) {
+	ctx := context.Background()
+	tokenStore := mustMemoryTokenStore(t)
+	revocations := NewMemoryRevocationStore()
+	revoker := NewTokenRevoker(revocations, tokenStore)
+	validation := getRevocationValidation(revocations)
+
+	issued := time.Now().Add(-time.Minute)
+	for _, one := range []*models.Token{
+		{ClientID: "client1", UserID: "user1", Access: "access1", AccessCreateAt: issued, AccessExpiresIn: time.Hour},
+		{ClientID: "client2", UserID: "user1", Access: "access2", AccessCreateAt: issued, AccessExpiresIn: time.Hour},
+		{ClientID: "client1", UserID: "user2", Access: "access3", AccessCreateAt: issued, AccessExpiresIn: time.Hour},
+	} {
+		if err := tokenStore.Create(ctx, one); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	purged, err := revoker.RevokeBySubjectClient(ctx, "user1", "client1")
+	if err != nil || purged != 1 {
+		t.Fatalf("unexpected purge %d %v", purged, err)
+	}
+	if ti, _ := tokenStore.GetByAccess(ctx, "access1"); ti != nil {
+		t.Fatal("token not purged")
+	}
+	revoked := &models.Token{ClientID: "client1", UserID: "user1", AccessCreateAt: issued}
+	if allowed, _ := validation(ctx, revoked, issued); allowed {
+		t.Fatal("token issued before revocation allowed")
+	}
+	if allowed, _ := validation(ctx, revoked, time.Now().Add(time.Second)); !allowed {
+		t.Fatal("token issued after revocation rejected")
+	}
+	other := &models.Token{ClientID: "client2", UserID: "user1"}
+	if allowed, _ := validation(ctx, other, issued); !allowed {
+		t.Fatal("token of other client rejected")
+	}
+
+	if purged, err = revoker.RevokeByClient(ctx, "client1"); err != nil || purged != 1 {
+		t.Fatalf("unexpected purge %d %v", purged, err)
+	}
+	if purged, err = revoker.RevokeBySubject(ctx, "user1"); err != nil || purged != 1 {
+		t.Fatalf("unexpected purge %d %v", purged, err)
+	}
+
+	//全局撤销时间不能往前推
+	if _, err = revoker.RevokeIssuedBefore(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := revocations.GetRevokedAt(ctx, revokeAllKey)
+	if _, err = revoker.RevokeIssuedBefore(ctx, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if second, _ := revocations.GetRevokedAt(ctx, revokeAllKey); second.Before(first) {
+		t.Fatal("revocation moved backwards")
+	}
+}
+
+func TestRevokeAdminRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	startRevokeAdminRoute(router.Group("/admin"), NewTokenRevoker(NewMemoryRevocationStore(), nil))
+
+	revoke := func(form url.Values) string {
+		req := httptest.NewRequest(http.MethodPost, "/admin/revoke", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+	if body := revoke(url.Values{"user_id": {"user1"}, "issued_before": {"1700000000"}}); !strings.Contains(body, "cannot be combined") {
+		t.Fatalf("combination not rejected: %s", body)
+	}
+	if body := revoke(url.Values{"user_id": {"user1"}}); !strings.Contains(body, "purged") {
+		t.Fatalf("unexpected response: %s", body)
+	}
+}
+
+func TestTokenRevokerBySession(t *testing.T) {
+	ctx := context.Background()
+	tokenStore := mustMemoryTokenStore(t)
+	revocations := NewMemoryRevocationStore()
+	revoker := NewTokenRevoker(revocations, tokenStore)
+	validation := getRevocationValidation(revocations)
+
+	issued := time.Now().Add(-time.Minute)
+	thisDevice := &models.Token{ClientID: "client1", UserID: "user1", Scope: "read sid:sid1", Access: "access1",
+		AccessCreateAt: issued, AccessExpiresIn: time.Hour}
+	otherDevice := &models.Token{ClientID: "client1", UserID: "user1", Scope: "read sid:sid2", Access: "access2",
+		AccessCreateAt: issued, AccessExpiresIn: time.Hour}
+	for _, one := range []*models.Token{thisDevice, otherDevice} {
+		if err := tokenStore.Create(ctx, one); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if purged, err := revoker.RevokeBySession(ctx, "sid1"); err != nil || purged != 1 {
+		t.Fatalf("unexpected purge %d %v", purged, err)
+	}
+	if allowed, _ := validation(ctx, thisDevice, issued); allowed {
+		t.Fatal("token of the logged out session allowed")
+	}
+	if allowed, _ := validation(ctx, otherDevice, issued); !allowed {
+		t.Fatal("token of another session rejected")
+	}
+	if ti, _ := tokenStore.GetByAccess(ctx, "access2"); ti == nil {
+		t.Fatal("token of another session purged")
+	}
+}
+
+func TestRevocationKeys(t *testing.T) {
+	if revokeUserClientKey("a:b", "c") == revokeUserClientKey("a", "b:c") {
+		t.Fatal("user and client ids with colons collide")
+	}
+	if key := revokeUserClientKey("user1", "client1"); key != "user_client:user1:client1" {
+		t.Fatalf("key format changed for plain ids: %s", key)
+	}
+
+	//撤销记录要比最长的token有效期保存得更久
+	passwordCfg := manage.DefaultPasswordTokenCfg
+	defer func() {
+		manage.DefaultPasswordTokenCfg = passwordCfg
+	}()
+	manage.DefaultPasswordTokenCfg = &manage.Config{AccessTokenExp: time.Hour, RefreshTokenExp: 30 * 24 * time.Hour, IsGenerateRefresh: true}
+	if exp := revocationRecordExp(); exp < 30*24*time.Hour {
+		t.Fatalf("revocation record expires before the refresh token: %v", exp)
+	}
+	manage.DefaultPasswordTokenCfg = &manage.Config{AccessTokenExp: time.Hour, IsGenerateRefresh: true}
+	if exp := revocationRecordExp(); exp != 0 {
+		t.Fatalf("revocation record expires while refresh tokens never do: %v", exp)
+	}
+}
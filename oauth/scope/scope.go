@@ -0,0 +1,196 @@
+// Package scope scope的注册和判断，支持包含关系、带参数的scope和通配符
+//
+// scope由冒号分隔为多段，注册时可以使用 {参数} 表示任意一段，例如 project:{id}:write，
+// 授权时可以使用 * 匹配任意一段，例如 project:*:read 可以访问所有项目
+package scope
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Scope 注册的scope
+type Scope struct {
+	Name        string   //名称，可以带参数，例如 project:{id}:write
+	Description string   //授权页面展示的说明，可以使用名称中的参数，例如 修改项目{id}
+	Implies     []string //包含的其他scope，可以使用名称中的参数，例如 project:{id}:write 包含 project:{id}:read
+}
+
+// Registry 已注册的scope
+type Registry struct {
+	lock   sync.RWMutex
+	scopes []*Scope
+}
+
+// NewRegistry 注册scope
+func NewRegistry(scopes ...Scope) (*Registry, error) {
+	r := &Registry{}
+	if err := r.Register(scopes...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Register 注册scope，包含的scope中只能使用名称中已有的参数
+func (r *Registry) Register(scopes ...Scope) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for i := range scopes {
+		s := scopes[i]
+		if s.Name == "" || strings.ContainsAny(s.Name, " *") {
+			return fmt.Errorf("scope: invalid name %q", s.Name)
+		}
+		params := make(map[string]bool)
+		for _, seg := range strings.Split(s.Name, ":") {
+			if name, ok := paramName(seg); ok {
+				params[name] = true
+			}
+		}
+		for _, implied := range s.Implies {
+			for _, seg := range strings.Split(implied, ":") {
+				if name, ok := paramName(seg); ok && !params[name] {
+					return fmt.Errorf("scope: %q implies unknown parameter %q", s.Name, name)
+				}
+			}
+		}
+		r.scopes = append(r.scopes, &s)
+	}
+	return nil
+}
+
+// Parse 按空格拆分scope
+func Parse(scope string) []string {
+	return strings.Fields(scope)
+}
+
+// paramName {id} 形式的参数
+func paramName(seg string) (string, bool) {
+	if len(seg) > 2 && seg[0] == '{' && seg[len(seg)-1] == '}' {
+		return seg[1 : len(seg)-1], true
+	}
+	return "", false
+}
+
+// match 名称是否与注册的scope匹配，返回参数的值
+func match(pattern, name string) (map[string]string, bool) {
+	patternSegs, nameSegs := strings.Split(pattern, ":"), strings.Split(name, ":")
+	if len(patternSegs) != len(nameSegs) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, seg := range patternSegs {
+		if param, ok := paramName(seg); ok {
+			if nameSegs[i] == "" {
+				return nil, false
+			}
+			params[param] = nameSegs[i]
+		} else if seg != nameSegs[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// replace 使用参数的值替换 {参数}
+func replace(s string, params map[string]string) string {
+	for name, value := range params {
+		s = strings.ReplaceAll(s, "{"+name+"}", value)
+	}
+	return s
+}
+
+// lookup 查找匹配的scope
+func (r *Registry) lookup(name string) (*Scope, map[string]string) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for _, s := range r.scopes {
+		if params, ok := match(s.Name, name); ok {
+			return s, params
+		}
+	}
+	return nil, nil
+}
+
+// Valid 是否为已注册的scope，通配符也可以使用
+func (r *Registry) Valid(name string) bool {
+	s, _ := r.lookup(name)
+	return s != nil
+}
+
+// Describe 授权页面展示的说明，未设置时返回名称
+func (r *Registry) Describe(name string) string {
+	s, params := r.lookup(name)
+	if s == nil || s.Description == "" {
+		return name
+	}
+	return replace(s.Description, params)
+}
+
+// Expand 展开包含的所有scope
+func (r *Registry) Expand(granted ...string) []string {
+	result := make([]string, 0, len(granted))
+	visited := make(map[string]bool)
+	var expand func(name string)
+	expand = func(name string) {
+		if visited[name] {
+			return
+		}
+		visited[name] = true
+		result = append(result, name)
+		if s, params := r.lookup(name); s != nil {
+			for _, implied := range s.Implies {
+				expand(replace(implied, params))
+			}
+		}
+	}
+	for _, name := range granted {
+		expand(name)
+	}
+	return result
+}
+
+// Allows 已授权的scope是否包含需要的scope
+func (r *Registry) Allows(granted []string, required string) bool {
+	for _, name := range r.Expand(granted...) {
+		if covers(name, required) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAll 已授权的scope是否包含所有需要的scope
+func (r *Registry) AllowsAll(granted []string, required []string) bool {
+	expanded := r.Expand(granted...)
+	for _, one := range required {
+		found := false
+		for _, name := range expanded {
+			if covers(name, one) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// covers 授权的scope中的 * 可以匹配任意一段
+func covers(granted, required string) bool {
+	if granted == required {
+		return true
+	}
+	grantedSegs, requiredSegs := strings.Split(granted, ":"), strings.Split(required, ":")
+	if len(grantedSegs) != len(requiredSegs) {
+		return false
+	}
+	for i, seg := range grantedSegs {
+		if seg != "*" && seg != requiredSegs[i] {
+			return false
+		}
+	}
+	return true
+}
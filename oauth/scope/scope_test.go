@@ -0,0 +1,41 @@
+package scope
+
+import "testing"
+
+func TestRegistry(t *testing.T) {
+	r, err := NewRegistry(
+		Scope{Name: "read", Description: "读取信息"},
+		Scope{Name: "admin", Implies: []string{"read", "project:*:write"}},
+		Scope{Name: "project:{id}:read", Description: "查看项目{id}"},
+		Scope{Name: "project:{id}:write", Implies: []string{"project:{id}:read"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewRegistry(Scope{Name: "a", Implies: []string{"b:{id}"}}); err == nil {
+		t.Fatal("unknown parameter accepted")
+	}
+
+	for _, c := range []struct {
+		granted  []string
+		required string
+		allowed  bool
+	}{
+		{[]string{"admin"}, "read", true},
+		{[]string{"admin"}, "project:123:read", true},
+		{[]string{"project:123:write"}, "project:123:read", true},
+		{[]string{"project:123:write"}, "project:456:read", false},
+		{[]string{"project:*:read"}, "project:456:read", true},
+		{[]string{"read"}, "admin", false},
+	} {
+		if r.Allows(c.granted, c.required) != c.allowed {
+			t.Fatalf("%v %s: expected %v", c.granted, c.required, c.allowed)
+		}
+	}
+	if !r.Valid("project:123:write") || r.Valid("project:123") {
+		t.Fatal("unexpected valid result")
+	}
+	if d := r.Describe("project:123:read"); d != "查看项目123" {
+		t.Fatalf("unexpected description %q", d)
+	}
+}
@@ -0,0 +1,53 @@
+package oauth
+
+import (
+	"net/http"
+	"strings"
+
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/errors"
+	"github.com/go-oauth2/oauth2/v4/server"
+	"github.com/tianlin0/go-plat-oauth/oauth/scope"
+)
+
+// ScopeClientHandler 申请的scope必须已注册，clientScopes不为空时还必须在客户端允许的范围内，
+// userScopes不为空并且有用户时（授权码和密码方式），还必须在用户拥有的范围内
+func ScopeClientHandler(registry *scope.Registry, clientScopes func(clientID string) []string,
+	userScopes func(userID string) []string) server.ClientScopeHandler {
+	return func(tgr *oauth2.TokenGenerateRequest) (bool, error) {
+		requested := scope.Parse(tgr.Scope)
+		for _, one := range requested {
+			if !registry.Valid(one) {
+				return false, nil
+			}
+		}
+		if clientScopes != nil && !registry.AllowsAll(clientScopes(tgr.ClientID), requested) {
+			return false, nil
+		}
+		if userScopes != nil && tgr.UserID != "" && !registry.AllowsAll(userScopes(tgr.UserID), requested) {
+			return false, nil
+		}
+		return true, nil
+	}
+}
+
+// ScopeAuthorizeHandler 用户授权时检查scope是否已注册，并去掉多余的空格，
+// 这里拿不到用户，用户拥有的scope在生成授权码时由ScopeClientHandler检查
+func ScopeAuthorizeHandler(registry *scope.Registry) server.AuthorizeScopeHandler {
+	return func(_ http.ResponseWriter, r *http.Request) (string, error) {
+		requested := scope.Parse(r.FormValue("scope"))
+		for _, one := range requested {
+			if !registry.Valid(one) {
+				return "", errors.ErrInvalidScope
+			}
+		}
+		return strings.Join(requested, " "), nil
+	}
+}
+
+// ScopeRefreshingHandler 刷新token时只能缩小scope，不能超出原来的范围
+func ScopeRefreshingHandler(registry *scope.Registry) server.RefreshingScopeHandler {
+	return func(tgr *oauth2.TokenGenerateRequest, oldScope string) (bool, error) {
+		return registry.AllowsAll(scope.Parse(oldScope), scope.Parse(tgr.Scope)), nil
+	}
+}
@@ -0,0 +1,53 @@
+package oauth
+
+import (
+	"testing"
+
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+	"github.com/tianlin0/go-plat-oauth/oauth/scope"
+)
+
+func TestScopeClientHandler(t *testing.T) {
+	registry, err := scope.NewRegistry(
+		scope.Scope{Name: "read"},
+		scope.Scope{Name: "write", Implies: []string{"read"}},
+		scope.Scope{Name: "admin", Implies: []string{"write"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientScopes := func(clientID string) []string {
+		return []string{"admin"}
+	}
+	userScopes := func(userID string) []string {
+		if userID == "admin1" {
+			return []string{"admin"}
+		}
+		return []string{"read"}
+	}
+	handler := ScopeClientHandler(registry, clientScopes, userScopes)
+
+	for _, c := range []struct {
+		userID  string
+		scope   string
+		allowed bool
+	}{
+		{"user1", "read", true},
+		{"user1", "write", false},
+		{"admin1", "write read", true},
+		{"admin1", "unknown", false},
+		//client_credentials没有用户，只检查客户端
+		{"", "admin", true},
+	} {
+		allowed, err := handler(&oauth2.TokenGenerateRequest{ClientID: "client1", UserID: c.userID, Scope: c.scope})
+		if err != nil || allowed != c.allowed {
+			t.Fatalf("%s %q: expected %v, got %v %v", c.userID, c.scope, c.allowed, allowed, err)
+		}
+	}
+
+	//没有设置userScopes时不限制用户
+	allowed, err := ScopeClientHandler(registry, nil, nil)(&oauth2.TokenGenerateRequest{ClientID: "client1", UserID: "user1", Scope: "admin"})
+	if err != nil || !allowed {
+		t.Fatalf("unexpected result without user scopes: %v %v", allowed, err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/go-oauth2/oauth2/v4/store"
 	oredis "github.com/go-oauth2/redis/v4"
 	"github.com/go-redis/redis/v8"
+	"github.com/tianlin0/go-plat-oauth/oauth/httpserver"
 	"log"
 )
 
@@ -17,7 +18,7 @@ func getOauthServer(redisOpt *redis.Options, clientStore oauth2.ClientStore) *se
 
 	srv := server.NewDefaultServer(manager)
 	srv.SetAllowGetAccessRequest(true)
-	srv.SetClientInfoHandler(server.ClientFormHandler)
+	srv.SetClientInfoHandler(httpserver.ClientBasicOrFormHandler)
 
 	srv.SetInternalErrorHandler(func(err error) (re *errors.Response) {
 		log.Println("internal error:", err.Error())
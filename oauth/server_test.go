@@ -0,0 +1,104 @@
+package oauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-oauth2/oauth2/v4/models"
+	"github.com/go-oauth2/oauth2/v4/store"
+	"github.com/tianlin0/go-plat-oauth/oauth"
+)
+
+var (
+	testServerOnce sync.Once
+	testServerURL  string
+	testConsents   = oauth.NewMemoryConsentStore()
+)
+
+// startTestServer 所有测试共用一个oauth服务，httpserver.InitServer在一个进程中只会生效一次
+func startTestServer(t *testing.T) string {
+	testServerOnce.Do(func() {
+		gin.SetMode(gin.TestMode)
+		clientStore := store.NewClientStore()
+		_ = clientStore.Set("client1", &models.Client{ID: "client1", Secret: "secret1", Domain: "http://localhost"})
+		_ = clientStore.Set("client2", &models.Client{ID: "client2", Secret: "secret2", Domain: "http://localhost"})
+		router := gin.New()
+		started := oauth.StartGinOAuthServer(&router.RouterGroup, &oauth.GinOauthOption{
+			ClientStore: clientStore,
+			PasswordAuthorizationHandler: func(ctx context.Context, clientID, username, password string) (string, error) {
+				if password != "pass" {
+					return "", errors.New("wrong password")
+				}
+				return username, nil
+			},
+			EnableRevocation: true,
+			ConsentStore:     testConsents,
+		})
+		if started {
+			testServerURL = httptest.NewServer(router).URL
+		}
+	})
+	if testServerURL == "" {
+		t.Fatal("server not started")
+	}
+	return testServerURL
+}
+
+// requestTestToken 使用Basic认证向/oauth2/token申请token，返回状态码和内容
+func requestTestToken(t *testing.T, clientID, clientSecret string, form url.Values) (int, map[string]interface{}) {
+	req, _ := http.NewRequest(http.MethodPost, startTestServer(t)+"/oauth2/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(clientID, clientSecret)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data := make(map[string]interface{})
+	_ = json.NewDecoder(resp.Body).Decode(&data)
+	return resp.StatusCode, data
+}
+
+func TestTokenRequestResourceWithoutClientResources(t *testing.T) {
+	status, data := requestTestToken(t, "client1", "secret1", url.Values{
+		"grant_type": {"client_credentials"},
+		"scope":      {"read resource:https://billing.example.com"},
+	})
+	if status != http.StatusBadRequest || data["error"] != "invalid_target" {
+		t.Fatalf("resource in scope accepted: %d %v", status, data)
+	}
+	status, data = requestTestToken(t, "client1", "secret1", url.Values{
+		"grant_type": {"client_credentials"},
+		"scope":      {"read"},
+		"resource":   {"https://billing.example.com"},
+	})
+	if status != http.StatusBadRequest || data["error"] != "invalid_target" {
+		t.Fatalf("resource parameter accepted: %d %v", status, data)
+	}
+	status, data = requestTestToken(t, "client1", "secret1", url.Values{
+		"grant_type": {"client_credentials"},
+		"scope":      {"read"},
+	})
+	if status != http.StatusOK || data["scope"] != "read" {
+		t.Fatalf("token without resource rejected: %d %v", status, data)
+	}
+}
+
+// requestTestAPI 使用bearer token访问oauth服务的接口
+func requestTestAPI(t *testing.T, method, path, accessToken string) *http.Response {
+	req, _ := http.NewRequest(method, startTestServer(t)+path, nil)
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
@@ -0,0 +1,369 @@
+package oauth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/errors"
+	"github.com/go-oauth2/oauth2/v4/server"
+	"github.com/tianlin0/go-plat-oauth/oauth/httpserver"
+)
+
+const (
+	defaultSessionCookieName      = "oauth_session"
+	defaultSessionIdleTimeout     = 30 * time.Minute
+	defaultSessionAbsoluteTimeout = 24 * time.Hour
+)
+
+// https://openid.net/specs/openid-connect-core-1_0.html#AuthError
+var (
+	ErrLoginRequired   = errors.New("login_required")
+	ErrConsentRequired = errors.New("consent_required")
+)
+
+func init() {
+	errors.Descriptions[ErrLoginRequired] = "The authorization server requires end-user authentication"
+	errors.StatusCodes[ErrLoginRequired] = http.StatusUnauthorized
+	errors.Descriptions[ErrConsentRequired] = "The authorization server requires end-user consent"
+	errors.StatusCodes[ErrConsentRequired] = http.StatusUnauthorized
+}
+
+// Session 浏览器登录会话
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"user_id"`
+	AuthTime   time.Time `json:"auth_time"`   //用户实际登录的时间，max_age以此判断
+	CreateAt   time.Time `json:"create_at"`   //会话创建时间，绝对超时以此判断
+	LastActive time.Time `json:"last_active"` //最后一次使用时间，空闲超时以此判断
+	Clients    []string  `json:"clients"`     //通过该会话授权过的客户端，退出登录时通知
+}
+
+// addClient 记录授权过的客户端
+func (s *Session) addClient(clientID string) {
+	if clientID == "" {
+		return
+	}
+	for _, one := range s.Clients {
+		if one == clientID {
+			return
+		}
+	}
+	s.Clients = append(s.Clients, clientID)
+}
+
+// SessionStore 会话存储
+type SessionStore interface {
+	// Save 保存会话，exp为存储的过期时间
+	Save(ctx context.Context, session *Session, exp time.Duration) error
+	// Get 获取会话，不存在时返回nil
+	Get(ctx context.Context, id string) (*Session, error)
+	// Remove 删除会话
+	Remove(ctx context.Context, id string) error
+}
+
+// SessionOption 单点登录会话配置
+type SessionOption struct {
+	Store           SessionStore  //会话存储，为空时与token存储在同一个地方
+	Secret          []byte        //cookie签名的密钥，多实例部署时必须一致，为空时随机生成
+	CookieName      string        //cookie名称，默认为oauth_session
+	CookieDomain    string        //cookie的域名
+	CookiePath      string        //cookie的路径，默认为/
+	CookieSecure    bool          //是否只在https下传递cookie
+	IdleTimeout     time.Duration //空闲超时时间，默认30分钟
+	AbsoluteTimeout time.Duration //绝对超时时间，不论是否活跃，超过以后都需要重新登录，默认24小时
+}
+
+// sessionManager 会话的读写
+type sessionManager struct {
+	opt   SessionOption
+	store SessionStore
+}
+
+func newSessionManager(opt *SessionOption, store SessionStore) *sessionManager {
+	m := &sessionManager{
+		opt:   *opt,
+		store: store,
+	}
+	if m.opt.CookieName == "" {
+		m.opt.CookieName = defaultSessionCookieName
+	}
+	if m.opt.CookiePath == "" {
+		m.opt.CookiePath = "/"
+	}
+	if m.opt.IdleTimeout <= 0 {
+		m.opt.IdleTimeout = defaultSessionIdleTimeout
+	}
+	if m.opt.AbsoluteTimeout <= 0 {
+		m.opt.AbsoluteTimeout = defaultSessionAbsoluteTimeout
+	}
+	if len(m.opt.Secret) == 0 {
+		log.Println("session secret is empty, a random secret is used, sessions will not survive restarts")
+		m.opt.Secret = []byte(randomString(32))
+	}
+	return m
+}
+
+// sign cookie签名
+func (m *sessionManager) sign(id string) string {
+	mac := hmac.New(sha256.New, m.opt.Secret)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// csrfToken 与会话绑定的csrf token，用于退出登录等需要用户确认的操作
+func (m *sessionManager) csrfToken(session *Session, action string) string {
+	return m.sign(action + ":" + session.ID)
+}
+
+// checkCSRFToken 检查请求中的csrf_token
+func (m *sessionManager) checkCSRFToken(r *http.Request, session *Session, action string) bool {
+	token := r.PostFormValue("csrf_token")
+	return token != "" && hmac.Equal([]byte(token), []byte(m.csrfToken(session, action)))
+}
+
+// cookieSessionID 从cookie中获取签名合法的会话id
+func (m *sessionManager) cookieSessionID(r *http.Request) string {
+	cookie, err := r.Cookie(m.opt.CookieName)
+	if err != nil || cookie.Value == "" {
+		return ""
+	}
+	pos := strings.LastIndex(cookie.Value, ".")
+	if pos <= 0 {
+		return ""
+	}
+	id, signature := cookie.Value[:pos], cookie.Value[pos+1:]
+	if !hmac.Equal([]byte(signature), []byte(m.sign(id))) {
+		return ""
+	}
+	return id
+}
+
+// expiresIn 会话剩余的有效时间
+func (m *sessionManager) expiresIn(session *Session, now time.Time) time.Duration {
+	idle := session.LastActive.Add(m.opt.IdleTimeout).Sub(now)
+	absolute := session.CreateAt.Add(m.opt.AbsoluteTimeout).Sub(now)
+	if idle < absolute {
+		return idle
+	}
+	return absolute
+}
+
+// Load 获取当前请求的会话，过期或者不存在时返回nil
+func (m *sessionManager) Load(r *http.Request) (*Session, error) {
+	id := m.cookieSessionID(r)
+	if id == "" {
+		return nil, nil
+	}
+	session, err := m.store.Get(r.Context(), id)
+	if err != nil || session == nil {
+		return nil, err
+	}
+	if m.expiresIn(session, time.Now()) <= 0 {
+		_ = m.store.Remove(r.Context(), id)
+		return nil, nil
+	}
+	return session, nil
+}
+
+// Create 用户登录以后创建新的会话，并写入cookie，重新登录时删除之前的会话，
+// 同一个用户时保留之前授权过的客户端，退出登录时仍然通知
+func (m *sessionManager) Create(w http.ResponseWriter, r *http.Request, userID string, previous *Session) (*Session, error) {
+	now := time.Now()
+	session := &Session{
+		ID:         randomString(32),
+		UserID:     userID,
+		AuthTime:   now,
+		CreateAt:   now,
+		LastActive: now,
+	}
+	if previous != nil && previous.UserID == userID {
+		session.Clients = append(session.Clients, previous.Clients...)
+	}
+	session.addClient(r.FormValue("client_id"))
+	if err := m.store.Save(r.Context(), session, m.expiresIn(session, now)); err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		if err := m.store.Remove(r.Context(), previous.ID); err != nil {
+			return nil, err
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.opt.CookieName,
+		Value:    session.ID + "." + m.sign(session.ID),
+		Path:     m.opt.CookiePath,
+		Domain:   m.opt.CookieDomain,
+		Secure:   m.opt.CookieSecure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return session, nil
+}
+
+// Touch 更新最后使用时间，延长空闲超时，并记录本次授权的客户端
+func (m *sessionManager) Touch(ctx context.Context, session *Session, clientID string) error {
+	now := time.Now()
+	session.LastActive = now
+	session.addClient(clientID)
+	return m.store.Save(ctx, session, m.expiresIn(session, now))
+}
+
+// Destroy 删除会话并清除cookie
+func (m *sessionManager) Destroy(w http.ResponseWriter, r *http.Request, session *Session) error {
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.opt.CookieName,
+		Value:    "",
+		Path:     m.opt.CookiePath,
+		Domain:   m.opt.CookieDomain,
+		Secure:   m.opt.CookieSecure,
+		HttpOnly: true,
+		MaxAge:   -1,
+	})
+	if session == nil {
+		return nil
+	}
+	return m.store.Remove(r.Context(), session.ID)
+}
+
+// promptValues prompt参数，多个值以空格分隔
+func promptValues(r *http.Request) map[string]bool {
+	values := make(map[string]bool)
+	for _, one := range strings.Fields(r.FormValue("prompt")) {
+		values[one] = true
+	}
+	return values
+}
+
+// getSessionUserAuthorizationHandler 已经登录过的用户直接使用会话中的用户，
+// 支持 prompt=none|login 以及 max_age 参数
+func getSessionUserAuthorizationHandler(sessions *sessionManager, next server.UserAuthorizationHandler) server.UserAuthorizationHandler {
+	return func(w http.ResponseWriter, r *http.Request) (string, error) {
+		prompt := promptValues(r)
+
+		session, err := sessions.Load(r)
+		if err != nil {
+			return "", err
+		}
+		//需要重新登录时，登录以后替换之前的会话
+		previous := session
+		if session != nil && prompt["login"] {
+			//强制重新登录
+			session = nil
+		}
+		if session != nil {
+			if maxAge, err := strconv.ParseInt(r.FormValue("max_age"), 10, 64); err == nil && maxAge >= 0 {
+				if time.Since(session.AuthTime) > time.Duration(maxAge)*time.Second {
+					session = nil
+				}
+			}
+		}
+
+		if session != nil {
+			if err = sessions.Touch(r.Context(), session, r.FormValue("client_id")); err != nil {
+				return "", err
+			}
+			bindSession(r, session)
+			return session.UserID, nil
+		}
+
+		if prompt["none"] {
+			return "", ErrLoginRequired
+		}
+
+		userID, err := next(w, r)
+		if err != nil || userID == "" {
+			return userID, err
+		}
+		if session, err = sessions.Create(w, r, userID, previous); err != nil {
+			return "", err
+		}
+		bindSession(r, session)
+		return userID, nil
+	}
+}
+
+// sessionBindingKey 授权请求中记录本次使用的会话
+type sessionBindingKey struct{}
+
+type sessionBinding struct {
+	sessionID string
+}
+
+// withSessionBinding 授权请求开始前加入，用户通过会话登录以后记录会话，生成token时写入scope
+func withSessionBinding(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), sessionBindingKey{}, &sessionBinding{}))
+}
+
+// bindSession 记录本次授权使用的会话
+func bindSession(r *http.Request, session *Session) {
+	if binding, ok := r.Context().Value(sessionBindingKey{}).(*sessionBinding); ok {
+		binding.sessionID = session.ID
+	}
+}
+
+// boundSessionID 本次授权使用的会话，不是通过会话登录时为空
+func boundSessionID(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	if binding, ok := r.Context().Value(sessionBindingKey{}).(*sessionBinding); ok {
+		return binding.sessionID
+	}
+	return ""
+}
+
+// sessionClientScopeHandler 客户端不能在scope中指定会话，通过会话授权时在其他检查通过以后把会话记录在scope中，
+// 退出登录时只撤销该会话的token
+func sessionClientScopeHandler(next server.ClientScopeHandler) server.ClientScopeHandler {
+	return func(tgr *oauth2.TokenGenerateRequest) (bool, error) {
+		if _, ok := httpserver.ScopeSessionID(tgr.Scope); ok {
+			return false, errors.ErrInvalidScope
+		}
+		if next != nil {
+			if allowed, err := next(tgr); err != nil || !allowed {
+				return allowed, err
+			}
+		}
+		if sessionID := boundSessionID(tgr.Request); sessionID != "" {
+			tgr.Scope = httpserver.WithSessionID(tgr.Scope, sessionID)
+		}
+		return true, nil
+	}
+}
+
+// sessionRefreshingScopeHandler 刷新token时保留原来的会话
+func sessionRefreshingScopeHandler(next server.RefreshingScopeHandler) server.RefreshingScopeHandler {
+	return func(tgr *oauth2.TokenGenerateRequest, oldScope string) (bool, error) {
+		if _, ok := httpserver.ScopeSessionID(tgr.Scope); ok {
+			return false, errors.ErrInvalidScope
+		}
+		if next != nil {
+			if allowed, err := next(tgr, oldScope); err != nil || !allowed {
+				return allowed, err
+			}
+		}
+		if sessionID, ok := httpserver.ScopeSessionID(oldScope); ok && tgr.Scope != "" {
+			tgr.Scope = httpserver.WithSessionID(tgr.Scope, sessionID)
+		}
+		return true, nil
+	}
+}
+
+// randomString 随机字符串
+func randomString(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,187 @@
+package oauth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+	gCache "github.com/patrickmn/go-cache"
+)
+
+const defaultSessionTableName = "oauth2_session"
+
+// NewMemorySessionStore 内存存储，只适合单机部署
+func NewMemorySessionStore() SessionStore {
+	return &memorySessionStore{
+		cache: gCache.New(defaultSessionIdleTimeout, 10*time.Minute),
+	}
+}
+
+type memorySessionStore struct {
+	cache *gCache.Cache
+}
+
+// Save 保存
+func (s *memorySessionStore) Save(_ context.Context, session *Session, exp time.Duration) error {
+	one := *session
+	s.cache.Set(session.ID, &one, exp)
+	return nil
+}
+
+// Get 获取
+func (s *memorySessionStore) Get(_ context.Context, id string) (*Session, error) {
+	if one, ok := s.cache.Get(id); ok {
+		session := *(one.(*Session))
+		return &session, nil
+	}
+	return nil, nil
+}
+
+// Remove 删除
+func (s *memorySessionStore) Remove(_ context.Context, id string) error {
+	s.cache.Delete(id)
+	return nil
+}
+
+// NewRedisSessionStore 会话存储到redis中
+func NewRedisSessionStore(cli redis.UniversalClient, keyNamespace ...string) SessionStore {
+	s := &redisSessionStore{
+		cli: cli,
+		ns:  "{default-oauth}",
+	}
+	if len(keyNamespace) > 0 && keyNamespace[0] != "" {
+		s.ns = keyNamespace[0]
+	}
+	return s
+}
+
+type redisSessionStore struct {
+	cli redis.UniversalClient
+	ns  string
+}
+
+func (s *redisSessionStore) sessionKey(id string) string {
+	return fmt.Sprintf("%ssession:%s", s.ns, id)
+}
+
+// Save 保存
+func (s *redisSessionStore) Save(ctx context.Context, session *Session, exp time.Duration) error {
+	buf, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return s.cli.Set(ctx, s.sessionKey(session.ID), buf, exp).Err()
+}
+
+// Get 获取
+func (s *redisSessionStore) Get(ctx context.Context, id string) (*Session, error) {
+	buf, err := s.cli.Get(ctx, s.sessionKey(id)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	session := new(Session)
+	if err = json.Unmarshal(buf, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Remove 删除
+func (s *redisSessionStore) Remove(ctx context.Context, id string) error {
+	return s.cli.Del(ctx, s.sessionKey(id)).Err()
+}
+
+// NewMysqlSessionStore 会话存储到mysql中，tableName为空时默认为oauth2_session，
+// 过期的会话每10分钟清理一次
+func NewMysqlSessionStore(db *sql.DB, tableName string) (SessionStore, error) {
+	return newMysqlSessionStore(db, tableName, 10*time.Minute)
+}
+
+// sessionMysqlMigrations 表结构的版本
+var sessionMysqlMigrations = []schemaMigration{
+	{version: 1, description: "create session table", statements: func(tableName string) []string {
+		return []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` ("+
+			"`id` VARCHAR(128) NOT NULL,"+
+			"`user_id` VARCHAR(255) NOT NULL,"+
+			"`data` TEXT NOT NULL,"+
+			"`expired_at` BIGINT NOT NULL,"+
+			"PRIMARY KEY (`id`),"+
+			"KEY `idx_user_id` (`user_id`),"+
+			"KEY `idx_expired_at` (`expired_at`)"+
+			") DEFAULT CHARSET=utf8mb4", tableName)}
+	}},
+}
+
+func newMysqlSessionStore(db *sql.DB, tableName string, gcInterval time.Duration) (SessionStore, error) {
+	if tableName == "" {
+		tableName = defaultSessionTableName
+	}
+	s := &mysqlSessionStore{
+		db:        db,
+		tableName: tableName,
+	}
+	if err := migrateMysqlTable(db, tableName, sessionMysqlMigrations); err != nil {
+		return nil, err
+	}
+	go s.gc(gcInterval)
+	return s, nil
+}
+
+type mysqlSessionStore struct {
+	db        *sql.DB
+	tableName string
+}
+
+func (s *mysqlSessionStore) gc(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		_, err := s.db.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE `expired_at` <= ?", s.tableName), time.Now().Unix())
+		if err != nil {
+			log.Println("session gc error:", err)
+		}
+	}
+}
+
+// Save 保存
+func (s *mysqlSessionStore) Save(ctx context.Context, session *Session, exp time.Duration) error {
+	buf, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf("INSERT INTO `%s` (`id`, `user_id`, `data`, `expired_at`) VALUES (?, ?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE `data` = VALUES(`data`), `expired_at` = VALUES(`expired_at`)", s.tableName),
+		session.ID, session.UserID, string(buf), time.Now().Add(exp).Unix())
+	return err
+}
+
+// Get 获取
+func (s *mysqlSessionStore) Get(ctx context.Context, id string) (*Session, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, fmt.Sprintf("SELECT `data` FROM `%s` WHERE `id` = ? AND `expired_at` > ?", s.tableName),
+		id, time.Now().Unix()).Scan(&data)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	session := new(Session)
+	if err = json.Unmarshal([]byte(data), session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Remove 删除
+func (s *mysqlSessionStore) Remove(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM `%s` WHERE `id` = ?", s.tableName), id)
+	return err
+}
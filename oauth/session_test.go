@@ -0,0 +1,187 @@
+package oauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/errors"
+	"github.com/tianlin0/go-plat-oauth/oauth/httpserver"
+)
+
+// sessionTestClient 保存cookie并调用会话的授权处理
+type sessionTestClient struct {
+	sessions *sessionManager
+	logins   int
+	cookie   *http.Cookie
+}
+
+func newSessionTestClient(opt *SessionOption) *sessionTestClient {
+	return &sessionTestClient{sessions: newSessionManager(opt, NewMemorySessionStore())}
+}
+
+func (c *sessionTestClient) authorize(query string) (string, error) {
+	handler := getSessionUserAuthorizationHandler(c.sessions, func(w http.ResponseWriter, r *http.Request) (string, error) {
+		c.logins++
+		return "user1", nil
+	})
+	r := httptest.NewRequest(http.MethodGet, "/oauth2/authorize?client_id=client1&"+query, nil)
+	if c.cookie != nil {
+		r.AddCookie(c.cookie)
+	}
+	w := httptest.NewRecorder()
+	userID, err := handler(w, r)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == c.sessions.opt.CookieName {
+			c.cookie = cookie
+		}
+	}
+	return userID, err
+}
+
+// session 当前cookie对应的会话，不检查是否过期
+func (c *sessionTestClient) session(t *testing.T) *Session {
+	id := c.sessions.cookieSessionID(&http.Request{Header: http.Header{"Cookie": {c.cookie.String()}}})
+	session, err := c.sessions.store.Get(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session
+}
+
+func TestSessionPrompt(t *testing.T) {
+	c := newSessionTestClient(&SessionOption{Secret: []byte("secret")})
+	if _, err := c.authorize("prompt=none"); err != ErrLoginRequired {
+		t.Fatalf("expected login_required without session, got %v", err)
+	}
+	if userID, err := c.authorize(""); err != nil || userID != "user1" || c.logins != 1 {
+		t.Fatalf("login failed: %s %v %d", userID, err, c.logins)
+	}
+	if userID, err := c.authorize("prompt=none"); err != nil || userID != "user1" || c.logins != 1 {
+		t.Fatalf("session not reused: %s %v %d", userID, err, c.logins)
+	}
+
+	//prompt=login重新登录，并删除之前的会话
+	old := c.session(t)
+	if userID, err := c.authorize("prompt=login"); err != nil || userID != "user1" || c.logins != 2 {
+		t.Fatalf("prompt=login did not force a login: %s %v %d", userID, err, c.logins)
+	}
+	current := c.session(t)
+	if current == nil || current.ID == old.ID {
+		t.Fatalf("session not rotated: %+v", current)
+	}
+	if one, _ := c.sessions.store.Get(context.Background(), old.ID); one != nil {
+		t.Fatalf("old session kept after prompt=login: %+v", one)
+	}
+	if len(current.Clients) != 1 || current.Clients[0] != "client1" {
+		t.Fatalf("unexpected clients: %v", current.Clients)
+	}
+}
+
+func TestSessionMaxAge(t *testing.T) {
+	c := newSessionTestClient(&SessionOption{Secret: []byte("secret")})
+	if _, err := c.authorize(""); err != nil {
+		t.Fatal(err)
+	}
+	session := c.session(t)
+	session.AuthTime = time.Now().Add(-time.Minute)
+	if err := c.sessions.store.Save(context.Background(), session, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.authorize("max_age=3600"); err != nil || c.logins != 1 {
+		t.Fatalf("max_age not satisfied by a recent login: %v %d", err, c.logins)
+	}
+	if _, err := c.authorize("max_age=30&prompt=none"); err != ErrLoginRequired {
+		t.Fatalf("expected login_required after max_age, got %v", err)
+	}
+	if _, err := c.authorize("max_age=30"); err != nil || c.logins != 2 {
+		t.Fatalf("max_age did not force a login: %v %d", err, c.logins)
+	}
+	if one, _ := c.sessions.store.Get(context.Background(), session.ID); one != nil {
+		t.Fatalf("old session kept after max_age login: %+v", one)
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	for name, expire := range map[string]func(session *Session){
+		"idle": func(session *Session) {
+			session.LastActive = time.Now().Add(-2 * time.Minute)
+		},
+		"absolute": func(session *Session) {
+			session.CreateAt = time.Now().Add(-2 * time.Hour)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := newSessionTestClient(&SessionOption{Secret: []byte("secret"), IdleTimeout: time.Minute, AbsoluteTimeout: time.Hour})
+			if _, err := c.authorize(""); err != nil {
+				t.Fatal(err)
+			}
+			//活跃的会话延长空闲超时
+			if _, err := c.authorize("prompt=none"); err != nil {
+				t.Fatal(err)
+			}
+			session := c.session(t)
+			expire(session)
+			if err := c.sessions.store.Save(context.Background(), session, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := c.authorize("prompt=none"); err != ErrLoginRequired {
+				t.Fatalf("expected login_required after %s timeout, got %v", name, err)
+			}
+			if one, _ := c.sessions.store.Get(context.Background(), session.ID); one != nil {
+				t.Fatalf("expired session not removed: %+v", one)
+			}
+		})
+	}
+}
+
+func TestSessionCookieSignature(t *testing.T) {
+	c := newSessionTestClient(&SessionOption{Secret: []byte("secret")})
+	if _, err := c.authorize(""); err != nil {
+		t.Fatal(err)
+	}
+	c.cookie.Value = c.session(t).ID + ".forged"
+	if _, err := c.authorize("prompt=none"); err != ErrLoginRequired {
+		t.Fatalf("expected login_required with a forged cookie, got %v", err)
+	}
+}
+
+func TestSessionScopeHandlers(t *testing.T) {
+	sessions := newSessionManager(&SessionOption{Secret: []byte("secret")}, NewMemorySessionStore())
+	handler := getSessionUserAuthorizationHandler(sessions, func(w http.ResponseWriter, r *http.Request) (string, error) {
+		return "user1", nil
+	})
+	r := withSessionBinding(httptest.NewRequest(http.MethodGet, "/oauth2/authorize?client_id=client1", nil))
+	if _, err := handler(httptest.NewRecorder(), r); err != nil {
+		t.Fatal(err)
+	}
+	sessionID := boundSessionID(r)
+	if sessionID == "" {
+		t.Fatal("session not bound to the authorize request")
+	}
+
+	clientScope := sessionClientScopeHandler(nil)
+	tgr := &oauth2.TokenGenerateRequest{ClientID: "client1", Scope: "read", Request: r}
+	if allowed, err := clientScope(tgr); !allowed || err != nil || tgr.Scope != "read sid:"+sessionID {
+		t.Fatalf("session not recorded in scope: %s %v", tgr.Scope, err)
+	}
+	//客户端不能自己指定会话
+	forged := &oauth2.TokenGenerateRequest{ClientID: "client1", Scope: "read sid:other"}
+	if allowed, err := clientScope(forged); allowed || err != errors.ErrInvalidScope {
+		t.Fatalf("client supplied session accepted: %v", err)
+	}
+
+	refreshingScope := sessionRefreshingScopeHandler(nil)
+	refresh := &oauth2.TokenGenerateRequest{ClientID: "client1", Scope: "read"}
+	if allowed, err := refreshingScope(refresh, "read write sid:"+sessionID); !allowed || err != nil ||
+		refresh.Scope != "read sid:"+sessionID {
+		t.Fatalf("session lost after refresh: %s %v", refresh.Scope, err)
+	}
+	if scope, _ := httpserver.SplitAudience(refresh.Scope); scope != "read" {
+		t.Fatalf("session exposed as scope: %s", scope)
+	}
+}
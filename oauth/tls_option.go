@@ -0,0 +1,173 @@
+package oauth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TLSOption redis和mysql连接的TLS配置，也可以通过TokenStoreConnect.Extend设置，
+// 对应的key为 useTLS、tlsCAFile、tlsCAPEM、tlsCertFile、tlsKeyFile、tlsCertPEM、tlsKeyPEM、
+// tlsServerName、tlsCipherSuites、tlsMinVersion
+type TLSOption struct {
+	Enable       bool     //是否开启TLS，设置了其他TLS配置时自动开启
+	CAFile       string   //CA证书文件，为空时使用系统证书
+	CAPEM        string   //CA证书内容，可以与CAFile同时使用
+	CertFile     string   //客户端证书文件，双向认证时使用
+	KeyFile      string   //客户端私钥文件
+	CertPEM      string   //客户端证书内容
+	KeyPEM       string   //客户端私钥内容
+	ServerName   string   //校验服务端证书时使用的域名，为空时使用连接地址
+	CipherSuites []string //允许的加密套件名称，如TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256，只对TLS1.2生效
+	MinVersion   string   //最低版本，1.2或者1.3，默认1.2
+}
+
+// getTLSOption 合并结构体中的配置和Extend中的配置，结构体中的配置优先
+func getTLSOption(opt *TLSOption, extend func(key string) (interface{}, bool)) *TLSOption {
+	tlsOpt := &TLSOption{}
+	if opt != nil {
+		*tlsOpt = *opt
+	}
+	if !tlsOpt.Enable && extend != nil {
+		if useTLS, ok := extend("useTLS"); ok {
+			if useTLSBool, ok := useTLS.(bool); ok {
+				tlsOpt.Enable = useTLSBool
+			}
+		}
+	}
+	fields := []struct {
+		value *string
+		key   string
+	}{
+		{&tlsOpt.CAFile, "tlsCAFile"},
+		{&tlsOpt.CAPEM, "tlsCAPEM"},
+		{&tlsOpt.CertFile, "tlsCertFile"},
+		{&tlsOpt.KeyFile, "tlsKeyFile"},
+		{&tlsOpt.CertPEM, "tlsCertPEM"},
+		{&tlsOpt.KeyPEM, "tlsKeyPEM"},
+		{&tlsOpt.ServerName, "tlsServerName"},
+		{&tlsOpt.MinVersion, "tlsMinVersion"},
+	}
+	for _, field := range fields {
+		if *field.value == "" {
+			*field.value = extendString(extend, field.key)
+		}
+	}
+	if len(tlsOpt.CipherSuites) == 0 {
+		tlsOpt.CipherSuites = extendStrings(extend, "tlsCipherSuites")
+	}
+	return tlsOpt
+}
+
+// enabled 设置了任意TLS配置即开启
+func (opt *TLSOption) enabled() bool {
+	if opt == nil {
+		return false
+	}
+	return opt.Enable || opt.CAFile != "" || opt.CAPEM != "" || opt.CertFile != "" || opt.KeyFile != "" ||
+		opt.CertPEM != "" || opt.KeyPEM != "" || opt.ServerName != "" || len(opt.CipherSuites) > 0
+}
+
+// tlsConfig 生成tls.Config，未开启时返回nil，配置错误时返回errStoreConfig以及具体的原因
+func (opt *TLSOption) tlsConfig() (*tls.Config, error) {
+	if !opt.enabled() {
+		return nil, nil
+	}
+	tlsConfig, err := opt.newTLSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errStoreConfig, err)
+	}
+	return tlsConfig, nil
+}
+
+func (opt *TLSOption) newTLSConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: opt.ServerName,
+	}
+
+	switch opt.MinVersion {
+	case "", "1.2":
+	case "1.3":
+		tlsConfig.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("tls: unsupported min version %q, use 1.2 or 1.3", opt.MinVersion)
+	}
+
+	if opt.CAFile != "" || opt.CAPEM != "" {
+		pool := x509.NewCertPool()
+		if opt.CAFile != "" {
+			caPEM, err := os.ReadFile(opt.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("tls: read ca file: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(caPEM) {
+				return nil, fmt.Errorf("tls: no certificate found in ca file %s", opt.CAFile)
+			}
+		}
+		if opt.CAPEM != "" && !pool.AppendCertsFromPEM([]byte(opt.CAPEM)) {
+			return nil, fmt.Errorf("tls: no certificate found in ca pem")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	cert, err := opt.clientCertificate()
+	if err != nil {
+		return nil, err
+	}
+	if cert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*cert}
+	}
+
+	if len(opt.CipherSuites) > 0 {
+		tlsConfig.CipherSuites, err = cipherSuiteIDs(opt.CipherSuites)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tlsConfig, nil
+}
+
+// clientCertificate 双向认证的客户端证书，证书和私钥必须同时设置，只有私钥时返回错误
+func (opt *TLSOption) clientCertificate() (*tls.Certificate, error) {
+	switch {
+	case opt.CertFile != "" || opt.KeyFile != "":
+		if opt.CertFile == "" || opt.KeyFile == "" {
+			return nil, fmt.Errorf("tls: both cert file and key file are required")
+		}
+		cert, err := tls.LoadX509KeyPair(opt.CertFile, opt.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: load client certificate: %w", err)
+		}
+		return &cert, nil
+	case opt.CertPEM != "" || opt.KeyPEM != "":
+		if opt.CertPEM == "" || opt.KeyPEM == "" {
+			return nil, fmt.Errorf("tls: both cert pem and key pem are required")
+		}
+		cert, err := tls.X509KeyPair([]byte(opt.CertPEM), []byte(opt.KeyPEM))
+		if err != nil {
+			return nil, fmt.Errorf("tls: parse client certificate: %w", err)
+		}
+		return &cert, nil
+	}
+	return nil, nil
+}
+
+// cipherSuiteIDs 加密套件名称转换为id，不安全的套件不允许使用
+func cipherSuiteIDs(names []string) ([]uint16, error) {
+	suites := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		suites[suite.Name] = suite.ID
+	}
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := suites[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("tls: unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
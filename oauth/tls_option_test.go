@@ -0,0 +1,128 @@
+package oauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/go-redis/redis/v8"
+)
+
+// newTestCert 生成证书，parent为空时生成自签名的CA
+func newTestCert(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key,
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}))
+}
+
+func TestRedisTLS(t *testing.T) {
+	ca, caKey, caPEM, _ := newTestCert(t, "test-ca", nil, nil)
+	_, _, serverCertPEM, serverKeyPEM := newTestCert(t, "redis.internal", ca, caKey)
+	_, _, clientCertPEM, clientKeyPEM := newTestCert(t, "oauth-client", ca, caKey)
+
+	serverCert, err := tls.X509KeyPair([]byte(serverCertPEM), []byte(serverKeyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+	mr, err := miniredis.RunTLS(&tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	tlsConfig, err := (&TLSOption{
+		CAPEM:        caPEM,
+		CertPEM:      clientCertPEM,
+		KeyPEM:       clientKeyPEM,
+		ServerName:   "redis.internal",
+		CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+	}).tlsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr(), TLSConfig: tlsConfig})
+	defer func() {
+		_ = cli.Close()
+	}()
+	if err = cli.Ping(context.Background()).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opt := range []*TLSOption{
+		{CertPEM: clientCertPEM},
+		{KeyPEM: clientKeyPEM},
+		{KeyFile: "client.key"},
+		{CAPEM: "not a certificate"},
+		{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		{Enable: true, MinVersion: "1.0"},
+	} {
+		if _, err = opt.tlsConfig(); !errors.Is(err, errStoreConfig) {
+			t.Fatalf("expected config error for %+v, got %v", opt, err)
+		}
+	}
+}
+
+func TestStoreStartupFailed(t *testing.T) {
+	_, configErr := (&TLSOption{KeyPEM: "key without cert"}).tlsConfig()
+	connErr := errors.New("connection refused")
+	cases := []struct {
+		opt    *StoreOption
+		err    error
+		failed bool
+	}{
+		{nil, nil, false},
+		{nil, connErr, false},
+		{&StoreOption{StartupMode: StoreStartupError}, connErr, true},
+		//配置错误时不使用内存存储
+		{nil, configErr, true},
+		{&StoreOption{StartupMode: StoreStartupResilient}, configErr, true},
+	}
+	for _, one := range cases {
+		if failed := storeStartupFailed(one.opt, one.err); failed != one.failed {
+			t.Fatalf("%+v %v: unexpected %v", one.opt, one.err, failed)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package oauth
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"sync"
+	"time"
+
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+	redis "github.com/go-redis/redis/v8"
+)
+
+// TokenCacheOption 本地缓存的配置，缓存access和refresh token的查询结果，减少对存储的访问
+type TokenCacheOption struct {
+	Size        int           //最多缓存的数量，默认10000
+	TTL         time.Duration //缓存时间，不会超过token的过期时间，默认1分钟
+	NegativeTTL time.Duration //不存在的token的缓存时间，默认5秒，小于0时不缓存
+	Channel     string        //redis中用于通知其他实例删除缓存的频道，默认为 {keyNamespace}token-cache
+}
+
+type tokenCacheEntry struct {
+	key      string
+	ti       oauth2.TokenInfo //为空表示token不存在
+	expireAt time.Time
+}
+
+// tokenLRU 有大小限制的LRU缓存
+type tokenLRU struct {
+	lock  sync.Mutex
+	size  int
+	list  *list.List
+	items map[string]*list.Element
+}
+
+func newTokenLRU(size int) *tokenLRU {
+	return &tokenLRU{
+		size:  size,
+		list:  list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+func (c *tokenLRU) get(key string) (*tokenCacheEntry, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*tokenCacheEntry)
+	if !time.Now().Before(entry.expireAt) {
+		c.list.Remove(elem)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.list.MoveToFront(elem)
+	return entry, true
+}
+
+func (c *tokenLRU) set(entry *tokenCacheEntry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if elem, ok := c.items[entry.key]; ok {
+		elem.Value = entry
+		c.list.MoveToFront(elem)
+		return
+	}
+	c.items[entry.key] = c.list.PushFront(entry)
+	for c.list.Len() > c.size {
+		oldest := c.list.Back()
+		c.list.Remove(oldest)
+		delete(c.items, oldest.Value.(*tokenCacheEntry).key)
+	}
+}
+
+func (c *tokenLRU) remove(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.list.Remove(elem)
+		delete(c.items, key)
+	}
+}
+
+// cachedTokenStore 在存储前面加一层本地缓存，删除token时通过redis通知其他实例
+type cachedTokenStore struct {
+	oauth2.TokenStore
+	opt     TokenCacheOption
+	cache   *tokenLRU
+	cli     redis.UniversalClient //为空时只删除本地缓存
+	channel string
+}
+
+// newCachedTokenStore cli不为空时订阅其他实例的删除通知
+func newCachedTokenStore(ts oauth2.TokenStore, opt *TokenCacheOption, cli redis.UniversalClient, keyNamespace string) *cachedTokenStore {
+	s := &cachedTokenStore{
+		TokenStore: ts,
+		opt:        *opt,
+		cli:        cli,
+		channel:    opt.Channel,
+	}
+	if s.opt.Size <= 0 {
+		s.opt.Size = 10000
+	}
+	if s.opt.TTL <= 0 {
+		s.opt.TTL = time.Minute
+	}
+	if s.opt.NegativeTTL == 0 {
+		s.opt.NegativeTTL = 5 * time.Second
+	}
+	if s.channel == "" {
+		s.channel = keyNamespace + "token-cache"
+	}
+	s.cache = newTokenLRU(s.opt.Size)
+	if cli != nil {
+		go s.subscribe()
+	}
+	return s
+}
+
+// tokenCacheKey 缓存和通知中只使用token的摘要
+func tokenCacheKey(kind, token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return kind + ":" + hex.EncodeToString(sum[:])
+}
+
+// subscribe 接收其他实例的删除通知，连接断开时go-redis会自动重连
+func (s *cachedTokenStore) subscribe() {
+	pubSub := s.cli.Subscribe(context.Background(), s.channel)
+	for msg := range pubSub.Channel() {
+		s.cache.remove(msg.Payload)
+	}
+}
+
+// invalidate 删除本地缓存，并通知其他实例
+func (s *cachedTokenStore) invalidate(ctx context.Context, key string) {
+	s.cache.remove(key)
+	if s.cli == nil {
+		return
+	}
+	if err := s.cli.Publish(ctx, s.channel, key).Err(); err != nil {
+		log.Println("token cache publish error:", err)
+	}
+}
+
+func (s *cachedTokenStore) get(ctx context.Context, key string, load func() (oauth2.TokenInfo, error)) (oauth2.TokenInfo, error) {
+	if entry, ok := s.cache.get(key); ok {
+		if entry.ti == nil {
+			return nil, nil
+		}
+		//验证token时会修改token的创建时间，不能返回缓存中的对象
+		return copyTokenInfo(entry.ti), nil
+	}
+	ti, err := load()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	entry := &tokenCacheEntry{key: key, expireAt: now.Add(s.opt.TTL)}
+	if ti == nil {
+		if s.opt.NegativeTTL < 0 {
+			return nil, nil
+		}
+		entry.expireAt = now.Add(s.opt.NegativeTTL)
+	} else {
+		entry.ti = copyTokenInfo(ti)
+		if exp := tokenExpireAt(ti, key); !exp.IsZero() && exp.Before(entry.expireAt) {
+			entry.expireAt = exp
+		}
+	}
+	s.cache.set(entry)
+	return ti, nil
+}
+
+// tokenExpireAt 缓存时间不超过token的过期时间，过期时间为0表示不过期
+func tokenExpireAt(ti oauth2.TokenInfo, key string) time.Time {
+	if key[0] == 'r' {
+		if ti.GetRefreshExpiresIn() <= 0 {
+			return time.Time{}
+		}
+		return ti.GetRefreshCreateAt().Add(ti.GetRefreshExpiresIn())
+	}
+	if ti.GetAccessExpiresIn() <= 0 {
+		return time.Time{}
+	}
+	return ti.GetAccessCreateAt().Add(ti.GetAccessExpiresIn())
+}
+
+// Create 新生成的token可能之前被缓存为不存在
+func (s *cachedTokenStore) Create(ctx context.Context, info oauth2.TokenInfo) error {
+	if err := s.TokenStore.Create(ctx, info); err != nil {
+		return err
+	}
+	if access := info.GetAccess(); access != "" {
+		s.cache.remove(tokenCacheKey("a", access))
+	}
+	if refresh := info.GetRefresh(); refresh != "" {
+		s.cache.remove(tokenCacheKey("r", refresh))
+	}
+	return nil
+}
+
+// RemoveByAccess use the access token to delete the token information
+func (s *cachedTokenStore) RemoveByAccess(ctx context.Context, access string) error {
+	if err := s.TokenStore.RemoveByAccess(ctx, access); err != nil {
+		return err
+	}
+	s.invalidate(ctx, tokenCacheKey("a", access))
+	return nil
+}
+
+// RemoveByRefresh use the refresh token to delete the token information
+func (s *cachedTokenStore) RemoveByRefresh(ctx context.Context, refresh string) error {
+	if err := s.TokenStore.RemoveByRefresh(ctx, refresh); err != nil {
+		return err
+	}
+	s.invalidate(ctx, tokenCacheKey("r", refresh))
+	return nil
+}
+
+// GetByAccess use the access token for token information data
+func (s *cachedTokenStore) GetByAccess(ctx context.Context, access string) (oauth2.TokenInfo, error) {
+	return s.get(ctx, tokenCacheKey("a", access), func() (oauth2.TokenInfo, error) {
+		return s.TokenStore.GetByAccess(ctx, access)
+	})
+}
+
+// GetByRefresh use the refresh token for token information data
+func (s *cachedTokenStore) GetByRefresh(ctx context.Context, refresh string) (oauth2.TokenInfo, error) {
+	return s.get(ctx, tokenCacheKey("r", refresh), func() (oauth2.TokenInfo, error) {
+		return s.TokenStore.GetByRefresh(ctx, refresh)
+	})
+}
@@ -0,0 +1,87 @@
+package oauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-oauth2/oauth2/v4/models"
+	redis "github.com/go-redis/redis/v8"
+)
+
+func TestCachedTokenStore(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	ctx := context.Background()
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	backend := newRedisTokenStore(cli, defaultKeyNamespace)
+	opt := &TokenCacheOption{Size: 10, NegativeTTL: time.Minute}
+	storeA := newCachedTokenStore(backend, opt, cli, defaultKeyNamespace)
+	storeB := newCachedTokenStore(backend, opt, cli, defaultKeyNamespace)
+	waitFor(t, func() bool {
+		return mr.PubSubNumSub(storeA.channel)[storeA.channel] == 2
+	})
+
+	err = backend.Create(ctx, &models.Token{
+		ClientID:        "client1",
+		Access:          "access1",
+		AccessCreateAt:  time.Now(),
+		AccessExpiresIn: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ti, err := storeA.GetByAccess(ctx, "access1"); err != nil || ti == nil {
+		t.Fatalf("token not found: %v %v", ti, err)
+	}
+	mr.FlushAll()
+	if ti, _ := storeA.GetByAccess(ctx, "access1"); ti == nil {
+		t.Fatal("token not cached")
+	}
+
+	//其他实例删除以后通知本实例
+	if err = storeB.RemoveByAccess(ctx, "access1"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		ti, _ := storeA.GetByAccess(ctx, "access1")
+		return ti == nil
+	})
+
+	//不存在的token也会缓存，通过本实例生成时删除缓存
+	token := &models.Token{
+		ClientID:        "client1",
+		Access:          "access2",
+		AccessCreateAt:  time.Now(),
+		AccessExpiresIn: time.Hour,
+	}
+	if ti, _ := storeA.GetByAccess(ctx, "access2"); ti != nil {
+		t.Fatal("unexpected token")
+	}
+	_ = backend.Create(ctx, token)
+	if ti, _ := storeA.GetByAccess(ctx, "access2"); ti != nil {
+		t.Fatal("negative result not cached")
+	}
+	if err = storeA.Create(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	if ti, _ := storeA.GetByAccess(ctx, "access2"); ti == nil {
+		t.Fatal("negative result not removed")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("condition not met")
+}
@@ -0,0 +1,285 @@
+package oauth
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+)
+
+// encryptedTokenPrefix 加密后的数据格式为 enc:{keyID}:{base64(nonce+密文)}
+const encryptedTokenPrefix = "enc:"
+
+// TokenEncryptOption 使用AES-GCM加密存储中token的用户、scope等信息，所有存储方式都适用
+type TokenEncryptOption struct {
+	KeyID string            //加密使用的密钥
+	Keys  map[string][]byte //所有密钥，长度为16、24或32字节，更换密钥以后旧的密钥需要保留到旧token全部过期
+}
+
+// tokenPayload 需要加密的信息，client id用于按客户端查询和批量删除，不加密
+type tokenPayload struct {
+	UserID        string `json:"user_id,omitempty"`
+	Scope         string `json:"scope,omitempty"`
+	RedirectURI   string `json:"redirect_uri,omitempty"`
+	CodeChallenge string `json:"code_challenge,omitempty"`
+}
+
+type tokenCipher struct {
+	keyID     string
+	aeads     map[string]cipher.AEAD
+	blindKeys map[string][]byte //由密钥派生，用于计算索引中用户id的HMAC
+}
+
+func newTokenCipher(opt *TokenEncryptOption) (*tokenCipher, error) {
+	if _, ok := opt.Keys[opt.KeyID]; !ok {
+		return nil, fmt.Errorf("token encrypt: key %q not found", opt.KeyID)
+	}
+	c := &tokenCipher{keyID: opt.KeyID, aeads: make(map[string]cipher.AEAD), blindKeys: make(map[string][]byte)}
+	for id, key := range opt.Keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("token encrypt: invalid key id %q", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("token encrypt: key %q: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.aeads[id] = aead
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte("token index"))
+		c.blindKeys[id] = mac.Sum(nil)
+	}
+	return c, nil
+}
+
+// sealData 使用当前密钥加密，返回 enc:{keyID}:{base64(nonce+密文)}
+func (c *tokenCipher) sealData(data []byte, additional string) (string, error) {
+	aead := c.aeads[c.keyID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, data, []byte(additional))
+	return encryptedTokenPrefix + c.keyID + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// openData 按数据中的keyID解密sealData的结果
+func (c *tokenCipher) openData(value string, additional string) ([]byte, error) {
+	keyID, encoded, ok := strings.Cut(strings.TrimPrefix(value, encryptedTokenPrefix), ":")
+	if !ok {
+		return nil, fmt.Errorf("token encrypt: invalid data")
+	}
+	aead, ok := c.aeads[keyID]
+	if !ok {
+		return nil, fmt.Errorf("token encrypt: key %q not found", keyID)
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("token encrypt: invalid data")
+	}
+	data, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(additional))
+	if err != nil {
+		return nil, fmt.Errorf("token encrypt: %w", err)
+	}
+	return data, nil
+}
+
+// blind 使用当前密钥计算用户id的HMAC，索引中按HMAC查询用户
+func (c *tokenCipher) blind(userID string) string {
+	mac := hmac.New(sha256.New, c.blindKeys[c.keyID])
+	mac.Write([]byte(userID))
+	return hashedTokenPrefix + c.keyID + ":" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// seal 返回加密后的副本，加密的信息都保存在user id中，client id作为附加数据防止被移到其他客户端
+func (c *tokenCipher) seal(ti oauth2.TokenInfo) (oauth2.TokenInfo, error) {
+	data, err := json.Marshal(&tokenPayload{
+		UserID:        ti.GetUserID(),
+		Scope:         ti.GetScope(),
+		RedirectURI:   ti.GetRedirectURI(),
+		CodeChallenge: ti.GetCodeChallenge(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := c.sealData(data, ti.GetClientID())
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted := copyTokenInfo(ti)
+	encrypted.SetUserID(sealed)
+	encrypted.SetScope("")
+	encrypted.SetRedirectURI("")
+	encrypted.SetCodeChallenge("")
+	return encrypted, nil
+}
+
+// open 解密存储中取出的token，未加密的token直接返回，兼容开启加密前保存的token
+func (c *tokenCipher) open(ti oauth2.TokenInfo) (oauth2.TokenInfo, error) {
+	if ti == nil || !strings.HasPrefix(ti.GetUserID(), encryptedTokenPrefix) {
+		return ti, nil
+	}
+	data, err := c.openData(ti.GetUserID(), ti.GetClientID())
+	if err != nil {
+		return nil, err
+	}
+	var payload tokenPayload
+	if err = json.Unmarshal(data, &payload); err != nil {
+		return nil, err
+	}
+	ti.SetUserID(payload.UserID)
+	ti.SetScope(payload.Scope)
+	ti.SetRedirectURI(payload.RedirectURI)
+	ti.SetCodeChallenge(payload.CodeChallenge)
+	return ti, nil
+}
+
+// encryptedTokenStore 保存时加密，读取时解密
+type encryptedTokenStore struct {
+	oauth2.TokenStore
+	cipher *tokenCipher
+}
+
+// Create create and store the new token information
+func (s *encryptedTokenStore) Create(ctx context.Context, info oauth2.TokenInfo) error {
+	encrypted, err := s.cipher.seal(info)
+	if err != nil {
+		return err
+	}
+	return s.TokenStore.Create(ctx, encrypted)
+}
+
+// GetByCode use the authorization code for token information data
+func (s *encryptedTokenStore) GetByCode(ctx context.Context, code string) (oauth2.TokenInfo, error) {
+	ti, err := s.TokenStore.GetByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	return s.cipher.open(ti)
+}
+
+// GetByAccess use the access token for token information data
+func (s *encryptedTokenStore) GetByAccess(ctx context.Context, access string) (oauth2.TokenInfo, error) {
+	ti, err := s.TokenStore.GetByAccess(ctx, access)
+	if err != nil {
+		return nil, err
+	}
+	return s.cipher.open(ti)
+}
+
+// GetByRefresh use the refresh token for token information data
+func (s *encryptedTokenStore) GetByRefresh(ctx context.Context, refresh string) (oauth2.TokenInfo, error) {
+	ti, err := s.TokenStore.GetByRefresh(ctx, refresh)
+	if err != nil {
+		return nil, err
+	}
+	return s.cipher.open(ti)
+}
+
+// encryptedTokenPurger 批量删除时解密以后再判断是否满足条件
+type encryptedTokenPurger struct {
+	TokenPurger
+	cipher *tokenCipher
+}
+
+// PurgeTokens 无法解密的token不删除
+func (p *encryptedTokenPurger) PurgeTokens(ctx context.Context, match func(ti oauth2.TokenInfo) bool) (int, error) {
+	return p.TokenPurger.PurgeTokens(ctx, func(ti oauth2.TokenInfo) bool {
+		decrypted, err := p.cipher.open(ti)
+		return err == nil && match(decrypted)
+	})
+}
+
+// encryptedTokenIndex 索引中的用户id保存为HMAC，用户id和scope加密后保存在Scope中，
+// 更换KeyID以后，旧密钥写入的记录不能再按用户查询，仍然可以按客户端查询
+type encryptedTokenIndex struct {
+	TokenIndex
+	cipher *tokenCipher
+}
+
+// sealRecord 返回加密后的副本
+func (idx *encryptedTokenIndex) sealRecord(record *TokenRecord) (*TokenRecord, error) {
+	data, err := json.Marshal(&tokenPayload{UserID: record.UserID, Scope: record.Scope})
+	if err != nil {
+		return nil, err
+	}
+	encrypted := *record
+	if encrypted.Scope, err = idx.cipher.sealData(data, record.ClientID); err != nil {
+		return nil, err
+	}
+	if record.UserID != "" {
+		encrypted.UserID = idx.cipher.blind(record.UserID)
+	}
+	return &encrypted, nil
+}
+
+// Add 新增加密的索引
+func (idx *encryptedTokenIndex) Add(ctx context.Context, record *TokenRecord) error {
+	encrypted, err := idx.sealRecord(record)
+	if err != nil {
+		return err
+	}
+	return idx.TokenIndex.Add(ctx, encrypted)
+}
+
+// Remove 按用户id的HMAC删除索引
+func (idx *encryptedTokenIndex) Remove(ctx context.Context, record *TokenRecord) error {
+	encrypted := *record
+	if record.UserID != "" {
+		encrypted.UserID = idx.cipher.blind(record.UserID)
+	}
+	return idx.TokenIndex.Remove(ctx, &encrypted)
+}
+
+// open 解密查询到的记录，无法解密的记录不返回，未加密的记录直接返回
+func (idx *encryptedTokenIndex) open(records []*TokenRecord, total int, err error) ([]*TokenRecord, int, error) {
+	if err != nil {
+		return nil, 0, err
+	}
+	list := make([]*TokenRecord, 0, len(records))
+	for _, record := range records {
+		if !strings.HasPrefix(record.Scope, encryptedTokenPrefix) {
+			list = append(list, record)
+			continue
+		}
+		var payload tokenPayload
+		data, err := idx.cipher.openData(record.Scope, record.ClientID)
+		if err == nil {
+			err = json.Unmarshal(data, &payload)
+		}
+		if err != nil {
+			log.Println("token index decrypt error:", record.ID, err)
+			total--
+			continue
+		}
+		decrypted := *record
+		decrypted.UserID = payload.UserID
+		decrypted.Scope = payload.Scope
+		list = append(list, &decrypted)
+	}
+	return list, total, nil
+}
+
+// ListByUser 按用户id的HMAC查询
+func (idx *encryptedTokenIndex) ListByUser(ctx context.Context, userID string, offset, limit int) ([]*TokenRecord, int, error) {
+	return idx.open(idx.TokenIndex.ListByUser(ctx, idx.cipher.blind(userID), offset, limit))
+}
+
+// ListByClient 客户端的token
+func (idx *encryptedTokenIndex) ListByClient(ctx context.Context, clientID string, offset, limit int) ([]*TokenRecord, int, error) {
+	return idx.open(idx.TokenIndex.ListByClient(ctx, clientID, offset, limit))
+}
@@ -0,0 +1,110 @@
+package oauth
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/models"
+	redis "github.com/go-redis/redis/v8"
+)
+
+func TestEncryptedTokenStore(t *testing.T) {
+	ctx := context.Background()
+	backend, err := newMemoryTokenStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string][]byte{"k1": bytes.Repeat([]byte("1"), 32)}
+	tokenCipher, err := newTokenCipher(&TokenEncryptOption{KeyID: "k1", Keys: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := &encryptedTokenStore{TokenStore: backend, cipher: tokenCipher}
+	err = ts.Create(ctx, &models.Token{
+		ClientID:        "client1",
+		UserID:          "user1",
+		Scope:           "read",
+		Access:          "access1",
+		AccessCreateAt:  time.Now(),
+		AccessExpiresIn: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := backend.GetByAccess(ctx, "access1")
+	if raw == nil || !strings.HasPrefix(raw.GetUserID(), encryptedTokenPrefix+"k1:") || raw.GetScope() != "" {
+		t.Fatalf("token not encrypted: %v", raw)
+	}
+
+	//更换密钥以后旧的token仍然可以读取
+	keys["k2"] = bytes.Repeat([]byte("2"), 16)
+	tokenCipher, err = newTokenCipher(&TokenEncryptOption{KeyID: "k2", Keys: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts = &encryptedTokenStore{TokenStore: backend, cipher: tokenCipher}
+	ti, err := ts.GetByAccess(ctx, "access1")
+	if err != nil || ti.GetUserID() != "user1" || ti.GetScope() != "read" {
+		t.Fatalf("token not decrypted: %v %v", ti, err)
+	}
+
+	purger := &encryptedTokenPurger{TokenPurger: backend, cipher: tokenCipher}
+	n, err := purger.PurgeTokens(ctx, func(ti oauth2.TokenInfo) bool {
+		return ti.GetUserID() == "user1"
+	})
+	if err != nil || n != 1 {
+		t.Fatalf("unexpected purge: %d %v", n, err)
+	}
+}
+
+func TestEncryptedTokenIndex(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	ctx := context.Background()
+	keys := map[string][]byte{"k1": bytes.Repeat([]byte("1"), 32)}
+	tokenCipher, err := newTokenCipher(&TokenEncryptOption{KeyID: "k1", Keys: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	index := &encryptedTokenIndex{TokenIndex: NewRedisTokenIndex(cli, defaultKeyNamespace), cipher: tokenCipher}
+	err = index.Add(ctx, newTokenRecord(ctx, &models.Token{
+		ClientID:        "client1",
+		UserID:          "secret-user",
+		Scope:           "secret-scope",
+		Access:          "access1",
+		AccessCreateAt:  time.Now(),
+		AccessExpiresIn: time.Hour,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range mr.Keys() {
+		if strings.Contains(key, "secret-user") {
+			t.Fatalf("user id in index key: %s", key)
+		}
+		if value, err := mr.Get(key); err == nil && (strings.Contains(value, "secret-user") || strings.Contains(value, "secret-scope")) {
+			t.Fatalf("index record not encrypted: %s", value)
+		}
+	}
+
+	list, total, err := index.ListByUser(ctx, "secret-user", 0, 10)
+	if err != nil || total != 1 || len(list) != 1 || list[0].UserID != "secret-user" || list[0].Scope != "secret-scope" {
+		t.Fatalf("unexpected list: %d %+v %v", total, list, err)
+	}
+	if err = index.Remove(ctx, newTokenRecord(ctx, &models.Token{ClientID: "client1", UserID: "secret-user", Access: "access1"})); err != nil {
+		t.Fatal(err)
+	}
+	if list, total, err = index.ListByClient(ctx, "client1", 0, 10); err != nil || total != 0 || len(list) != 0 {
+		t.Fatalf("unexpected list after remove: %d %+v %v", total, list, err)
+	}
+}
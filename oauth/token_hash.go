@@ -0,0 +1,211 @@
+package oauth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strings"
+
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+)
+
+const (
+	hashedTokenPrefix = "hmac:"   //存储中的token都带有该前缀
+	storedTokenPrefix = "stored:" //从存储中读取的HMAC，只能用于删除，不能用于查询
+)
+
+// TokenHashOption 存储中只保存token的HMAC，存储的数据泄露以后也无法使用其中的token
+type TokenHashOption struct {
+	Pepper         string //计算HMAC的密钥，只保存在服务端，修改以后已经生成的token全部失效
+	AllowPlaintext bool   //兼容开启前以明文保存的token，读取时转换为HMAC保存，旧token全部过期以后可以关闭
+}
+
+// hashedTokenStore 以HMAC作为授权码、access和refresh token保存，查询时还原查询使用的明文
+type hashedTokenStore struct {
+	oauth2.TokenStore
+	pepper         []byte
+	sealKey        []byte //标记从存储中读取的HMAC，每个进程随机生成
+	allowPlaintext bool
+}
+
+func newHashedTokenStore(ts oauth2.TokenStore, opt *TokenHashOption) *hashedTokenStore {
+	sealKey := make([]byte, 32)
+	_, _ = rand.Read(sealKey)
+	return &hashedTokenStore{
+		TokenStore:     ts,
+		pepper:         []byte(opt.Pepper),
+		sealKey:        sealKey,
+		allowPlaintext: opt.AllowPlaintext,
+	}
+}
+
+// hash 调用方传入的token都重新计算，存储中的HMAC不能直接作为token使用
+func (s *hashedTokenStore) hash(token string) string {
+	if token == "" {
+		return token
+	}
+	mac := hmac.New(sha256.New, s.pepper)
+	mac.Write([]byte(token))
+	return hashedTokenPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// seal 从存储中读取的HMAC加上本进程的签名，刷新token时用于删除旧token，数据泄露以后也无法伪造
+func (s *hashedTokenStore) seal(hashed string) string {
+	if hashed == "" {
+		return hashed
+	}
+	mac := hmac.New(sha256.New, s.sealKey)
+	mac.Write([]byte(hashed))
+	return storedTokenPrefix + hashed + "." + hex.EncodeToString(mac.Sum(nil))
+}
+
+// unseal 还原seal的HMAC，签名不正确时返回false
+func (s *hashedTokenStore) unseal(token string) (string, bool) {
+	if !strings.HasPrefix(token, storedTokenPrefix) {
+		return "", false
+	}
+	i := strings.LastIndexByte(token, '.')
+	if i < len(storedTokenPrefix) {
+		return "", false
+	}
+	hashed := token[len(storedTokenPrefix):i]
+	return hashed, hmac.Equal([]byte(s.seal(hashed)), []byte(token))
+}
+
+// sealTokenInfo 读取的token中的HMAC都加上签名，查询使用的字段随后设置为明文
+func (s *hashedTokenStore) sealTokenInfo(ti oauth2.TokenInfo) {
+	ti.SetCode(s.seal(ti.GetCode()))
+	ti.SetAccess(s.seal(ti.GetAccess()))
+	ti.SetRefresh(s.seal(ti.GetRefresh()))
+}
+
+func (s *hashedTokenStore) hashTokenInfo(info oauth2.TokenInfo) oauth2.TokenInfo {
+	hashed := copyTokenInfo(info)
+	hashed.SetCode(s.hash(info.GetCode()))
+	hashed.SetAccess(s.hash(info.GetAccess()))
+	hashed.SetRefresh(s.hash(info.GetRefresh()))
+	return hashed
+}
+
+// Create create and store the new token information
+func (s *hashedTokenStore) Create(ctx context.Context, info oauth2.TokenInfo) error {
+	return s.TokenStore.Create(ctx, s.hashTokenInfo(info))
+}
+
+// get 先按HMAC查询，兼容明文时再按明文查询，查到以后转换为HMAC保存
+func (s *hashedTokenStore) get(ctx context.Context, token string, load func(string) (oauth2.TokenInfo, error)) (oauth2.TokenInfo, error) {
+	hashed := s.hash(token)
+	ti, err := load(hashed)
+	if ti != nil {
+		s.sealTokenInfo(ti)
+	}
+	if err != nil || ti != nil || !s.plaintext(token) {
+		return ti, err
+	}
+	ti, err = load(token)
+	if err != nil || ti == nil {
+		return ti, err
+	}
+	if err = s.upgrade(ctx, ti); err != nil {
+		log.Println("token hash upgrade error:", err)
+	}
+	return ti, nil
+}
+
+// upgrade 以HMAC保存明文的token，并删除明文
+func (s *hashedTokenStore) upgrade(ctx context.Context, ti oauth2.TokenInfo) error {
+	if err := s.TokenStore.Create(ctx, s.hashTokenInfo(ti)); err != nil {
+		return err
+	}
+	if code := ti.GetCode(); code != "" {
+		return s.TokenStore.RemoveByCode(ctx, code)
+	}
+	if refresh := ti.GetRefresh(); refresh != "" {
+		if err := s.TokenStore.RemoveByRefresh(ctx, refresh); err != nil {
+			return err
+		}
+	}
+	return s.TokenStore.RemoveByAccess(ctx, ti.GetAccess())
+}
+
+// RemoveByCode delete the authorization code
+func (s *hashedTokenStore) RemoveByCode(ctx context.Context, code string) error {
+	return s.remove(code, func(token string) error {
+		return s.TokenStore.RemoveByCode(ctx, token)
+	})
+}
+
+// RemoveByAccess use the access token to delete the token information
+func (s *hashedTokenStore) RemoveByAccess(ctx context.Context, access string) error {
+	return s.remove(access, func(token string) error {
+		return s.TokenStore.RemoveByAccess(ctx, token)
+	})
+}
+
+// RemoveByRefresh use the refresh token to delete the token information
+func (s *hashedTokenStore) RemoveByRefresh(ctx context.Context, refresh string) error {
+	return s.remove(refresh, func(token string) error {
+		return s.TokenStore.RemoveByRefresh(ctx, token)
+	})
+}
+
+// remove 兼容明文时明文的记录也需要删除
+func (s *hashedTokenStore) remove(token string, remove func(string) error) error {
+	if hashed, ok := s.unseal(token); ok {
+		return s.removeStored(hashed, remove)
+	}
+	hashed := s.hash(token)
+	if err := remove(hashed); err != nil {
+		return err
+	}
+	if s.plaintext(token) {
+		return remove(token)
+	}
+	return nil
+}
+
+// plaintext 兼容明文时是否按明文查询，带有HMAC前缀的值是存储中的值，不是明文的token
+func (s *hashedTokenStore) plaintext(token string) bool {
+	return s.allowPlaintext && !strings.HasPrefix(token, hashedTokenPrefix)
+}
+
+// removeStored 使用从存储中读取的HMAC删除，例如刷新token时删除旧的access token
+func (s *hashedTokenStore) removeStored(hashed string, remove func(string) error) error {
+	return remove(hashed)
+}
+
+// GetByCode use the authorization code for token information data
+func (s *hashedTokenStore) GetByCode(ctx context.Context, code string) (oauth2.TokenInfo, error) {
+	ti, err := s.get(ctx, code, func(token string) (oauth2.TokenInfo, error) {
+		return s.TokenStore.GetByCode(ctx, token)
+	})
+	if ti != nil {
+		ti.SetCode(code)
+	}
+	return ti, err
+}
+
+// GetByAccess use the access token for token information data
+func (s *hashedTokenStore) GetByAccess(ctx context.Context, access string) (oauth2.TokenInfo, error) {
+	ti, err := s.get(ctx, access, func(token string) (oauth2.TokenInfo, error) {
+		return s.TokenStore.GetByAccess(ctx, token)
+	})
+	if ti != nil {
+		ti.SetAccess(access)
+	}
+	return ti, err
+}
+
+// GetByRefresh use the refresh token for token information data
+func (s *hashedTokenStore) GetByRefresh(ctx context.Context, refresh string) (oauth2.TokenInfo, error) {
+	ti, err := s.get(ctx, refresh, func(token string) (oauth2.TokenInfo, error) {
+		return s.TokenStore.GetByRefresh(ctx, token)
+	})
+	if ti != nil {
+		ti.SetRefresh(refresh)
+	}
+	return ti, err
+}
@@ -0,0 +1,110 @@
+package oauth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-oauth2/oauth2/v4/models"
+)
+
+func TestHashedTokenStore(t *testing.T) {
+	ctx := context.Background()
+	backend, err := newMemoryTokenStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newHashedTokenStore(backend, &TokenHashOption{Pepper: "pepper", AllowPlaintext: true})
+
+	err = ts.Create(ctx, &models.Token{
+		ClientID:         "client1",
+		Access:           "access1",
+		AccessCreateAt:   time.Now(),
+		AccessExpiresIn:  time.Hour,
+		Refresh:          "refresh1",
+		RefreshCreateAt:  time.Now(),
+		RefreshExpiresIn: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ti, _ := backend.GetByAccess(ctx, "access1"); ti != nil {
+		t.Fatal("plaintext token stored")
+	}
+	ti, err := ts.GetByRefresh(ctx, "refresh1")
+	if err != nil || ti == nil || ti.GetRefresh() != "refresh1" {
+		t.Fatalf("token not found: %v %v", ti, err)
+	}
+	//刷新token时使用存储中的access删除旧token
+	if err = ts.RemoveByAccess(ctx, ti.GetAccess()); err != nil {
+		t.Fatal(err)
+	}
+	if ti, _ = ts.GetByAccess(ctx, "access1"); ti != nil {
+		t.Fatal("token not removed")
+	}
+
+	//开启前保存的明文token，读取以后转换为HMAC
+	err = backend.Create(ctx, &models.Token{
+		ClientID:        "client1",
+		Access:          "access2",
+		AccessCreateAt:  time.Now(),
+		AccessExpiresIn: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ti, _ = ts.GetByAccess(ctx, "access2"); ti == nil {
+		t.Fatal("plaintext token not found")
+	}
+	if ti, _ = backend.GetByAccess(ctx, "access2"); ti != nil {
+		t.Fatal("plaintext token not removed")
+	}
+	if ti, _ = backend.GetByAccess(ctx, ts.hash("access2")); ti == nil {
+		t.Fatal("plaintext token not upgraded")
+	}
+}
+
+func TestHashedTokenStoreRejectsStoredValue(t *testing.T) {
+	ctx := context.Background()
+	backend, err := newMemoryTokenStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := newHashedTokenStore(backend, &TokenHashOption{Pepper: "pepper", AllowPlaintext: true})
+	err = ts.Create(ctx, &models.Token{
+		ClientID:         "client1",
+		Access:           "secret-access",
+		AccessCreateAt:   time.Now(),
+		AccessExpiresIn:  time.Hour,
+		Refresh:          "secret-refresh",
+		RefreshCreateAt:  time.Now(),
+		RefreshExpiresIn: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := backend.GetByRefresh(ctx, ts.hash("secret-refresh"))
+	if err != nil || stored == nil {
+		t.Fatalf("token not stored: %v", err)
+	}
+
+	//存储泄露的HMAC不能作为token使用
+	if ti, _ := ts.GetByAccess(ctx, stored.GetAccess()); ti != nil {
+		t.Fatal("stored access hash accepted as token")
+	}
+	if ti, _ := ts.GetByRefresh(ctx, stored.GetRefresh()); ti != nil {
+		t.Fatal("stored refresh hash accepted as token")
+	}
+	//伪造的签名不能删除token
+	if err = ts.RemoveByAccess(ctx, storedTokenPrefix+stored.GetAccess()+".00"); err != nil {
+		t.Fatal(err)
+	}
+	if ti, _ := ts.GetByAccess(ctx, "secret-access"); ti == nil {
+		t.Fatal("token removed with forged seal")
+	}
+	//读取时返回的值也不能用于查询
+	ti, _ := ts.GetByRefresh(ctx, "secret-refresh")
+	if found, _ := ts.GetByAccess(ctx, ti.GetAccess()); found != nil {
+		t.Fatal("sealed access accepted as token")
+	}
+}
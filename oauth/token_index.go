@@ -0,0 +1,320 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/models"
+	"github.com/tianlin0/go-plat-oauth/oauth/ginserver"
+	"github.com/tianlin0/go-plat-utils/utils/httputil"
+)
+
+const (
+	defaultTokenPageSize = 20
+	maxTokenPageSize     = 100
+)
+
+// TokenRecord 索引中的token记录
+type TokenRecord struct {
+	ID               string           `json:"id"` //access token的摘要，索引中不保存token
+	UserID           string           `json:"user_id"`
+	ClientID         string           `json:"client_id"`
+	Scope            string           `json:"scope"`
+	GrantType        oauth2.GrantType `json:"grant_type"`
+	CreateAt         time.Time        `json:"create_at"`
+	ExpiresAt        time.Time        `json:"expires_at"`
+	RefreshExpiresAt time.Time        `json:"refresh_expires_at,omitempty"`
+}
+
+// expiredAt 记录的过期时间，有refresh token时以refresh token为准
+func (r *TokenRecord) expiredAt() time.Time {
+	if r.RefreshExpiresAt.After(r.ExpiresAt) {
+		return r.RefreshExpiresAt
+	}
+	return r.ExpiresAt
+}
+
+// TokenIndex token的二级索引，按用户和客户端查询
+type TokenIndex interface {
+	// Add 新增索引
+	Add(ctx context.Context, record *TokenRecord) error
+	// Remove 删除索引
+	Remove(ctx context.Context, record *TokenRecord) error
+	// ListByUser 分页获取用户未过期的token，按生成时间倒序，返回总数
+	ListByUser(ctx context.Context, userID string, offset, limit int) ([]*TokenRecord, int, error)
+	// ListByClient 分页获取客户端未过期的token，按生成时间倒序，返回总数
+	ListByClient(ctx context.Context, clientID string, offset, limit int) ([]*TokenRecord, int, error)
+}
+
+// tokenID access token的摘要
+func tokenID(access string) string {
+	sum := sha256.Sum256([]byte(access))
+	return hex.EncodeToString(sum[:8])
+}
+
+// newTokenRecord 根据生成的token创建索引记录
+func newTokenRecord(ctx context.Context, ti oauth2.TokenInfo) *TokenRecord {
+	record := &TokenRecord{
+		ID:        tokenID(ti.GetAccess()),
+		UserID:    ti.GetUserID(),
+		ClientID:  ti.GetClientID(),
+		Scope:     ti.GetScope(),
+		GrantType: ginserver.GrantTypeFromContext(ctx),
+		CreateAt:  ti.GetAccessCreateAt(),
+		ExpiresAt: ti.GetAccessCreateAt().Add(ti.GetAccessExpiresIn()),
+	}
+	if record.GrantType == "" && ti.GetRefresh() != "" && ti.GetRefreshCreateAt().Before(ti.GetAccessCreateAt()) {
+		//刷新token时refresh token不变
+		record.GrantType = oauth2.Refreshing
+	}
+	if ti.GetRefresh() != "" && ti.GetRefreshExpiresIn() > 0 {
+		record.RefreshExpiresAt = ti.GetRefreshCreateAt().Add(ti.GetRefreshExpiresIn())
+	}
+	return record
+}
+
+// indexedTokenStore 生成token时同时写入二级索引，删除token时同时删除索引
+type indexedTokenStore struct {
+	oauth2.TokenStore
+	index TokenIndex
+}
+
+// Create 写入token以及索引，索引写入失败不影响token的生成
+func (s *indexedTokenStore) Create(ctx context.Context, info oauth2.TokenInfo) error {
+	if err := s.TokenStore.Create(ctx, info); err != nil {
+		return err
+	}
+	if info.GetAccess() == "" {
+		//授权码不需要索引
+		return nil
+	}
+	if err := s.index.Add(ctx, newTokenRecord(ctx, info)); err != nil {
+		log.Println("token index add error:", err)
+	}
+	return nil
+}
+
+// RemoveByAccess 删除token以及索引
+func (s *indexedTokenStore) RemoveByAccess(ctx context.Context, access string) error {
+	return s.remove(ctx, func() (oauth2.TokenInfo, error) {
+		return s.TokenStore.GetByAccess(ctx, access)
+	}, func() error {
+		return s.TokenStore.RemoveByAccess(ctx, access)
+	})
+}
+
+// RemoveByRefresh 删除token以及索引
+func (s *indexedTokenStore) RemoveByRefresh(ctx context.Context, refresh string) error {
+	return s.remove(ctx, func() (oauth2.TokenInfo, error) {
+		return s.TokenStore.GetByRefresh(ctx, refresh)
+	}, func() error {
+		return s.TokenStore.RemoveByRefresh(ctx, refresh)
+	})
+}
+
+// remove 删除前先查询token，按查询到的用户和客户端删除索引，索引删除失败不影响token的删除
+func (s *indexedTokenStore) remove(ctx context.Context, get func() (oauth2.TokenInfo, error), remove func() error) error {
+	ti, _ := get()
+	if err := remove(); err != nil {
+		return err
+	}
+	if ti != nil && ti.GetAccess() != "" {
+		if err := s.index.Remove(ctx, newTokenRecord(ctx, ti)); err != nil {
+			log.Println("token index remove error:", err)
+		}
+	}
+	return nil
+}
+
+// tokenLister 按用户和客户端查询有效的token
+type tokenLister struct {
+	index      TokenIndex
+	validation tokenValidation
+}
+
+// active token没有被撤销，过期和删除的token已经不在索引中
+func (l *tokenLister) active(ctx context.Context, record *TokenRecord) bool {
+	if l.validation == nil {
+		return true
+	}
+	ti := &models.Token{ClientID: record.ClientID, UserID: record.UserID, AccessCreateAt: record.CreateAt}
+	allowed, err := l.validation(ctx, ti, record.CreateAt)
+	//存储异常时仍然展示
+	return err != nil || allowed
+}
+
+// list 没有撤销检查时直接使用索引的分页，否则从头按批读取索引，先过滤已撤销的token再分页，total为有效token的数量
+func (l *tokenLister) list(ctx context.Context, offset, limit int,
+	listIndex func(offset, limit int) ([]*TokenRecord, int, error)) ([]*TokenRecord, int, error) {
+	if l.validation == nil {
+		return listIndex(offset, limit)
+	}
+	list := make([]*TokenRecord, 0, limit)
+	total := 0
+	for start := 0; ; start += maxTokenPageSize {
+		records, indexTotal, err := listIndex(start, maxTokenPageSize)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, record := range records {
+			if !l.active(ctx, record) {
+				continue
+			}
+			if total >= offset && len(list) < limit {
+				list = append(list, record)
+			}
+			total++
+		}
+		if len(records) < maxTokenPageSize || start+maxTokenPageSize >= indexTotal {
+			return list, total, nil
+		}
+	}
+}
+
+// ListByUser 用户的token
+func (l *tokenLister) ListByUser(ctx context.Context, userID string, offset, limit int) ([]*TokenRecord, int, error) {
+	return l.list(ctx, offset, limit, func(offset, limit int) ([]*TokenRecord, int, error) {
+		return l.index.ListByUser(ctx, userID, offset, limit)
+	})
+}
+
+// ListByClient 客户端的token
+func (l *tokenLister) ListByClient(ctx context.Context, clientID string, offset, limit int) ([]*TokenRecord, int, error) {
+	return l.list(ctx, offset, limit, func(offset, limit int) ([]*TokenRecord, int, error) {
+		return l.index.ListByClient(ctx, clientID, offset, limit)
+	})
+}
+
+// NewMemoryTokenIndex 内存索引，只适合单机部署
+func NewMemoryTokenIndex() TokenIndex {
+	return &memoryTokenIndex{
+		users:   make(map[string]map[string]*TokenRecord),
+		clients: make(map[string]map[string]*TokenRecord),
+	}
+}
+
+type memoryTokenIndex struct {
+	lock    sync.RWMutex
+	users   map[string]map[string]*TokenRecord
+	clients map[string]map[string]*TokenRecord
+}
+
+func addRecord(all map[string]map[string]*TokenRecord, key string, record *TokenRecord) {
+	records, ok := all[key]
+	if !ok {
+		records = make(map[string]*TokenRecord)
+		all[key] = records
+	}
+	records[record.ID] = record
+}
+
+// Add 新增索引
+func (idx *memoryTokenIndex) Add(_ context.Context, record *TokenRecord) error {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	if record.UserID != "" {
+		addRecord(idx.users, record.UserID, record)
+	}
+	addRecord(idx.clients, record.ClientID, record)
+	return nil
+}
+
+// Remove 删除索引
+func (idx *memoryTokenIndex) Remove(_ context.Context, record *TokenRecord) error {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	delete(idx.users[record.UserID], record.ID)
+	delete(idx.clients[record.ClientID], record.ID)
+	return nil
+}
+
+func (idx *memoryTokenIndex) list(all map[string]map[string]*TokenRecord, key string, offset, limit int) ([]*TokenRecord, int, error) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	now := time.Now()
+	list := make([]*TokenRecord, 0)
+	for id, record := range all[key] {
+		if !record.expiredAt().After(now) {
+			delete(all[key], id)
+			continue
+		}
+		list = append(list, record)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreateAt.After(list[j].CreateAt)
+	})
+	total := len(list)
+	if offset >= total {
+		return []*TokenRecord{}, total, nil
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return list[offset:end], total, nil
+}
+
+// ListByUser 用户的token
+func (idx *memoryTokenIndex) ListByUser(_ context.Context, userID string, offset, limit int) ([]*TokenRecord, int, error) {
+	return idx.list(idx.users, userID, offset, limit)
+}
+
+// ListByClient 客户端的token
+func (idx *memoryTokenIndex) ListByClient(_ context.Context, clientID string, offset, limit int) ([]*TokenRecord, int, error) {
+	return idx.list(idx.clients, clientID, offset, limit)
+}
+
+// pageParam 分页参数 offset、limit
+func pageParam(c *gin.Context) (int, int) {
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = defaultTokenPageSize
+	}
+	if limit > maxTokenPageSize {
+		limit = maxTokenPageSize
+	}
+	return offset, limit
+}
+
+// startTokenAdminRoute 管理员查询用户或者客户端当前有效的token
+func startTokenAdminRoute(admin *gin.RouterGroup, lister *tokenLister) {
+	writeList := func(c *gin.Context, list []*TokenRecord, total int, err error) {
+		if err != nil {
+			_ = httputil.WriteCommResponse(c.Writer, &httputil.CommResponse{
+				Code:    http.StatusInternalServerError,
+				Message: err.Error(),
+			})
+			return
+		}
+		_ = httputil.WriteCommResponse(c.Writer, &httputil.CommResponse{
+			Data: map[string]interface{}{
+				"total": total,
+				"list":  list,
+			},
+		})
+	}
+
+	admin.GET("/users/:user_id/tokens", func(c *gin.Context) {
+		offset, limit := pageParam(c)
+		list, total, err := lister.ListByUser(c.Request.Context(), c.Param("user_id"), offset, limit)
+		writeList(c, list, total, err)
+	})
+	admin.GET("/clients/:client_id/tokens", func(c *gin.Context) {
+		offset, limit := pageParam(c)
+		list, total, err := lister.ListByClient(c.Request.Context(), c.Param("client_id"), offset, limit)
+		writeList(c, list, total, err)
+	})
+}
@@ -0,0 +1,304 @@
+package oauth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+const defaultTokenIndexTableName = "oauth2_token_index"
+
+func marshalTokenRecord(record *TokenRecord) ([]byte, error) {
+	return json.Marshal(record)
+}
+
+func unmarshalTokenRecord(data []byte) (*TokenRecord, error) {
+	record := &TokenRecord{}
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// NewRedisTokenIndex 索引存储到redis中，用户和客户端各有按生成时间和按过期时间排序的两个有序集合，
+// 写入和查询前按过期时间删除已经过期的记录
+func NewRedisTokenIndex(cli redis.UniversalClient, keyNamespace ...string) TokenIndex {
+	idx := &redisTokenIndex{
+		cli: cli,
+		ns:  "{default-oauth}",
+	}
+	if len(keyNamespace) > 0 && keyNamespace[0] != "" {
+		idx.ns = keyNamespace[0]
+	}
+	return idx
+}
+
+type redisTokenIndex struct {
+	cli redis.UniversalClient
+	ns  string
+}
+
+func (idx *redisTokenIndex) recordKey(id string) string {
+	return fmt.Sprintf("%sidx:token:%s", idx.ns, id)
+}
+
+func (idx *redisTokenIndex) userKey(userID string) string {
+	return fmt.Sprintf("%sidx:user:%s", idx.ns, userID)
+}
+
+func (idx *redisTokenIndex) clientKey(clientID string) string {
+	return fmt.Sprintf("%sidx:client:%s", idx.ns, clientID)
+}
+
+// expireKey 按过期时间排序的集合，用于删除过期的记录
+func (idx *redisTokenIndex) expireKey(key string) string {
+	return key + ":exp"
+}
+
+// trim 删除集合中已经过期的记录
+func (idx *redisTokenIndex) trim(ctx context.Context, key string) error {
+	max := strconv.FormatInt(time.Now().UnixNano(), 10)
+	ids, err := idx.cli.ZRangeByScore(ctx, idx.expireKey(key), &redis.ZRangeBy{Min: "-inf", Max: max}).Result()
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	members := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		members = append(members, id)
+	}
+	if err = idx.cli.ZRem(ctx, key, members...).Err(); err != nil {
+		return err
+	}
+	return idx.cli.ZRemRangeByScore(ctx, idx.expireKey(key), "-inf", max).Err()
+}
+
+// Add 记录本身随token过期，集合的过期时间随最后一个token延长
+func (idx *redisTokenIndex) Add(ctx context.Context, record *TokenRecord) error {
+	data, err := marshalTokenRecord(record)
+	if err != nil {
+		return err
+	}
+	exp := time.Until(record.expiredAt())
+	if exp <= 0 {
+		return nil
+	}
+	if err = idx.cli.Set(ctx, idx.recordKey(record.ID), data, exp).Err(); err != nil {
+		return err
+	}
+	setKeys := []string{idx.clientKey(record.ClientID)}
+	if record.UserID != "" {
+		setKeys = append(setKeys, idx.userKey(record.UserID))
+	}
+	member := &redis.Z{Score: float64(record.CreateAt.UnixNano()), Member: record.ID}
+	expireMember := &redis.Z{Score: float64(record.expiredAt().UnixNano()), Member: record.ID}
+	for _, key := range setKeys {
+		if err = idx.trim(ctx, key); err != nil {
+			return err
+		}
+		if err = idx.cli.ZAdd(ctx, key, member).Err(); err != nil {
+			return err
+		}
+		if err = idx.cli.ZAdd(ctx, idx.expireKey(key), expireMember).Err(); err != nil {
+			return err
+		}
+		for _, one := range []string{key, idx.expireKey(key)} {
+			ttl, err := idx.cli.TTL(ctx, one).Result()
+			if err != nil {
+				return err
+			}
+			if ttl < exp {
+				if err = idx.cli.Expire(ctx, one, exp).Err(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Remove 删除索引
+func (idx *redisTokenIndex) Remove(ctx context.Context, record *TokenRecord) error {
+	if err := idx.cli.Del(ctx, idx.recordKey(record.ID)).Err(); err != nil {
+		return err
+	}
+	setKeys := []string{idx.clientKey(record.ClientID)}
+	if record.UserID != "" {
+		setKeys = append(setKeys, idx.userKey(record.UserID))
+	}
+	for _, key := range setKeys {
+		if err := idx.cli.ZRem(ctx, key, record.ID).Err(); err != nil {
+			return err
+		}
+		if err := idx.cli.ZRem(ctx, idx.expireKey(key), record.ID).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// list 先删除过期的记录再计算总数，记录已经不存在时从集合中删除
+func (idx *redisTokenIndex) list(ctx context.Context, key string, offset, limit int) ([]*TokenRecord, int, error) {
+	if err := idx.trim(ctx, key); err != nil {
+		return nil, 0, err
+	}
+	total, err := idx.cli.ZCard(ctx, key).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	ids, err := idx.cli.ZRevRange(ctx, key, int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	list := make([]*TokenRecord, 0, len(ids))
+	for _, id := range ids {
+		data, err := idx.cli.Get(ctx, idx.recordKey(id)).Bytes()
+		if err == redis.Nil {
+			_ = idx.cli.ZRem(ctx, key, id).Err()
+			_ = idx.cli.ZRem(ctx, idx.expireKey(key), id).Err()
+			total--
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		record, err := unmarshalTokenRecord(data)
+		if err != nil {
+			log.Println("token index record error:", id, err)
+			total--
+			continue
+		}
+		list = append(list, record)
+	}
+	return list, int(total), nil
+}
+
+// ListByUser 用户的token
+func (idx *redisTokenIndex) ListByUser(ctx context.Context, userID string, offset, limit int) ([]*TokenRecord, int, error) {
+	return idx.list(ctx, idx.userKey(userID), offset, limit)
+}
+
+// ListByClient 客户端的token
+func (idx *redisTokenIndex) ListByClient(ctx context.Context, clientID string, offset, limit int) ([]*TokenRecord, int, error) {
+	return idx.list(ctx, idx.clientKey(clientID), offset, limit)
+}
+
+// NewMysqlTokenIndex 索引存储到mysql中，tableName为空时默认为oauth2_token_index
+func NewMysqlTokenIndex(db *sql.DB, tableName string) (TokenIndex, error) {
+	return newMysqlTokenIndex(db, tableName, 30*time.Minute)
+}
+
+// tokenIndexMysqlMigrations 表结构的版本
+var tokenIndexMysqlMigrations = []schemaMigration{
+	{version: 1, description: "create token index table", statements: func(tableName string) []string {
+		return []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` ("+
+			"`id` VARCHAR(64) NOT NULL,"+
+			"`user_id` VARCHAR(255) NOT NULL DEFAULT '',"+
+			"`client_id` VARCHAR(255) NOT NULL,"+
+			"`data` TEXT NOT NULL,"+
+			"`create_at` BIGINT NOT NULL,"+
+			"`expired_at` BIGINT NOT NULL,"+
+			"PRIMARY KEY (`id`),"+
+			"KEY `idx_user_id` (`user_id`, `create_at`),"+
+			"KEY `idx_client_id` (`client_id`, `create_at`),"+
+			"KEY `idx_expired_at` (`expired_at`)"+
+			") DEFAULT CHARSET=utf8mb4", tableName)}
+	}},
+}
+
+func newMysqlTokenIndex(db *sql.DB, tableName string, gcInterval time.Duration) (TokenIndex, error) {
+	if tableName == "" {
+		tableName = defaultTokenIndexTableName
+	}
+	idx := &mysqlTokenIndex{
+		db:        db,
+		tableName: tableName,
+	}
+	if err := migrateMysqlTable(db, tableName, tokenIndexMysqlMigrations); err != nil {
+		return nil, err
+	}
+	go idx.gc(gcInterval)
+	return idx, nil
+}
+
+type mysqlTokenIndex struct {
+	db        *sql.DB
+	tableName string
+}
+
+func (idx *mysqlTokenIndex) gc(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		_, err := idx.db.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE `expired_at` <= ?", idx.tableName), time.Now().Unix())
+		if err != nil {
+			log.Println("token index gc error:", err)
+		}
+	}
+}
+
+// Add 新增索引
+func (idx *mysqlTokenIndex) Add(ctx context.Context, record *TokenRecord) error {
+	data, err := marshalTokenRecord(record)
+	if err != nil {
+		return err
+	}
+	_, err = idx.db.ExecContext(ctx, fmt.Sprintf("REPLACE INTO `%s` (`id`, `user_id`, `client_id`, `data`, `create_at`, `expired_at`) "+
+		"VALUES (?, ?, ?, ?, ?, ?)", idx.tableName), record.ID, record.UserID, record.ClientID, string(data),
+		record.CreateAt.UnixNano(), record.expiredAt().Unix())
+	return err
+}
+
+// Remove 删除索引
+func (idx *mysqlTokenIndex) Remove(ctx context.Context, record *TokenRecord) error {
+	_, err := idx.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM `%s` WHERE `id` = ?", idx.tableName), record.ID)
+	return err
+}
+
+func (idx *mysqlTokenIndex) list(ctx context.Context, column, value string, offset, limit int) ([]*TokenRecord, int, error) {
+	now := time.Now().Unix()
+	var total int
+	err := idx.db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM `%s` WHERE `%s` = ? AND `expired_at` > ?",
+		idx.tableName, column), value, now).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, err := idx.db.QueryContext(ctx, fmt.Sprintf("SELECT `data` FROM `%s` WHERE `%s` = ? AND `expired_at` > ? "+
+		"ORDER BY `create_at` DESC LIMIT ?, ?", idx.tableName, column), value, now, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+	list := make([]*TokenRecord, 0, limit)
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&data); err != nil {
+			return nil, 0, err
+		}
+		record, err := unmarshalTokenRecord([]byte(data))
+		if err != nil {
+			log.Println("token index record error:", err)
+			total--
+			continue
+		}
+		list = append(list, record)
+	}
+	return list, total, rows.Err()
+}
+
+// ListByUser 用户的token
+func (idx *mysqlTokenIndex) ListByUser(ctx context.Context, userID string, offset, limit int) ([]*TokenRecord, int, error) {
+	return idx.list(ctx, "user_id", userID, offset, limit)
+}
+
+// ListByClient 客户端的token
+func (idx *mysqlTokenIndex) ListByClient(ctx context.Context, clientID string, offset, limit int) ([]*TokenRecord, int, error) {
+	return idx.list(ctx, "client_id", clientID, offset, limit)
+}
@@ -0,0 +1,154 @@
+package oauth
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/models"
+	redis "github.com/go-redis/redis/v8"
+	"github.com/tianlin0/go-plat-oauth/oauth/ginserver"
+)
+
+func TestTokenIndex(t *testing.T) {
+	tokenStore, err := newMemoryTokenStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := NewMemoryTokenIndex()
+	store := &indexedTokenStore{TokenStore: tokenStore, index: index}
+	lister := &tokenLister{index: index}
+
+	ctx := ginserver.WithGrantType(context.Background(), oauth2.PasswordCredentials)
+	now := time.Now()
+	for _, access := range []string{"access1", "access2"} {
+		err = store.Create(ctx, &models.Token{
+			ClientID:        "client1",
+			UserID:          "user1",
+			Scope:           "read",
+			Access:          access,
+			AccessCreateAt:  now,
+			AccessExpiresIn: time.Hour,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(time.Second)
+	}
+
+	list, total, err := lister.ListByUser(context.Background(), "user1", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(list) != 2 || list[0].ID != tokenID("access2") || list[0].GrantType != oauth2.PasswordCredentials {
+		t.Fatalf("unexpected list: %d %+v", total, list)
+	}
+
+	if err = store.RemoveByAccess(context.Background(), "access2"); err != nil {
+		t.Fatal(err)
+	}
+	list, total, err = lister.ListByClient(context.Background(), "client1", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(list) != 1 || list[0].ID != tokenID("access1") {
+		t.Fatalf("unexpected list after remove: %d %+v", total, list)
+	}
+}
+
+func TestTokenListerFilterBeforePaging(t *testing.T) {
+	ctx := context.Background()
+	index := NewMemoryTokenIndex()
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		err := index.Add(ctx, &TokenRecord{
+			ID:        strconv.Itoa(i),
+			UserID:    "user1",
+			ClientID:  "client" + strconv.Itoa(i%2),
+			CreateAt:  now.Add(time.Duration(i) * time.Second),
+			ExpiresAt: now.Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	//client1的token已被撤销，按生成时间倒序有效的是 4 2 0
+	lister := &tokenLister{index: index, validation: func(_ context.Context, ti oauth2.TokenInfo, _ time.Time) (bool, error) {
+		return ti.GetClientID() != "client1", nil
+	}}
+	for offset, id := range []string{"4", "2", "0"} {
+		list, total, err := lister.ListByUser(ctx, "user1", offset, 1)
+		if err != nil || total != 3 || len(list) != 1 || list[0].ID != id {
+			t.Fatalf("unexpected page %d: %d %+v %v", offset, total, list, err)
+		}
+	}
+	if list, total, err := lister.ListByUser(ctx, "user1", 3, 1); err != nil || total != 3 || len(list) != 0 {
+		t.Fatalf("unexpected last page: %d %+v %v", total, list, err)
+	}
+}
+
+func TestRedisTokenIndex(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	ctx := context.Background()
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	index := NewRedisTokenIndex(cli, defaultKeyNamespace).(*redisTokenIndex)
+	now := time.Now()
+	err = index.Add(ctx, newTokenRecord(ctx, &models.Token{
+		ClientID:        "client1",
+		UserID:          "user1",
+		Access:          "short-access",
+		AccessCreateAt:  now,
+		AccessExpiresIn: 50 * time.Millisecond,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = index.Add(ctx, newTokenRecord(ctx, &models.Token{
+		ClientID:         "client1",
+		UserID:           "user1",
+		Access:           "long-access",
+		AccessCreateAt:   now,
+		AccessExpiresIn:  time.Hour,
+		Refresh:          "long-refresh",
+		RefreshCreateAt:  now,
+		RefreshExpiresIn: 2 * time.Hour,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range mr.Keys() {
+		if !mr.Exists(key) || strings.HasSuffix(key, ":exp") {
+			continue
+		}
+		if value, err := mr.Get(key); err == nil && (strings.Contains(value, "long-access") || strings.Contains(value, "long-refresh")) {
+			t.Fatalf("token stored in index key %s: %s", key, value)
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	list, total, err := index.ListByUser(ctx, "user1", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || len(list) != 1 || list[0].ID != tokenID("long-access") {
+		t.Fatalf("unexpected list: %d %+v", total, list)
+	}
+	//过期的记录按分数从集合中删除，不依赖记录本身是否过期
+	if _, total, err = index.ListByClient(ctx, "client1", 0, 10); err != nil || total != 1 {
+		t.Fatalf("unexpected client total: %d %v", total, err)
+	}
+	for _, key := range []string{index.userKey("user1"), index.expireKey(index.clientKey("client1"))} {
+		if n, err := cli.ZCard(ctx, key).Result(); err != nil || n != 1 {
+			t.Fatalf("expired member kept in %s: %d %v", key, n, err)
+		}
+	}
+}
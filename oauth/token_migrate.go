@@ -0,0 +1,250 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+)
+
+// TokenScanner 能够分批遍历所有token的存储，用于在不同的存储之间迁移，
+// 内存和文件存储、RedisTokenStore、MysqlTokenStore、PostgresTokenStore都已实现
+type TokenScanner interface {
+	// ScanTokens 从cursor开始返回一批token，cursor为空时从头开始，返回的cursor为空表示已经遍历完
+	ScanTokens(ctx context.Context, cursor string, limit int) ([]oauth2.TokenInfo, string, error)
+}
+
+// MigrateOption 迁移的配置
+type MigrateOption struct {
+	BatchSize  int    //每批的数量，默认500
+	DryRun     bool   //只统计数量，不写入
+	Checkpoint string //断点文件，每批写入以后保存进度，中断以后重新执行时从断点继续
+}
+
+// MigrateResult 迁移的结果
+type MigrateResult struct {
+	Scanned  int    `json:"scanned"`  //遍历的token数量
+	Migrated int    `json:"migrated"` //写入的token数量
+	Expired  int    `json:"expired"`  //已经过期而跳过的数量
+	Cursor   string `json:"cursor"`   //下一批的cursor
+	Done     bool   `json:"done"`     //是否已经完成
+}
+
+// MigrateTokens 把未过期的token写入另一个存储，过期时间与原来的相同，
+// 迁移期间服务可以使用NewDualWriteTokenStore同时写入两个存储。
+// Done只表示遍历到的token都已写入，迁移期间双写时另一个存储写入失败的token只记录日志，
+// 出现"dual write token store create error"时，修复以后使用新的断点文件重新执行一次
+// 即可补齐，已经存在的token会被重新写入
+func MigrateTokens(ctx context.Context, from TokenScanner, to oauth2.TokenStore, opt *MigrateOption) (*MigrateResult, error) {
+	if opt == nil {
+		opt = &MigrateOption{}
+	}
+	batchSize := opt.BatchSize
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	result, err := loadMigrateCheckpoint(opt.Checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	if result.Done {
+		log.Println("token migrate: checkpoint already done", opt.Checkpoint)
+		return result, nil
+	}
+
+	for {
+		tokens, next, err := from.ScanTokens(ctx, result.Cursor, batchSize)
+		if err != nil {
+			return result, err
+		}
+		now := time.Now()
+		for _, ti := range tokens {
+			result.Scanned++
+			if tokenExpired(ti, now) {
+				result.Expired++
+				continue
+			}
+			if !opt.DryRun {
+				if err = to.Create(ctx, ti); err != nil {
+					return result, err
+				}
+			}
+			result.Migrated++
+		}
+		result.Cursor = next
+		result.Done = next == ""
+		if !opt.DryRun {
+			if err = saveMigrateCheckpoint(opt.Checkpoint, result); err != nil {
+				return result, err
+			}
+		}
+		if result.Done {
+			return result, nil
+		}
+	}
+}
+
+// tokenExpired 授权码按授权码的过期时间，有refresh token时按refresh token的过期时间，过期时间为0表示不过期
+func tokenExpired(ti oauth2.TokenInfo, now time.Time) bool {
+	if ti.GetCode() != "" {
+		return ti.GetCodeExpiresIn() > 0 && now.After(ti.GetCodeCreateAt().Add(ti.GetCodeExpiresIn()))
+	}
+	if ti.GetRefresh() != "" {
+		return ti.GetRefreshExpiresIn() > 0 && now.After(ti.GetRefreshCreateAt().Add(ti.GetRefreshExpiresIn()))
+	}
+	return ti.GetAccessExpiresIn() > 0 && now.After(ti.GetAccessCreateAt().Add(ti.GetAccessExpiresIn()))
+}
+
+func loadMigrateCheckpoint(path string) (*MigrateResult, error) {
+	result := &MigrateResult{}
+	if path == "" {
+		return result, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// saveMigrateCheckpoint 先写临时文件再重命名，避免中断时断点文件不完整
+func saveMigrateCheckpoint(path string, result *MigrateResult) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// dualWriteTokenPurger 批量删除时同时删除两个存储中的token，另一个存储删除失败时只记录日志，返回主存储删除的数量
+type dualWriteTokenPurger struct {
+	primary   TokenPurger
+	secondary TokenPurger
+}
+
+// newDualWriteTokenPurger secondary没有实现TokenPurger时返回primary，
+// 另一个存储中的token仍然会被撤销记录拦截，只是不会被删除
+func newDualWriteTokenPurger(primary TokenPurger, secondary oauth2.TokenStore, secondaryPurger TokenPurger) TokenPurger {
+	if secondaryPurger == nil {
+		secondaryPurger, _ = secondary.(TokenPurger)
+	}
+	if secondaryPurger == nil {
+		log.Println("dual write token store: secondary store does not support purge, set SecondaryTokenPurger")
+		return primary
+	}
+	if primary == nil {
+		return nil
+	}
+	return &dualWriteTokenPurger{primary: primary, secondary: secondaryPurger}
+}
+
+// PurgeTokens 删除两个存储中满足条件的token
+func (p *dualWriteTokenPurger) PurgeTokens(ctx context.Context, match func(ti oauth2.TokenInfo) bool) (int, error) {
+	count, err := p.primary.PurgeTokens(ctx, match)
+	if err != nil {
+		return count, err
+	}
+	if _, err = p.secondary.PurgeTokens(ctx, match); err != nil {
+		log.Println("dual write token store purge error:", err)
+	}
+	return count, nil
+}
+
+// dualWriteTokenStore 同时写入两个存储，另一个存储写入失败时只记录日志
+type dualWriteTokenStore struct {
+	primary   oauth2.TokenStore
+	secondary oauth2.TokenStore
+}
+
+// NewDualWriteTokenStore 存储迁移期间使用，写入和删除同时作用于两个存储，主存储中不存在时从另一个存储读取。
+// 先以旧存储为主存储并执行MigrateTokens，完成以后切换为以新存储为主存储，旧token全部过期以后只使用新存储
+func NewDualWriteTokenStore(primary, secondary oauth2.TokenStore) oauth2.TokenStore {
+	return &dualWriteTokenStore{primary: primary, secondary: secondary}
+}
+
+// Create create and store the new token information
+func (s *dualWriteTokenStore) Create(ctx context.Context, info oauth2.TokenInfo) error {
+	if err := s.primary.Create(ctx, info); err != nil {
+		return err
+	}
+	if err := s.secondary.Create(ctx, info); err != nil {
+		log.Println("dual write token store create error:", err)
+	}
+	return nil
+}
+
+func (s *dualWriteTokenStore) remove(remove func(ts oauth2.TokenStore) error) error {
+	if err := remove(s.primary); err != nil {
+		return err
+	}
+	if err := remove(s.secondary); err != nil {
+		log.Println("dual write token store remove error:", err)
+	}
+	return nil
+}
+
+// RemoveByCode delete the authorization code
+func (s *dualWriteTokenStore) RemoveByCode(ctx context.Context, code string) error {
+	return s.remove(func(ts oauth2.TokenStore) error {
+		return ts.RemoveByCode(ctx, code)
+	})
+}
+
+// RemoveByAccess use the access token to delete the token information
+func (s *dualWriteTokenStore) RemoveByAccess(ctx context.Context, access string) error {
+	return s.remove(func(ts oauth2.TokenStore) error {
+		return ts.RemoveByAccess(ctx, access)
+	})
+}
+
+// RemoveByRefresh use the refresh token to delete the token information
+func (s *dualWriteTokenStore) RemoveByRefresh(ctx context.Context, refresh string) error {
+	return s.remove(func(ts oauth2.TokenStore) error {
+		return ts.RemoveByRefresh(ctx, refresh)
+	})
+}
+
+func (s *dualWriteTokenStore) get(get func(ts oauth2.TokenStore) (oauth2.TokenInfo, error)) (oauth2.TokenInfo, error) {
+	ti, err := get(s.primary)
+	if err != nil || ti != nil {
+		return ti, err
+	}
+	return get(s.secondary)
+}
+
+// GetByCode use the authorization code for token information data
+func (s *dualWriteTokenStore) GetByCode(ctx context.Context, code string) (oauth2.TokenInfo, error) {
+	return s.get(func(ts oauth2.TokenStore) (oauth2.TokenInfo, error) {
+		return ts.GetByCode(ctx, code)
+	})
+}
+
+// GetByAccess use the access token for token information data
+func (s *dualWriteTokenStore) GetByAccess(ctx context.Context, access string) (oauth2.TokenInfo, error) {
+	return s.get(func(ts oauth2.TokenStore) (oauth2.TokenInfo, error) {
+		return ts.GetByAccess(ctx, access)
+	})
+}
+
+// GetByRefresh use the refresh token for token information data
+func (s *dualWriteTokenStore) GetByRefresh(ctx context.Context, refresh string) (oauth2.TokenInfo, error) {
+	return s.get(func(ts oauth2.TokenStore) (oauth2.TokenInfo, error) {
+		return ts.GetByRefresh(ctx, refresh)
+	})
+}
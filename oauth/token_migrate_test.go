@@ -0,0 +1,118 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/models"
+	redis "github.com/go-redis/redis/v8"
+)
+
+func TestMigrateTokens(t *testing.T) {
+	ctx := context.Background()
+	from, err := newMemoryTokenStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		err = from.Create(ctx, &models.Token{
+			ClientID:         "client1",
+			Access:           fmt.Sprintf("access%d", i),
+			AccessCreateAt:   time.Now(),
+			AccessExpiresIn:  time.Hour,
+			Refresh:          fmt.Sprintf("refresh%d", i),
+			RefreshCreateAt:  time.Now(),
+			RefreshExpiresIn: 2 * time.Hour,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	to := NewRedisTokenStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "")
+
+	checkpoint := filepath.Join(t.TempDir(), "migrate.json")
+	result, err := MigrateTokens(ctx, from, to, &MigrateOption{BatchSize: 2, DryRun: true, Checkpoint: checkpoint})
+	if err != nil || result.Migrated != 5 {
+		t.Fatalf("unexpected dry run: %+v %v", result, err)
+	}
+	if ti, _ := to.GetByAccess(ctx, "access0"); ti != nil {
+		t.Fatal("dry run wrote token")
+	}
+
+	result, err = MigrateTokens(ctx, from, to, &MigrateOption{BatchSize: 2, Checkpoint: checkpoint})
+	if err != nil || result.Migrated != 5 || !result.Done {
+		t.Fatalf("unexpected result: %+v %v", result, err)
+	}
+	ti, err := to.GetByRefresh(ctx, "refresh3")
+	if err != nil || ti == nil || ti.GetAccess() != "access3" {
+		t.Fatalf("token not migrated: %v %v", ti, err)
+	}
+	//已经完成的断点不再重复迁移
+	result, err = MigrateTokens(ctx, from, to, &MigrateOption{Checkpoint: checkpoint})
+	if err != nil || result.Migrated != 5 {
+		t.Fatalf("unexpected result: %+v %v", result, err)
+	}
+
+	//从redis遍历
+	tokens, next, err := to.ScanTokens(ctx, "", 100)
+	if err != nil || len(tokens) != 5 || next != "" {
+		t.Fatalf("unexpected scan: %d %q %v", len(tokens), next, err)
+	}
+
+	dual := NewDualWriteTokenStore(to, from)
+	if ti, _ = dual.GetByAccess(ctx, "access4"); ti == nil {
+		t.Fatal("token not found")
+	}
+	if err = dual.RemoveByAccess(ctx, "access4"); err != nil {
+		t.Fatal(err)
+	}
+	if ti, _ = from.GetByAccess(ctx, "access4"); ti != nil {
+		t.Fatal("token not removed from secondary store")
+	}
+}
+
+func TestDualWriteTokenPurger(t *testing.T) {
+	ctx := context.Background()
+	primary := mustMemoryTokenStore(t)
+	secondary := mustMemoryTokenStore(t)
+	dual := NewDualWriteTokenStore(primary, secondary)
+	err := dual.Create(ctx, &models.Token{
+		ClientID:        "client1",
+		UserID:          "user1",
+		Access:          "access1",
+		AccessCreateAt:  time.Now(),
+		AccessExpiresIn: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	purger := newDualWriteTokenPurger(primary, secondary, nil)
+	n, err := purger.PurgeTokens(ctx, func(ti oauth2.TokenInfo) bool {
+		return ti.GetUserID() == "user1"
+	})
+	if err != nil || n != 1 {
+		t.Fatalf("unexpected purge: %d %v", n, err)
+	}
+	for _, ts := range []oauth2.TokenStore{primary, secondary} {
+		if ti, _ := ts.GetByAccess(ctx, "access1"); ti != nil {
+			t.Fatalf("token not purged: %v", ti)
+		}
+	}
+
+	//另一个存储不支持批量删除时只删除主存储
+	if p := newDualWriteTokenPurger(primary, NewDualWriteTokenStore(primary, secondary), nil); p != TokenPurger(primary) {
+		t.Fatalf("unexpected purger: %T", p)
+	}
+}
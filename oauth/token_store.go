@@ -0,0 +1,468 @@
+package oauth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mysql "github.com/go-oauth2/mysql/v4"
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/models"
+	redis "github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/tidwall/buntdb"
+)
+
+// TokenPurger 能够按条件批量删除token的存储
+type TokenPurger interface {
+	// PurgeTokens 删除所有满足条件的token，返回删除的数量
+	PurgeTokens(ctx context.Context, match func(ti oauth2.TokenInfo) bool) (int, error)
+}
+
+// parseStoredToken 解析存储中的token数据，不是token时返回nil
+func parseStoredToken(data string) oauth2.TokenInfo {
+	if !strings.HasPrefix(data, "{") {
+		return nil
+	}
+	var tm models.Token
+	if err := json.Unmarshal([]byte(data), &tm); err != nil || tm.ClientID == "" {
+		return nil
+	}
+	return &tm
+}
+
+// copyTokenInfo 复制token，调用方可能会修改返回的token
+func copyTokenInfo(ti oauth2.TokenInfo) oauth2.TokenInfo {
+	if tm, ok := ti.(*models.Token); ok {
+		c := *tm
+		return &c
+	}
+	c := ti.New()
+	c.SetClientID(ti.GetClientID())
+	c.SetUserID(ti.GetUserID())
+	c.SetRedirectURI(ti.GetRedirectURI())
+	c.SetScope(ti.GetScope())
+	c.SetCode(ti.GetCode())
+	c.SetCodeCreateAt(ti.GetCodeCreateAt())
+	c.SetCodeExpiresIn(ti.GetCodeExpiresIn())
+	c.SetCodeChallenge(ti.GetCodeChallenge())
+	c.SetCodeChallengeMethod(ti.GetCodeChallengeMethod())
+	c.SetAccess(ti.GetAccess())
+	c.SetAccessCreateAt(ti.GetAccessCreateAt())
+	c.SetAccessExpiresIn(ti.GetAccessExpiresIn())
+	c.SetRefresh(ti.GetRefresh())
+	c.SetRefreshCreateAt(ti.GetRefreshCreateAt())
+	c.SetRefreshExpiresIn(ti.GetRefreshExpiresIn())
+	return c
+}
+
+// newMemoryTokenStore 基于buntdb的内存存储，与store.NewMemoryTokenStore相同，但支持批量删除
+func newMemoryTokenStore() (*buntTokenStore, error) {
+	db, err := buntdb.Open(":memory:")
+	if err != nil {
+		return nil, err
+	}
+	return &buntTokenStore{db: db}, nil
+}
+
+// buntTokenStore token storage based on buntdb
+type buntTokenStore struct {
+	db *buntdb.DB
+}
+
+// Create create and store the new token information
+func (ts *buntTokenStore) Create(_ context.Context, info oauth2.TokenInfo) error {
+	ct := time.Now()
+	jv, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	return ts.db.Update(func(tx *buntdb.Tx) error {
+		if code := info.GetCode(); code != "" {
+			_, _, err := tx.Set(code, string(jv), &buntdb.SetOptions{Expires: true, TTL: info.GetCodeExpiresIn()})
+			return err
+		}
+
+		basicID := uuid.Must(uuid.NewRandom()).String()
+		aexp := info.GetAccessExpiresIn()
+		rexp := aexp
+		expires := true
+		if refresh := info.GetRefresh(); refresh != "" {
+			rexp = info.GetRefreshCreateAt().Add(info.GetRefreshExpiresIn()).Sub(ct)
+			if aexp.Seconds() > rexp.Seconds() {
+				aexp = rexp
+			}
+			expires = info.GetRefreshExpiresIn() != 0
+			_, _, err := tx.Set(refresh, basicID, &buntdb.SetOptions{Expires: expires, TTL: rexp})
+			if err != nil {
+				return err
+			}
+		}
+
+		_, _, err := tx.Set(basicID, string(jv), &buntdb.SetOptions{Expires: expires, TTL: rexp})
+		if err != nil {
+			return err
+		}
+		_, _, err = tx.Set(info.GetAccess(), basicID, &buntdb.SetOptions{Expires: expires, TTL: aexp})
+		return err
+	})
+}
+
+func (ts *buntTokenStore) remove(key string) error {
+	err := ts.db.Update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete(key)
+		return err
+	})
+	if err == buntdb.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// RemoveByCode use the authorization code to delete the token information
+func (ts *buntTokenStore) RemoveByCode(_ context.Context, code string) error {
+	return ts.remove(code)
+}
+
+// RemoveByAccess use the access token to delete the token information
+func (ts *buntTokenStore) RemoveByAccess(_ context.Context, access string) error {
+	return ts.remove(access)
+}
+
+// RemoveByRefresh use the refresh token to delete the token information
+func (ts *buntTokenStore) RemoveByRefresh(_ context.Context, refresh string) error {
+	return ts.remove(refresh)
+}
+
+func (ts *buntTokenStore) get(key string) (string, error) {
+	var value string
+	err := ts.db.View(func(tx *buntdb.Tx) error {
+		v, err := tx.Get(key)
+		value = v
+		return err
+	})
+	if err == buntdb.ErrNotFound {
+		return "", nil
+	}
+	return value, err
+}
+
+func (ts *buntTokenStore) getData(key string) (oauth2.TokenInfo, error) {
+	jv, err := ts.get(key)
+	if err != nil || jv == "" {
+		return nil, err
+	}
+	var tm models.Token
+	if err = json.Unmarshal([]byte(jv), &tm); err != nil {
+		return nil, err
+	}
+	return &tm, nil
+}
+
+// GetByCode use the authorization code for token information data
+func (ts *buntTokenStore) GetByCode(_ context.Context, code string) (oauth2.TokenInfo, error) {
+	return ts.getData(code)
+}
+
+// GetByAccess use the access token for token information data
+func (ts *buntTokenStore) GetByAccess(_ context.Context, access string) (oauth2.TokenInfo, error) {
+	basicID, err := ts.get(access)
+	if err != nil || basicID == "" {
+		return nil, err
+	}
+	return ts.getData(basicID)
+}
+
+// GetByRefresh use the refresh token for token information data
+func (ts *buntTokenStore) GetByRefresh(_ context.Context, refresh string) (oauth2.TokenInfo, error) {
+	basicID, err := ts.get(refresh)
+	if err != nil || basicID == "" {
+		return nil, err
+	}
+	return ts.getData(basicID)
+}
+
+// PurgeTokens 遍历所有token，删除满足条件的
+func (ts *buntTokenStore) PurgeTokens(_ context.Context, match func(ti oauth2.TokenInfo) bool) (int, error) {
+	keys := make([]string, 0)
+	count := 0
+	err := ts.db.View(func(tx *buntdb.Tx) error {
+		return tx.Ascend("", func(key, value string) bool {
+			ti := parseStoredToken(value)
+			if ti == nil || !match(ti) {
+				return true
+			}
+			count++
+			keys = append(keys, key, ti.GetAccess(), ti.GetRefresh())
+			return true
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err = ts.remove(key); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// ScanTokens 按key的顺序遍历，cursor为上一批最后的key
+func (ts *buntTokenStore) ScanTokens(_ context.Context, cursor string, limit int) ([]oauth2.TokenInfo, string, error) {
+	tokens := make([]oauth2.TokenInfo, 0, limit)
+	next := ""
+	err := ts.db.View(func(tx *buntdb.Tx) error {
+		return tx.AscendGreaterOrEqual("", cursor, func(key, value string) bool {
+			if key == cursor {
+				return true
+			}
+			if ti := parseStoredToken(value); ti != nil {
+				tokens = append(tokens, ti)
+			}
+			if len(tokens) < limit {
+				return true
+			}
+			next = key
+			return false
+		})
+	})
+	return tokens, next, err
+}
+
+// redisTokenPurger 遍历redis中的token
+type redisTokenPurger struct {
+	cli redis.UniversalClient
+	ns  string
+}
+
+// PurgeTokens 遍历命名空间下的key，删除满足条件的token，
+// 会话、授权记录等不是token的key会被跳过
+func (p *redisTokenPurger) PurgeTokens(ctx context.Context, match func(ti oauth2.TokenInfo) bool) (int, error) {
+	count := 0
+	purge := func(ctx context.Context, cli redis.UniversalClient) error {
+		iter := cli.Scan(ctx, 0, p.ns+"*", 500).Iterator()
+		for iter.Next(ctx) {
+			key := iter.Val()
+			data, err := cli.Get(ctx, key).Result()
+			if err != nil {
+				//不是字符串类型的key，或者已经过期
+				continue
+			}
+			ti := parseStoredToken(data)
+			if ti == nil || !match(ti) {
+				continue
+			}
+			keys := []string{key}
+			if access := ti.GetAccess(); access != "" {
+				keys = append(keys, p.ns+access)
+			}
+			if refresh := ti.GetRefresh(); refresh != "" {
+				keys = append(keys, p.ns+refresh)
+			}
+			//cluster模式下不同key可能不在同一个分片，逐个删除
+			for _, one := range keys {
+				if err = p.cli.Del(ctx, one).Err(); err != nil {
+					return err
+				}
+			}
+			count++
+		}
+		return iter.Err()
+	}
+
+	if clusterCli, ok := p.cli.(*redis.ClusterClient); ok {
+		err := clusterCli.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+			return purge(ctx, master)
+		})
+		return count, err
+	}
+	return count, purge(ctx, p.cli)
+}
+
+// ScanTokens cursor的格式为 {节点序号}:{scan的cursor}，cluster模式下依次遍历每个主节点，
+// 同一个token可能会返回多次
+func (p *redisTokenPurger) ScanTokens(ctx context.Context, cursor string, limit int) ([]oauth2.TokenInfo, string, error) {
+	nodes := []redis.UniversalClient{p.cli}
+	if clusterCli, ok := p.cli.(*redis.ClusterClient); ok {
+		var lock sync.Mutex
+		masters := make([]*redis.Client, 0)
+		err := clusterCli.ForEachMaster(ctx, func(ctx context.Context, master *redis.Client) error {
+			lock.Lock()
+			masters = append(masters, master)
+			lock.Unlock()
+			return nil
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		sort.Slice(masters, func(i, j int) bool {
+			return masters[i].Options().Addr < masters[j].Options().Addr
+		})
+		nodes = nodes[:0]
+		for _, master := range masters {
+			nodes = append(nodes, master)
+		}
+	}
+
+	node, scanCursor := 0, uint64(0)
+	if cursor != "" {
+		if _, err := fmt.Sscanf(cursor, "%d:%d", &node, &scanCursor); err != nil || node >= len(nodes) {
+			return nil, "", fmt.Errorf("redis token store: invalid cursor %q", cursor)
+		}
+	}
+	cli := nodes[node]
+	keys, scanCursor, err := cli.Scan(ctx, scanCursor, p.ns+"*", int64(limit)).Result()
+	if err != nil {
+		return nil, "", err
+	}
+	tokens := make([]oauth2.TokenInfo, 0, len(keys))
+	for _, key := range keys {
+		data, err := cli.Get(ctx, key).Result()
+		if err != nil {
+			continue
+		}
+		if ti := parseStoredToken(data); ti != nil {
+			tokens = append(tokens, ti)
+		}
+	}
+	if scanCursor == 0 {
+		node++
+		if node >= len(nodes) {
+			return tokens, "", nil
+		}
+	}
+	return tokens, fmt.Sprintf("%d:%d", node, scanCursor), nil
+}
+
+// mysqlTokenPurger 遍历mysql中的token
+type mysqlTokenPurger struct {
+	db        *sql.DB
+	tableName string
+}
+
+// PurgeTokens 分批查询未过期的token，删除满足条件的
+func (p *mysqlTokenPurger) PurgeTokens(ctx context.Context, match func(ti oauth2.TokenInfo) bool) (int, error) {
+	count := 0
+	lastID := int64(0)
+	for {
+		rows, err := p.db.QueryContext(ctx, fmt.Sprintf("SELECT `id`, `data` FROM `%s` WHERE `id` > ? AND `expired_at` > ? "+
+			"ORDER BY `id` LIMIT 500", p.tableName), lastID, time.Now().Unix())
+		if err != nil {
+			return count, err
+		}
+		ids := make([]interface{}, 0)
+		n := 0
+		for rows.Next() {
+			var data string
+			if err = rows.Scan(&lastID, &data); err != nil {
+				_ = rows.Close()
+				return count, err
+			}
+			n++
+			if ti := parseStoredToken(data); ti != nil && match(ti) {
+				ids = append(ids, lastID)
+			}
+		}
+		_ = rows.Close()
+		if err = rows.Err(); err != nil {
+			return count, err
+		}
+
+		if len(ids) > 0 {
+			_, err = p.db.ExecContext(ctx, fmt.Sprintf("DELETE FROM `%s` WHERE `id` IN (%s)", p.tableName,
+				strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")), ids...)
+			if err != nil {
+				return count, err
+			}
+			count += len(ids)
+		}
+		if n < 500 {
+			return count, nil
+		}
+	}
+}
+
+// ScanTokens 按id的顺序查询未过期的token，cursor为上一批最后的id
+func (p *mysqlTokenPurger) ScanTokens(ctx context.Context, cursor string, limit int) ([]oauth2.TokenInfo, string, error) {
+	lastID, _ := strconv.ParseInt(cursor, 10, 64)
+	rows, err := p.db.QueryContext(ctx, fmt.Sprintf("SELECT `id`, `data` FROM `%s` WHERE `id` > ? AND `expired_at` > ? "+
+		"ORDER BY `id` LIMIT ?", p.tableName), lastID, time.Now().Unix(), limit)
+	if err != nil {
+		return nil, "", err
+	}
+	return scanTokenRows(rows, limit)
+}
+
+// scanTokenRows 读取id和data两列，不足一批时表示已经遍历完
+func scanTokenRows(rows *sql.Rows, limit int) ([]oauth2.TokenInfo, string, error) {
+	defer func() {
+		_ = rows.Close()
+	}()
+	tokens := make([]oauth2.TokenInfo, 0, limit)
+	n := 0
+	var lastID int64
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&lastID, &data); err != nil {
+			return nil, "", err
+		}
+		n++
+		if ti := parseStoredToken(data); ti != nil {
+			tokens = append(tokens, ti)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+	if n < limit {
+		return tokens, "", nil
+	}
+	return tokens, strconv.FormatInt(lastID, 10), nil
+}
+
+// RedisTokenStore redis中的token存储，支持批量删除和遍历
+type RedisTokenStore struct {
+	oauth2.TokenStore
+	*redisTokenPurger
+}
+
+// NewRedisTokenStore keyNamespace为空时使用默认的前缀
+func NewRedisTokenStore(cli redis.UniversalClient, keyNamespace string) *RedisTokenStore {
+	if keyNamespace == "" {
+		keyNamespace = defaultKeyNamespace
+	}
+	return &RedisTokenStore{
+		TokenStore:       newRedisTokenStore(cli, keyNamespace),
+		redisTokenPurger: &redisTokenPurger{cli: cli, ns: keyNamespace},
+	}
+}
+
+// MysqlTokenStore mysql中的token存储，支持批量删除和遍历
+type MysqlTokenStore struct {
+	oauth2.TokenStore
+	*mysqlTokenPurger
+}
+
+// NewMysqlTokenStore 建表失败时mysql存储会panic，这里转换为错误
+func NewMysqlTokenStore(db *sql.DB, tableName string, gcInterval time.Duration) (ts *MysqlTokenStore, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("mysql token store: %v", r)
+		}
+	}()
+	return &MysqlTokenStore{
+		TokenStore:       mysql.NewStoreWithDB(db, tableName, int(gcInterval.Seconds())),
+		mysqlTokenPurger: &mysqlTokenPurger{db: db, tableName: tableName},
+	}, nil
+}
@@ -0,0 +1,137 @@
+package oauth
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	oauth2 "github.com/go-oauth2/oauth2/v4"
+	"github.com/go-oauth2/oauth2/v4/models"
+	redis "github.com/go-redis/redis/v8"
+)
+
+func TestBuntTokenStore(t *testing.T) {
+	ctx := context.Background()
+	ts := mustMemoryTokenStore(t)
+
+	err := ts.Create(ctx, &models.Token{ClientID: "client1", Code: "code1", CodeCreateAt: time.Now(), CodeExpiresIn: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ti, _ := ts.GetByCode(ctx, "code1"); ti == nil || ti.GetClientID() != "client1" {
+		t.Fatal("code not found")
+	}
+	if err = ts.RemoveByCode(ctx, "code1"); err != nil {
+		t.Fatal(err)
+	}
+	if ti, _ := ts.GetByCode(ctx, "code1"); ti != nil {
+		t.Fatal("code not removed")
+	}
+
+	err = ts.Create(ctx, &models.Token{
+		ClientID:         "client1",
+		UserID:           "user1",
+		Access:           "access1",
+		AccessCreateAt:   time.Now(),
+		AccessExpiresIn:  50 * time.Millisecond,
+		Refresh:          "refresh1",
+		RefreshCreateAt:  time.Now(),
+		RefreshExpiresIn: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ti, _ := ts.GetByAccess(ctx, "access1"); ti == nil || ti.GetRefresh() != "refresh1" {
+		t.Fatal("access not found")
+	}
+	//access过期以后refresh仍然可以使用
+	time.Sleep(100 * time.Millisecond)
+	if ti, _ := ts.GetByAccess(ctx, "access1"); ti != nil {
+		t.Fatal("access not expired")
+	}
+	if ti, _ := ts.GetByRefresh(ctx, "refresh1"); ti == nil || ti.GetUserID() != "user1" {
+		t.Fatal("refresh not found")
+	}
+	if err = ts.RemoveByRefresh(ctx, "refresh1"); err != nil {
+		t.Fatal(err)
+	}
+	if ti, _ := ts.GetByRefresh(ctx, "refresh1"); ti != nil {
+		t.Fatal("refresh not removed")
+	}
+	//删除不存在的token不报错
+	if err = ts.RemoveByAccess(ctx, "unknown"); err != nil {
+		t.Fatal(err)
+	}
+
+	testTokenPurger(t, ts, ts)
+}
+
+func TestRedisTokenPurger(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	cli := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer func() {
+		_ = cli.Close()
+	}()
+	//命名空间下不是token的key会被跳过
+	cli.Set(context.Background(), "oauth2:session:1", `{"user_id":"user1"}`, 0)
+	ts := NewRedisTokenStore(cli, "oauth2:")
+	testTokenPurger(t, ts, ts)
+}
+
+// TestMysqlTokenPurger 需要本地的mysql，例如
+// OAUTH_TEST_MYSQL_DSN="user:pass@tcp(127.0.0.1:3306)/oauth?parseTime=true"
+func TestMysqlTokenPurger(t *testing.T) {
+	dsn := os.Getenv("OAUTH_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("OAUTH_TEST_MYSQL_DSN not set")
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_, _ = db.Exec("DROP TABLE oauth2_token_purge_test")
+		_ = db.Close()
+	}()
+	ts, err := NewMysqlTokenStore(db, "oauth2_token_purge_test", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testTokenPurger(t, ts, ts)
+}
+
+// testTokenPurger 只删除满足条件的token，access和refresh都不能再使用
+func testTokenPurger(t *testing.T, ts oauth2.TokenStore, purger TokenPurger) {
+	ctx := context.Background()
+	for _, one := range []*models.Token{
+		{ClientID: "client1", UserID: "purge-user1", Access: "p-access1", AccessCreateAt: time.Now(), AccessExpiresIn: time.Hour,
+			Refresh: "p-refresh1", RefreshCreateAt: time.Now(), RefreshExpiresIn: time.Hour},
+		{ClientID: "client1", UserID: "purge-user2", Access: "p-access2", AccessCreateAt: time.Now(), AccessExpiresIn: time.Hour},
+	} {
+		if err := ts.Create(ctx, one); err != nil {
+			t.Fatal(err)
+		}
+	}
+	purged, err := purger.PurgeTokens(ctx, func(ti oauth2.TokenInfo) bool {
+		return ti.GetUserID() == "purge-user1"
+	})
+	if err != nil || purged != 1 {
+		t.Fatalf("unexpected purge %d %v", purged, err)
+	}
+	if ti, _ := ts.GetByAccess(ctx, "p-access1"); ti != nil {
+		t.Fatal("access not purged")
+	}
+	if ti, _ := ts.GetByRefresh(ctx, "p-refresh1"); ti != nil {
+		t.Fatal("refresh not purged")
+	}
+	if ti, _ := ts.GetByAccess(ctx, "p-access2"); ti == nil {
+		t.Fatal("unmatched token purged")
+	}
+}